@@ -0,0 +1,239 @@
+package bluff
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+)
+
+// AIView is what a computer-controlled player knows about the game when making a move
+type AIView struct {
+	// The player's own hand
+	Hand []Dice
+	// Total number of dice in the game, including the player's own hand
+	TotalDice int
+	// The bid the player has to beat or challenge. Count is 0 if no bid has been made yet in the round.
+	CurrentBid Bid
+	Rules      Rules
+	// The round is a Perudo palifico round
+	Palifico bool
+}
+
+func (v AIView) engine() ruleEngine {
+	return v.Rules.engine(v.Palifico)
+}
+
+// Number of dice in the game the player can't see
+func (v AIView) unknownDice() int {
+	return v.TotalDice - len(v.Hand)
+}
+
+// Probability that the bid b is good, from the player's point of view
+func (v AIView) probability(b Bid) float64 {
+	return bidProbability(v.engine(), v.Hand, v.unknownDice(), b)
+}
+
+// Move is a decision made by a computer-controlled player
+type Move struct {
+	// Challenge the current bid
+	Challenge bool
+	// The bid to make, if not challenging
+	Bid Bid
+}
+
+// Strategy decides the moves of a computer-controlled player
+type Strategy interface {
+	Move(v AIView) Move
+}
+
+// Difficulty levels accepted by /addbot
+const (
+	EASY   = "easy"
+	NORMAL = "normal"
+	HARD   = "hard"
+)
+
+// Get the strategy for a difficulty level
+func strategyFor(difficulty string) (Strategy, error) {
+	switch difficulty {
+	case EASY:
+		return RandomStrategy{Rand: newStrategyRand()}, nil
+	case NORMAL:
+		return ThresholdStrategy{Threshold: 0.5}, nil
+	case HARD:
+		return BluffingStrategy{Threshold: 0.4, BluffRate: 0.3, Rand: newStrategyRand()}, nil
+	}
+	return nil, &GameError{"Unknown difficulty: " + difficulty + ". Use " + EASY + ", " + NORMAL + " or " + HARD + "."}
+}
+
+// Number of bids above the current one considered by the strategies
+const nCandidateBids = 16
+
+// Get the valid bids directly above the current bid
+func candidateBids(v AIView) []Bid {
+	return validBidsAbove(v.engine(), v.CurrentBid, nCandidateBids)
+}
+
+// A bid of more dice than there are in the game can't be good
+func impossibleBid(v AIView) bool {
+	return v.CurrentBid.Count >= v.TotalDice
+}
+
+// Create a source for the random choices of a strategy, seeded from crypto/rand. The strategies don't use the
+// global math/rand, so nothing needs to seed it.
+func newStrategyRand() *rand.Rand {
+	var seed [8]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		panic(err)
+	}
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(seed[:]))))
+}
+
+// Get r, or a new source if r is nil
+func strategyRand(r *rand.Rand) *rand.Rand {
+	if r == nil {
+		return newStrategyRand()
+	}
+	return r
+}
+
+// RandomStrategy challenges a third of the time and otherwise raises the bid by a random small step
+type RandomStrategy struct {
+	// Source of the random choices. A new source seeded from crypto/rand is used if nil. Not safe for concurrent
+	// use, so each strategy needs its own.
+	Rand *rand.Rand
+}
+
+func (s RandomStrategy) Move(v AIView) Move {
+	r := strategyRand(s.Rand)
+	if v.CurrentBid.Count > 0 && (impossibleBid(v) || r.Intn(3) == 0) {
+		return Move{Challenge: true}
+	}
+	return Move{Bid: candidateBids(v)[r.Intn(3)]}
+}
+
+// ThresholdStrategy challenges when the current bid is good with lower probability than Threshold. Otherwise it
+// makes the highest bid it believes to be good with at least Threshold probability.
+type ThresholdStrategy struct {
+	Threshold float64
+}
+
+func (s ThresholdStrategy) Move(v AIView) Move {
+	if v.CurrentBid.Count > 0 && (impossibleBid(v) || v.probability(v.CurrentBid) < s.Threshold) {
+		return Move{Challenge: true}
+	}
+	return Move{Bid: safestHighBid(v, s.Threshold)}
+}
+
+// Get the highest bid above the current bid that is good with at least probability threshold. If there's no such
+// bid, get the most probable one.
+func safestHighBid(v AIView, threshold float64) Bid {
+	candidates := candidateBids(v)
+	best := candidates[0]
+	bestP := v.probability(best)
+	for _, b := range candidates[1:] {
+		p := v.probability(b)
+		if p >= threshold || (bestP < threshold && p > bestP) {
+			best, bestP = b, p
+		}
+	}
+	return best
+}
+
+// BluffingStrategy plays like ThresholdStrategy, but with probability BluffRate overbids to put pressure on the
+// next player
+type BluffingStrategy struct {
+	Threshold float64
+	BluffRate float64
+	// Source of the random choices, like in RandomStrategy
+	Rand *rand.Rand
+}
+
+func (s BluffingStrategy) Move(v AIView) Move {
+	r := strategyRand(s.Rand)
+	m := ThresholdStrategy{s.Threshold}.Move(v)
+	if !m.Challenge && r.Float64() < s.BluffRate {
+		candidates := candidateBids(v)
+		for i, b := range candidates {
+			if b == m.Bid {
+				j := i + 1 + r.Intn(3)
+				if j >= len(candidates) {
+					j = len(candidates) - 1
+				}
+				m.Bid = candidates[j]
+				break
+			}
+		}
+	}
+	return m
+}
+
+// Decide the move of the computer-controlled player in turn. A bid the rules don't allow is replaced with the minimal
+// raise.
+func (g *Game) AIMove() (Move, error) {
+	p := g.Players[g.TurnIdx].Info
+	s, err := strategyFor(g.AIPlayers[p.ID])
+	if err != nil {
+		return Move{}, err
+	}
+
+	m := s.Move(aiView(g, g.TurnIdx))
+	if !m.Challenge {
+		m.Bid.PlayerID = p.ID
+		if g.engine().checkBid(g.CurrentBid, m.Bid) != nil {
+			m.Bid = nextValidBid(g.engine(), g.CurrentBid)
+			m.Bid.PlayerID = p.ID
+		}
+	}
+	return m, nil
+}
+
+// Make the view of the game for the player at index idx
+func aiView(g *Game, idx int) AIView {
+	total := 0
+	for _, p := range g.Players {
+		total += len(p.Hand)
+	}
+	return AIView{Hand: g.Players[idx].Hand, TotalDice: total, CurrentBid: g.CurrentBid, Rules: g.Rules, Palifico: g.Palifico}
+}
+
+// Probability that there are at least b.Count dice matching b.Dice in the game, given the hand of the player and
+// the number of other dice unknown to the player
+func bidProbability(m diceMatcher, hand []Dice, unknown int, b Bid) float64 {
+	return binomialAtLeast(unknown, b.Count-handCount(m, hand, b.Dice), m.matchProbability(b.Dice))
+}
+
+// BidOdds gives the probability that there are at least count dice matching face in the game, as seen by a player
+// holding hand. unknown is the number of other dice in the game, hidden from the player. Wild dice match any face,
+// so with the default rules each unknown dice matches with probability 2/6. In a Perudo palifico round there are no
+// wilds.
+func BidOdds(r Rules, palifico bool, hand []Dice, unknown int, count int, face Dice) float64 {
+	return bidProbability(r.engine(palifico), hand, unknown, Bid{Dice: face, Count: count})
+}
+
+// Probability of at least k successes in n trials with success probability p
+func binomialAtLeast(n, k int, p float64) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if k > n || p <= 0 {
+		return 0
+	}
+	// E.g. with two faces and wilds, every dice matches
+	if p >= 1 {
+		return 1
+	}
+	// Probability of exactly i successes, starting from i = 0
+	pmf := 1.0
+	for i := 0; i < n; i++ {
+		pmf *= 1 - p
+	}
+	sum := 0.0
+	for i := 0; i <= n; i++ {
+		if i >= k {
+			sum += pmf
+		}
+		pmf *= float64(n-i) / float64(i+1) * p / (1 - p)
+	}
+	return sum
+}
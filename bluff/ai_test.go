@@ -0,0 +1,220 @@
+package bluff
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+func TestBinomialAtLeast(t *testing.T) {
+	tests := []struct {
+		n, k int
+		p    float64
+		want float64
+	}{
+		{5, 0, 0.5, 1},
+		{5, -2, 0.5, 1},
+		{5, 6, 0.5, 0},
+		{1, 1, 0.25, 0.25},
+		{2, 1, 0.5, 0.75},
+		{3, 2, 0.5, 0.5},
+		{4, 4, 1.0 / 3.0, 1.0 / 81.0},
+	}
+	for _, tt := range tests {
+		if got := binomialAtLeast(tt.n, tt.k, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Error(tt, got)
+		}
+	}
+}
+
+func TestBidProbability(t *testing.T) {
+	// Own hand already covers the bid
+	if bidProbability(Rules{}, []Dice{THREE, WILD}, 5, Bid{Dice: THREE, Count: 2}) != 1 {
+		t.Fail()
+	}
+	// One more three needed from one unknown dice: three or wild
+	if math.Abs(bidProbability(Rules{}, []Dice{THREE}, 1, Bid{Dice: THREE, Count: 2})-2.0/6.0) > 1e-9 {
+		t.Fail()
+	}
+	// One more wild needed from one unknown dice
+	if math.Abs(bidProbability(Rules{}, []Dice{WILD}, 1, Bid{Dice: WILD, Count: 2})-1.0/6.0) > 1e-9 {
+		t.Fail()
+	}
+	// Not enough dice in the game
+	if bidProbability(Rules{}, []Dice{THREE}, 1, Bid{Dice: THREE, Count: 3}) != 0 {
+		t.Fail()
+	}
+}
+
+func TestBidOdds(t *testing.T) {
+	perudo := Rules{Variant: PERUDO}
+	tests := []struct {
+		r        Rules
+		palifico bool
+		hand     []Dice
+		unknown  int
+		count    int
+		face     Dice
+		want     float64
+	}{
+		{Rules{}, false, nil, 1, 1, THREE, 2.0 / 6.0},
+		{Rules{}, false, nil, 1, 1, WILD, 1.0 / 6.0},
+		{Rules{}, false, nil, 2, 2, THREE, 1.0 / 9.0},
+		{Rules{}, false, []Dice{WILD, ONE}, 0, 2, ONE, 1},
+		{Rules{NoWilds: true}, false, nil, 1, 1, THREE, 1.0 / 6.0},
+		{Rules{NoWilds: true}, false, []Dice{WILD, ONE}, 0, 2, ONE, 0},
+		{perudo, false, nil, 1, 1, ONE, 2.0 / 6.0},
+		{perudo, true, nil, 1, 1, ONE, 1.0 / 6.0},
+	}
+	for _, tt := range tests {
+		if got := BidOdds(tt.r, tt.palifico, tt.hand, tt.unknown, tt.count, tt.face); math.Abs(got-tt.want) > 1e-9 {
+			t.Error(tt, got)
+		}
+	}
+}
+
+func randomView() AIView {
+	hand := make([]Dice, 1+rand.Intn(5))
+	for i := range hand {
+		hand[i] = Dice(rand.Intn(int(FIVE + 1)))
+	}
+	total := len(hand) + 1 + rand.Intn(20)
+	return AIView{Hand: hand, TotalDice: total, CurrentBid: bidFromScore(rand.Intn(total * 6))}
+}
+
+func TestStrategiesMakeValidMoves(t *testing.T) {
+	for _, difficulty := range []string{EASY, NORMAL, HARD} {
+		s, err := strategyFor(difficulty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 1000; i++ {
+			v := randomView()
+			m := s.Move(v)
+			if m.Challenge && v.CurrentBid.Count == 0 {
+				t.Error(difficulty, "challenged without bid", v)
+			}
+			if !m.Challenge && !isGreater(m.Bid, v.CurrentBid) {
+				t.Error(difficulty, "bid too low", v, m.Bid)
+			}
+			if !m.Challenge && impossibleBid(v) {
+				t.Error(difficulty, "didn't challenge impossible bid", v)
+			}
+		}
+	}
+}
+
+func TestThresholdStrategy(t *testing.T) {
+	s := ThresholdStrategy{Threshold: 0.5}
+
+	// Bid covered by own hand
+	m := s.Move(AIView{Hand: []Dice{FOUR, FOUR, WILD}, TotalDice: 6, CurrentBid: Bid{Dice: FOUR, Count: 3}})
+	if m.Challenge {
+		t.Fail()
+	}
+
+	// Needs all three unknown dice to match
+	m = s.Move(AIView{Hand: []Dice{ONE, TWO, THREE}, TotalDice: 6, CurrentBid: Bid{Dice: FOUR, Count: 3}})
+	if !m.Challenge {
+		t.Fail()
+	}
+
+	// First bid of the round is based on own hand
+	m = s.Move(AIView{Hand: []Dice{FIVE, FIVE, FIVE, WILD}, TotalDice: 8})
+	if m.Challenge || m.Bid.Dice != FIVE || m.Bid.Count < 3 {
+		t.Error(m)
+	}
+}
+
+func TestUnknownDifficulty(t *testing.T) {
+	var g Game
+	if g.AddAIPlayer(PlayerInfo{-1, "Bot"}, "impossible") == nil {
+		t.Fail()
+	}
+	if len(g.Players) != 0 {
+		t.Fail()
+	}
+}
+
+func TestAddBotCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(-100, alice, addBotCmd))
+	tg.HandleUpdate(update(-100, alice, addBotCmd+" "+EASY))
+	tg.HandleUpdate(update(-100, alice, addBotCmd+" impossible"))
+
+	g, _ := onlyGame(b, -100)
+	if len(g.Players) != 2 || !g.IsAI(g.Players[0].Info.ID) || !g.IsAI(g.Players[1].Info.ID) {
+		t.Fatal(g.Players)
+	}
+	if g.AIPlayers[g.Players[0].Info.ID] != NORMAL || g.AIPlayers[g.Players[1].Info.ID] != EASY {
+		t.Error(g.AIPlayers)
+	}
+
+	// Can't add bots after the game has begun
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	tg.HandleUpdate(update(-100, alice, addBotCmd))
+	if len(g.Players) != 2 {
+		t.Error(g.Players)
+	}
+}
+
+func TestBotWithoutStrategy(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(-100, alice, addBotCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+
+	// A computer player whose strategy fails makes the minimal bid
+	g, _ := onlyGame(b, -100)
+	g.AIPlayers[g.Players[0].Info.ID] = "broken"
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	if g.State != STARTED || g.Players[g.TurnIdx].Info.ID != alice.ID || g.CurrentBid.Count != 1 {
+		t.Error(g)
+	}
+}
+
+func TestGameAgainstBots(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		var r msgRecorder
+		tg, b := newTelegramBot(&r)
+		alice := telegram.User{ID: 1, FirstName: "Alice"}
+		tg.HandleUpdate(update(-100, alice, startCmd))
+		tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+		tg.HandleUpdate(update(-100, alice, addBotCmd+" "+EASY))
+		tg.HandleUpdate(update(-100, alice, addBotCmd+" "+HARD))
+		tg.HandleUpdate(update(-100, alice, beginCmd))
+
+		for n := 0; ; n++ {
+			g, found := onlyGame(b, -100)
+			if !found {
+				break
+			}
+			if n > 1000 {
+				t.Fatal("game didn't finish")
+			}
+			// Bots play their turns immediately
+			if g.Players[g.TurnIdx].Info.ID != alice.ID {
+				t.Fatal("bot didn't play its turn")
+			}
+			// Alice always challenges if she can
+			if g.CurrentBid.Count > 0 {
+				tg.HandleUpdate(update(-100, alice, challengeCmd))
+			} else {
+				tg.HandleUpdate(update(-100, alice, bidCmd+" 1 1"))
+			}
+		}
+
+		for _, m := range r.messages {
+			if m.ChatID < 0 && m.ChatID != -100 {
+				t.Error("message sent to bot", m)
+			}
+		}
+	}
+}
@@ -1,172 +1,678 @@
 package bluff
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
+	"sort"
 	"strconv"
 	"strings"
-
-	"github.com/khuttun/bluffbot/telegram"
+	"sync"
+	"time"
 )
 
 type Bot struct {
-	username string
-	telegram telegram.MsgSender
-	games    map[int]*Game
+	messenger Messenger
+	// Guards games and chatLocks
+	mutex sync.Mutex
+	// Games keyed by their IDs
+	games map[string]*Game
+	// Commands targeting the same chat are serialized with these locks. They guard also the games of the chat.
+	chatLocks map[int]*sync.Mutex
+	store     GameStore
+	// Guarded by mutex. The turn timers and the status messages are keyed by game ID.
+	clock          Clock
+	turnTimers     map[string]*turnTimer
+	statusMessages map[string]statusMessage
+	events         EventSink
+	// The hands of the last ended round of each game, for /verify. Kept for the last finished game of each chat too.
+	revealedRounds map[string]revealedRound
+	stats          StatsStore
+	// Serializes updating the stats, which can be shared by all chats
+	statsMutex sync.Mutex
+	// Guarded by mutex
+	logger *slog.Logger
+}
+
+// Message showing the current bid of a game, with buttons for making the next move. The message is edited in
+// place after every bid of the round.
+type statusMessage struct {
+	ID   int
+	Text string
+}
+
+// Create a new bot sending its messages with m and persisting games to store. The games already in the store are
+// resumed.
+func NewBotWithMessenger(m Messenger, store GameStore) (*Bot, error) {
+	games, err := store.LoadGames()
+	if err != nil {
+		return nil, err
+	}
+	b := &Bot{
+		messenger:      m,
+		games:          games,
+		chatLocks:      make(map[int]*sync.Mutex),
+		store:          store,
+		clock:          realClock{},
+		turnTimers:     make(map[string]*turnTimer),
+		statusMessages: make(map[string]statusMessage),
+		revealedRounds: make(map[string]revealedRound),
+		stats:          NewMemoryStatsStore(),
+		logger:         slog.Default()}
+
+	// Turn timers restart from the beginning for the resumed games
+	for _, g := range games {
+		b.startTurnTimer(Room{ID: g.ChatID}, g)
+	}
+	return b, nil
 }
 
-// Create a new bot
-func NewBot(uname string, tgram telegram.MsgSender) *Bot {
-	return &Bot{username: uname, telegram: tgram, games: make(map[int]*Game)}
+// Send the events of all games to s. nil disables the events.
+func (b *Bot) SetEventSink(s EventSink) {
+	b.mutex.Lock()
+	b.events = s
+	var games []*Game
+	for _, g := range b.games {
+		games = append(games, g)
+	}
+	b.mutex.Unlock()
+
+	for _, g := range games {
+		lock := b.chatLock(g.ChatID)
+		lock.Lock()
+		b.attachEventSink(g)
+		lock.Unlock()
+	}
 }
 
-// Handle update from Telegram
-func (b *Bot) HandleUpdate(u telegram.Update) {
-	cmdParts := strings.Split(*u.Message.Text, " ")
-	cmdName := strings.TrimSuffix(cmdParts[0], "@"+b.username)
-	switch cmdName {
+// Keep the player stats in s instead of memory
+func (b *Bot) SetStatsStore(s StatsStore) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.stats = s
+}
+
+// Log the failures of the bot to l instead of slog.Default()
+func (b *Bot) SetLogger(l *slog.Logger) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.logger = l
+}
+
+func (b *Bot) log() *slog.Logger {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.logger
+}
+
+// Load the player stats of a chat
+func (b *Bot) loadStats(chatID int) (map[int]PlayerStats, error) {
+	b.mutex.Lock()
+	s := b.stats
+	b.mutex.Unlock()
+	return s.LoadStats(chatID)
+}
+
+// Load the player stats over all chats
+func (b *Bot) loadGlobalStats() (map[int]PlayerStats, error) {
+	b.mutex.Lock()
+	s := b.stats
+	b.mutex.Unlock()
+	return s.LoadGlobalStats()
+}
+
+// Change the player stats of a chat with update and store them
+func (b *Bot) updateStats(chatID int, update func(stats map[int]PlayerStats)) {
+	b.mutex.Lock()
+	s := b.stats
+	b.mutex.Unlock()
+	load := func() (map[int]PlayerStats, error) { return s.LoadStats(chatID) }
+	save := func(stats map[int]PlayerStats) error { return s.SaveStats(chatID, stats) }
+	b.changeStats(load, save, update, b.log().With("chat_id", chatID))
+}
+
+// Change the player stats over all chats with update and store them
+func (b *Bot) updateGlobalStats(update func(stats map[int]PlayerStats)) {
+	b.mutex.Lock()
+	s := b.stats
+	b.mutex.Unlock()
+	b.changeStats(s.LoadGlobalStats, s.SaveGlobalStats, update, b.log())
+}
+
+func (b *Bot) changeStats(load func() (map[int]PlayerStats, error), save func(map[int]PlayerStats) error, update func(stats map[int]PlayerStats), log *slog.Logger) {
+	b.statsMutex.Lock()
+	defer b.statsMutex.Unlock()
+
+	stats, err := load()
+	if err != nil {
+		log.Error("Failed to load stats", "err", err)
+		return
+	}
+	update(stats)
+	if err := save(stats); err != nil {
+		log.Error("Failed to store stats", "err", err)
+	}
+}
+
+// Connect a game to the bot's event sink
+func (b *Bot) attachEventSink(g *Game) {
+	b.mutex.Lock()
+	s := b.events
+	b.mutex.Unlock()
+	if s == nil {
+		g.SetEventSink(nil)
+	} else {
+		g.SetEventSink(gameEventSink{g.ID, g.ChatID, b, s})
+	}
+}
+
+// Handle a command sent by a user. Safe to call from multiple goroutines concurrently.
+func (b *Bot) HandleCommand(c Command) {
+	chatID := b.targetChatID(c)
+	lock := b.chatLock(chatID)
+	lock.Lock()
+	defer lock.Unlock()
+	defer b.persistGames(chatID)
+
+	switch c.Name {
 	case startCmd:
-		b.onStartCmd(cmdParts[1:], *u.Message)
+		b.onStartCmd(c)
+	case joinCmd:
+		b.onJoinCmd(c)
 	case stopCmd:
-		b.onStopCmd(cmdParts[1:], *u.Message)
+		b.onStopCmd(c)
 	case beginCmd:
-		b.onBeginCmd(cmdParts[1:], *u.Message)
-	case bidCmd, bidButtonText:
-		b.onBidCmd(cmdParts[1:], *u.Message)
+		b.onBeginCmd(c)
+	case bidCmd:
+		b.onBidCmd(c)
 	case challengeCmd:
-		b.onChallengeCmd(cmdParts[1:], *u.Message)
+		b.onChallengeCmd(c)
+	case exactCmd:
+		b.onExactCmd(c)
+	case addBotCmd:
+		b.onAddBotCmd(c)
+	case timeoutCmd:
+		b.onTimeoutCmd(c)
+	case rulesCmd:
+		b.onRulesCmd(c)
+	case verifyCmd:
+		b.onVerifyCmd(c)
+	case statsCmd:
+		b.onStatsCmd(c)
+	case leaderboardCmd:
+		b.onLeaderboardCmd(c)
+	case ratingCmd:
+		b.onRatingCmd(c)
+	case seedCmd:
+		b.onSeedCmd(c)
+	case oddsCmd:
+		b.onOddsCmd(c)
+	case watchCmd:
+		b.onWatchCmd(c)
 	default:
-		b.telegram.SendMessage(u.Message.Chat.ID, fmt.Sprintf("Unknown command: %v", cmdName))
+		b.send(c.Room.ID, fmt.Sprintf("Unknown command: %v", c.Name))
 	}
 }
 
-func (b *Bot) onStartCmd(params []string, msg telegram.Message) {
-	if len(params) == 0 { // No params: start game
-		if _, gameFound := b.games[msg.Chat.ID]; !gameFound {
-			response := fmt.Sprintf("Starting a new game of %v! ", gameName)
-			response += "Use the below link and click the START button in the opened chat window to join the game. "
-			response += fmt.Sprintf("Once everyone has joined, send %v command to begin the game.", beginCmd)
-			response += "\n\n"
-			response += fmt.Sprintf("https://telegram.me/%v?start=%v", b.username, msg.Chat.ID)
-			b.startGame(msg.Chat.ID, response)
-		} else {
-			b.telegram.SendMessage(msg.Chat.ID, "There's already a game started in this chat")
-		}
-	} else { // 1st param is the game/chat ID: player joining
-		gameid, convErr := strconv.Atoi(params[0])
-		if convErr != nil {
-			b.telegram.SendMessage(msg.Chat.ID, fmt.Sprintf("Invalid game ID: %v", params[0]))
+// Handle a press of a button in a status message. Safe to call from multiple goroutines concurrently.
+func (b *Bot) HandleButtonPress(p ButtonPress) {
+	room := p.Room
+	lock := b.chatLock(room.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	defer b.persistGames(room.ID)
+
+	g, found := b.statusGame(room.ID, p.MessageID)
+	if !found {
+		var err error
+		g, err = b.chatGame(room.ID, p.From.ID, "")
+		if err != nil {
+			b.answer(p.ID, err.Error())
 			return
 		}
+		// The status message isn't known e.g. after a restart, continue with the one whose button was pressed
+		if _, found := b.statusMessage(g.ID); !found {
+			b.setStatusMessage(g.ID, statusMessage{ID: p.MessageID})
+		}
+	}
 
-		if g, gameFound := b.games[gameid]; gameFound {
-			err := g.AddPlayer(PlayerInfo{ID: msg.From.ID, Name: msg.From.FirstName})
-			if err == nil {
-				b.telegram.SendMessage(gameid, fmt.Sprintf("%v joined", msg.From.FirstName))
-			} else {
-				b.telegram.SendMessage(msg.Chat.ID, err.Error())
+	var err error
+	params := strings.Split(p.Data, " ")
+	switch params[0] {
+	case bidCallback:
+		var bid Bid
+		bid, err = callbackDataToBid(params[1:])
+		if err == nil {
+			bid.PlayerID = p.From.ID
+			err = b.bid(room, g, p.From.Name, bid)
+		}
+	case challengeCallback:
+		err = b.challenge(room, g, p.From.ID)
+	case exactCallback:
+		err = b.callExact(room, g, p.From.ID)
+	default:
+		err = fmt.Errorf("Unknown action: %v", params[0])
+	}
+
+	if err != nil {
+		b.answer(p.ID, err.Error())
+		return
+	}
+	b.answer(p.ID, "")
+	b.afterMove(room, g)
+}
+
+// Get the ID of the chat whose game a command operates on
+func (b *Bot) targetChatID(c Command) int {
+	if joining(c) {
+		if g, found := b.game(c.Args[0]); found {
+			return g.ChatID
+		}
+	}
+	return c.Room.ID
+}
+
+// Is the command a player joining a game? Players join by sending the ID of the game from their private chat with
+// the bot.
+func joining(c Command) bool {
+	return c.Name == startCmd && len(c.Args) > 0 && c.Room.ID == c.From.ID
+}
+
+// Get the lock used to serialize commands targeting a chat
+func (b *Bot) chatLock(chatID int) *sync.Mutex {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	lock, found := b.chatLocks[chatID]
+	if !found {
+		lock = &sync.Mutex{}
+		b.chatLocks[chatID] = lock
+	}
+	return lock
+}
+
+func (b *Bot) game(id string) (*Game, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	g, found := b.games[id]
+	return g, found
+}
+
+func (b *Bot) setGame(g *Game) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.games[g.ID] = g
+}
+
+// Remove a game from the bot and from the store
+func (b *Bot) deleteGame(g *Game) {
+	b.mutex.Lock()
+	delete(b.games, g.ID)
+	b.mutex.Unlock()
+	if err := b.store.DeleteGame(g.ID); err != nil {
+		b.log().Error("Failed to delete game", "game_id", g.ID, "err", err)
+	}
+}
+
+// Get the games of a chat, ordered by their table names
+func (b *Bot) chatGames(chatID int) []*Game {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var games []*Game
+	for _, g := range b.games {
+		if g.ChatID == chatID {
+			games = append(games, g)
+		}
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].Name < games[j].Name })
+	return games
+}
+
+// Find the game a user means in a chat: the game at the named table if name isn't empty, otherwise the game the user
+// plays or watches, or the only game of the chat
+func (b *Bot) chatGame(chatID int, userID int, name string) (*Game, error) {
+	games := b.chatGames(chatID)
+	if name != "" {
+		for _, g := range games {
+			if strings.EqualFold(g.Name, name) {
+				return g, nil
 			}
-		} else {
-			b.telegram.SendMessage(msg.Chat.ID, fmt.Sprintf("Invalid game ID: %v", gameid))
+		}
+		return nil, &GameError{fmt.Sprintf("No game at %v in this chat", name)}
+	}
+	if len(games) == 0 {
+		return nil, &GameError{"No game started in this chat"}
+	}
+	for _, g := range games {
+		if isPlayer(g, userID) {
+			return g, nil
+		}
+	}
+	for _, g := range games {
+		if g.IsSpectator(userID) {
+			return g, nil
+		}
+	}
+	if len(games) == 1 {
+		return games[0], nil
+	}
+	names := make([]string, len(games))
+	for i, g := range games {
+		names[i] = g.Name
+	}
+	return nil, &GameError{fmt.Sprintf("There are several games in this chat, at %v. Join one of them first.", strings.Join(names, ", "))}
+}
+
+// Is the user one of the players of a game?
+func isPlayer(g *Game, userID int) bool {
+	for _, p := range g.Players {
+		if p.Info.ID == userID {
+			return true
 		}
 	}
+	return false
 }
 
-func (b *Bot) onStopCmd(params []string, msg telegram.Message) {
-	if _, gameFound := b.games[msg.Chat.ID]; gameFound {
-		b.finishGame(msg.Chat.ID, "Game ended")
-	} else {
-		b.telegram.SendMessage(msg.Chat.ID, "No game started in this chat")
+// Find the game whose status message is in a chat and has the given ID
+func (b *Bot) statusGame(chatID int, messageID int) (*Game, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for id, m := range b.statusMessages {
+		if g, found := b.games[id]; found && g.ChatID == chatID && m.ID == messageID {
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+func (b *Bot) statusMessage(gameID string) (statusMessage, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	m, found := b.statusMessages[gameID]
+	return m, found
+}
+
+func (b *Bot) setStatusMessage(gameID string, m statusMessage) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.statusMessages[gameID] = m
+}
+
+func (b *Bot) deleteStatusMessage(gameID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.statusMessages, gameID)
+}
+
+// Get the revealed rounds of the games in a chat, sorted by table
+func (b *Bot) chatRevealedRounds(chatID int) []revealedRound {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var rounds []revealedRound
+	for _, r := range b.revealedRounds {
+		if r.ChatID == chatID {
+			rounds = append(rounds, r)
+		}
+	}
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i].Table < rounds[j].Table })
+	return rounds
+}
+
+// Replace the revealed round of a game. The rounds of the chat's other games that have finished are removed.
+func (b *Bot) setRevealedRound(r revealedRound) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for id, old := range b.revealedRounds {
+		if _, running := b.games[id]; old.ChatID == r.ChatID && id != r.GameID && !running {
+			delete(b.revealedRounds, id)
+		}
+	}
+	b.revealedRounds[r.GameID] = r
+}
+
+// Save the current state of a chat's games to the store. Finished games are removed from the store already when
+// they finish.
+func (b *Bot) persistGames(chatID int) {
+	for _, g := range b.chatGames(chatID) {
+		if err := b.store.SaveGame(g.ID, g); err != nil {
+			b.log().Error("Failed to store game", "game_id", g.ID, "err", err)
+		}
 	}
 }
 
-func (b *Bot) onBeginCmd(params []string, msg telegram.Message) {
-	if g, gameFound := b.games[msg.Chat.ID]; gameFound {
+func (b *Bot) onStartCmd(c Command) {
+	if joining(c) {
+		g, gameFound := b.game(c.Args[0])
+		if !gameFound {
+			b.send(c.Room.ID, fmt.Sprintf("Invalid game ID: %v", c.Args[0]))
+			return
+		}
+		b.join(c.Room, c.From, g)
+		return
+	}
+
+	// The first game of a chat can be started without a name, the others are told apart by the names of their tables
+	games := b.chatGames(c.Room.ID)
+	name := strings.Join(c.Args, " ")
+	if name == "" {
+		if len(games) > 0 {
+			b.send(c.Room.ID, fmt.Sprintf("There's already a game started in this chat. Send \"%v name\" command to start another game at a table of its own.", startCmd))
+			return
+		}
+		name = tableName(1)
+	}
+	for _, other := range games {
+		if strings.EqualFold(other.Name, name) {
+			b.send(c.Room.ID, fmt.Sprintf("There's already a game at %v in this chat", other.Name))
+			return
+		}
+	}
+
+	g := &Game{ID: newGameID(), ChatID: c.Room.ID, Name: name}
+	response := fmt.Sprintf("Starting a new game of %v! ", gameName)
+	if len(c.Args) > 0 {
+		response = fmt.Sprintf("Starting a new game of %v at %v! ", gameName, g.Name)
+	}
+	response += fmt.Sprintf("Once everyone has joined, send %v command to begin the game. ", beginCmd)
+	response += fmt.Sprintf("Send \"%v [%v|%v|%v]\" command to add a computer-controlled player. ", addBotCmd, EASY, NORMAL, HARD)
+	response += fmt.Sprintf("Send %v command to set a time limit for making a move and %v command to change the rules. ", timeoutCmd, rulesCmd)
+	response += fmt.Sprintf("Others can send %v command to follow the game and get everyone's hands as private messages.", watchCmd)
+	response += "\n\n"
+	response += b.messenger.JoinInstructions(g)
+	b.startGame(g, response)
+}
+
+// Join a game from its chat, e.g. in messengers without links for joining a game. The game is chosen by the name of
+// its table if the chat has several games.
+func (b *Bot) onJoinCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, 0, strings.Join(c.Args, " "))
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	b.join(c.Room, c.From, g)
+}
+
+// Add a user to a game as a player. Errors are sent to room, where the user asked to join.
+func (b *Bot) join(room Room, u User, g *Game) {
+	// A user can play only one game in a chat, so that it's clear which game the user's commands are for
+	for _, other := range b.chatGames(g.ChatID) {
+		if other != g && isPlayer(other, u.ID) {
+			b.send(room.ID, fmt.Sprintf("You're already playing at %v", other.Name))
+			return
+		}
+	}
+	if err := g.AddPlayer(PlayerInfo{ID: u.ID, Name: u.Name}); err != nil {
+		b.send(room.ID, err.Error())
+		return
+	}
+	b.updateStats(g.ChatID, func(stats map[int]PlayerStats) { rememberUser(stats, u) })
+	b.send(g.ChatID, b.gameText(g, fmt.Sprintf("%v joined", u.Name)))
+}
+
+func (b *Bot) onStopCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, strings.Join(c.Args, " "))
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	g.Stop()
+	b.finishGame(g, "Game ended")
+}
+
+func (b *Bot) onBeginCmd(c Command) {
+	if g, err := b.chatGame(c.Room.ID, c.From.ID, ""); err == nil {
 		err := g.StartGame()
 		if err == nil {
 			response := "The game begins. All the players should have now received their first round hand from me as a private message."
 			response += "\n\n"
 			response += fmt.Sprintf("Send \"%v count dice\" command to make a bid.", bidCmd)
-			response += fmt.Sprintf("Use \"*\" for wild. For example, to make a bid of five wilds, send command \"%v 5 *\".", bidCmd)
+			if g.Rules.Variant == PERUDO {
+				response += fmt.Sprintf("1s are wild. For example, to make a bid of three 1s, send command \"%v 3 1\".", bidCmd)
+			} else {
+				response += fmt.Sprintf("Use \"*\" for wild. For example, to make a bid of five wilds, send command \"%v 5 *\".", bidCmd)
+			}
 			response += "\n\n"
-			response += fmt.Sprintf("Send %v command to challenge current bid.", challengeCmd)
+			response += fmt.Sprintf("Send %v command to challenge current bid, or %v command to claim it's exactly right. ", challengeCmd, exactCmd)
+			response += "A right exact call wins back one lost dice, a wrong one loses one dice."
 			response += "\n\n"
-			response += turnMsg(g)
-			b.beginRound(&msg.Chat, g, response)
+			response += "You can also use the buttons below the status message to make your move. "
+			response += fmt.Sprintf("Send %v command on your turn to get the odds of your moves in a private message.", oddsCmd)
+			b.beginRound(c.Room, g, response)
+			b.afterMove(c.Room, g)
 		} else {
-			b.telegram.SendMessage(msg.Chat.ID, err.Error())
+			b.send(c.Room.ID, err.Error())
 		}
 	} else {
-		b.telegram.SendMessage(msg.Chat.ID, "No game started in this chat")
+		b.send(c.Room.ID, err.Error())
 	}
 }
 
-func (b *Bot) onBidCmd(params []string, msg telegram.Message) {
-	g, gameFound := b.games[msg.Chat.ID]
-	if !gameFound {
-		b.telegram.SendMessage(msg.Chat.ID, "No game started in this chat")
+func (b *Bot) onBidCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
 		return
 	}
 
-	if len(params) != 2 {
-		b.telegram.SendMessage(msg.Chat.ID, fmt.Sprintf("Send \"%v count dice\" command to make a bid.", bidCmd))
+	if len(c.Args) != 2 {
+		b.send(c.Room.ID, fmt.Sprintf("Send \"%v count dice\" command to make a bid.", bidCmd))
 		return
 	}
 
-	count, errc := strconv.Atoi(params[0])
-	if errc != nil {
-		b.telegram.SendMessage(msg.Chat.ID, fmt.Sprintf("Invalid count: %v", params[0]))
+	bid, err := g.Rules.ParseBid(c.Args[0], c.Args[1])
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
 		return
 	}
 
-	d, errd := stringToDice(params[1])
-	if errd != nil {
-		b.telegram.SendMessage(msg.Chat.ID, errd.Error())
+	bid.PlayerID = c.From.ID
+	errBid := b.bid(c.Room, g, c.From.Name, bid)
+	if errBid != nil {
+		b.send(c.Room.ID, errBid.Error())
 		return
 	}
+	b.afterMove(c.Room, g)
+}
 
-	errBid := g.Bid(Bid{PlayerID: msg.From.ID, Dice: d, Count: count})
-	if errBid != nil {
-		b.telegram.SendMessage(msg.Chat.ID, errBid.Error())
-		return
+// Make a bid and announce it in the chat
+func (b *Bot) bid(room Room, g *Game, name string, bid Bid) error {
+	err := g.Bid(bid)
+	if err != nil {
+		return err
 	}
 
-	b.telegram.SendMessageAndDisplayCustomKeyboard(msg.Chat.ID, fmt.Sprintf("%v bid %v %vs.%v", msg.From.FirstName, count, diceToString(d), turnMsg(g)), keyboard(g))
+	b.updateStatus(g, fmt.Sprintf("%v bid %v %vs. %v", name, bid.Count, b.diceText(g.Rules, bid.Dice), turnMsg(g)))
+	return nil
 }
 
-func (b *Bot) onChallengeCmd(params []string, msg telegram.Message) {
-	g, gameFound := b.games[msg.Chat.ID]
-	if !gameFound {
-		b.telegram.SendMessage(msg.Chat.ID, "No game started in this chat")
+func (b *Bot) onChallengeCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
 		return
 	}
 
-	// Collect player hands already before calling ChallengeCurrentBid, because the call rolls new dice for everyone
-	response := ""
-	for _, p := range g.Players {
-		if len(p.Hand) > 0 {
-			response += fmt.Sprintf("%v: %v\n", p.Info.Name, handToString(p.Hand))
-		}
+	e := b.challenge(c.Room, g, c.From.ID)
+	if e != nil {
+		b.send(c.Room.ID, e.Error())
+		return
 	}
-	response += "\n"
+	b.afterMove(c.Room, g)
+}
 
-	r, e := g.ChallengeCurrentBid(msg.From.ID)
+func (b *Bot) onExactCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	e := b.callExact(c.Room, g, c.From.ID)
 	if e != nil {
-		b.telegram.SendMessage(msg.Chat.ID, e.Error())
+		b.send(c.Room.ID, e.Error())
 		return
 	}
+	b.afterMove(c.Room, g)
+}
+
+// Challenge the current bid and announce the result in the chat
+func (b *Bot) challenge(room Room, g *Game, playerID int) error {
+	return b.endRound(room, g, func() (ChallengeResult, error) { return g.ChallengeCurrentBid(playerID) })
+}
 
-	winner := ""
+// Call the current bid exact and announce the result in the chat
+func (b *Bot) callExact(room Room, g *Game, playerID int) error {
+	return b.endRound(room, g, func() (ChallengeResult, error) { return g.CallExact(playerID) })
+}
+
+// Make the message revealing the hands of a round and the salts of their commitments
+func (b *Bot) revealedHandsMsg(r revealedRound) string {
+	msg := ""
+	for _, p := range r.Players {
+		msg += fmt.Sprintf("%v: %v", p.Info.Name, b.handText(r.Rules, p.Hand))
+		if salt, found := r.Salts[p.Info.ID]; found {
+			msg += fmt.Sprintf(" (salt %v)", salt)
+		}
+		msg += "\n"
+	}
+	msg += fmt.Sprintf("Send %v command followed by the commitments posted when the round started to check them against the hands.\n\n", verifyCmd)
+	return msg
+}
+
+// End the round with call, revealing the hands and announcing the result in the chat
+func (b *Bot) endRound(room Room, g *Game, call func() (ChallengeResult, error)) error {
+	// Collect player hands already before making the call, because the call rolls new dice for everyone
+	revealed := revealRound(g)
+	response := b.revealedHandsMsg(revealed)
+
+	r, e := call()
+	if e != nil {
+		return e
+	}
+	b.closeStatus(g)
+	b.setRevealedRound(revealed)
+	b.updateStats(room.ID, func(stats map[int]PlayerStats) { recordChallenge(stats, g, r) })
 
 	switch r.Result {
 	case LOW_BID:
 		response += fmt.Sprintf("%v's bid was good. %v loses %v dice.", r.Bidder.Name, r.Challenger.Name, r.LostDiceCount)
-		winner = r.Bidder.Name
 	case EXACT_BID:
-		response += fmt.Sprintf("%v's bid was exactly right! Everyone else loses %v dice.", r.Bidder.Name, r.LostDiceCount)
-		winner = r.Bidder.Name
+		if g.Rules.Exact == CHALLENGER_LOSES_ONE {
+			response += fmt.Sprintf("%v's bid was exactly right! %v loses %v dice.", r.Bidder.Name, r.Challenger.Name, r.LostDiceCount)
+		} else {
+			response += fmt.Sprintf("%v's bid was exactly right! Everyone else loses %v dice.", r.Bidder.Name, r.LostDiceCount)
+		}
 	case HIGH_BID:
 		response += fmt.Sprintf("%v's bid was too high. %v loses %v dice.", r.Bidder.Name, r.Bidder.Name, r.LostDiceCount)
-		winner = r.Challenger.Name
+	case EXACT_CALL_WON:
+		if r.GainedDiceCount > 0 {
+			response += fmt.Sprintf("%v called %v's bid exact and was right! %v gets back %v dice.", r.Challenger.Name, r.Bidder.Name, r.Challenger.Name, r.GainedDiceCount)
+		} else {
+			response += fmt.Sprintf("%v called %v's bid exact and was right! %v already has all the dice.", r.Challenger.Name, r.Bidder.Name, r.Challenger.Name)
+		}
+	case EXACT_CALL_LOST:
+		response += fmt.Sprintf("%v called %v's bid exact but was wrong. %v loses %v dice.", r.Challenger.Name, r.Bidder.Name, r.Challenger.Name, r.LostDiceCount)
 	}
 
 	response += "\n\n"
@@ -175,47 +681,685 @@ func (b *Bot) onChallengeCmd(params []string, msg telegram.Message) {
 
 	switch g.State {
 	case STARTED:
-		response += fmt.Sprintf("Starting next round. %v", turnMsg(g))
-		b.beginRound(&msg.Chat, g, response)
+		if g.Palifico {
+			response += fmt.Sprintf("%v has one dice left, so the next round is palifico: 1s aren't wild and the face of the first bid can't be changed. ", g.Players[g.TurnIdx].Info.Name)
+		}
+		response += "Starting next round."
+		b.beginRound(room, g, response)
 	case FINISHED:
-		response += fmt.Sprintf("Game finished! %v is the winner!", winner)
-		b.finishGame(msg.Chat.ID, response)
+		b.gameFinished(g, response)
+	}
+	return nil
+}
+
+func (b *Bot) onAddBotCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	difficulty := NORMAL
+	if len(c.Args) > 0 {
+		difficulty = c.Args[0]
+	}
+
+	// Computer-controlled players get negative IDs so that they can't clash with Telegram user IDs
+	n := len(g.AIPlayers) + 1
+	p := PlayerInfo{ID: -n, Name: fmt.Sprintf("Bot %v (%v)", n, difficulty)}
+	err = g.AddAIPlayer(p, difficulty)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	b.send(c.Room.ID, b.gameText(g, fmt.Sprintf("%v joined", p.Name)))
+}
+
+func (b *Bot) onTimeoutCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	usage := fmt.Sprintf("Send \"%v seconds [challenge|bid|eliminate]\" command to set the time limit for making a move, or \"%v off\" to remove it.", timeoutCmd, timeoutCmd)
+	if len(c.Args) == 0 || len(c.Args) > 2 {
+		b.send(c.Room.ID, usage)
+		return
+	}
+
+	var t TurnTimeout
+	if c.Args[0] != "off" {
+		secs, err := strconv.Atoi(c.Args[0])
+		if err != nil || secs <= 0 {
+			b.send(c.Room.ID, fmt.Sprintf("Invalid time limit: %v", c.Args[0]))
+			return
+		}
+		t.Limit = time.Duration(secs) * time.Second
+		t.Warning = t.Limit / 4
+		if len(c.Args) == 2 {
+			switch c.Args[1] {
+			case "challenge":
+				t.Action = AUTO_CHALLENGE
+			case "bid":
+				t.Action = AUTO_BID
+			case "eliminate":
+				t.Action = ELIMINATE
+			default:
+				b.send(c.Room.ID, usage)
+				return
+			}
+		}
+	}
+
+	err = g.SetTurnTimeout(t)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	if t.Limit > 0 {
+		b.send(c.Room.ID, fmt.Sprintf("Players have %v to make a move. After that I'll %v.", t.Limit, timeoutActionString(t.Action)))
+	} else {
+		b.send(c.Room.ID, "Players have unlimited time to make a move.")
+	}
+}
+
+func (b *Bot) onRulesCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	if len(c.Args) == 0 {
+		response := fmt.Sprintf("Rules: %v.", g.Rules)
+		response += "\n\n"
+		response += fmt.Sprintf("Before the game begins, change the rules with \"%v rule value\" command. The rules are:\n", rulesCmd)
+		response += "variant: classic or perudo. Perudo has six-sided dice with wild 1s, and only the number of dice can be changed.\n"
+		response += "dice: number of dice per player\n"
+		response += fmt.Sprintf("faces: number of faces on a dice, %v-%v\n", MIN_FACES, MAX_FACES)
+		response += "wilds: on or off\n"
+		response += "loss: difference or one, how many dice the loser of a challenge loses\n"
+		response += "exact: others or challenger, who loses when the bid was exactly right"
+		b.send(c.Room.ID, response)
+		return
+	}
+
+	if len(c.Args)%2 != 0 {
+		b.send(c.Room.ID, fmt.Sprintf("Send \"%v rule value\" command to change a rule.", rulesCmd))
+		return
+	}
+
+	r, err := g.Rules.Apply(c.Args)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	err = g.SetRules(r)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	b.send(c.Room.ID, fmt.Sprintf("Rules: %v.", g.Rules))
+}
+
+// Send the player in turn the odds of the current bid and of the moves in the status message buttons
+func (b *Bot) onOddsCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	if g.State != STARTED {
+		b.send(c.Room.ID, "Game not started")
+		return
+	}
+	p := g.Players[g.TurnIdx].Info
+	if p.ID != c.From.ID {
+		b.send(c.Room.ID, fmt.Sprintf("It's %v's turn", p.Name))
+		return
+	}
+
+	b.sendPrivate(p.ID, b.oddsMsg(g, c.Room.Title))
+	b.send(c.Room.ID, fmt.Sprintf("Sent the odds to %v", p.Name))
+}
+
+// List the odds of the moves the player in turn can make
+func (b *Bot) oddsMsg(g *Game, roomTitle string) string {
+	roomTitle = gameTitle(g, roomTitle)
+	v := aiView(g, g.TurnIdx)
+	odds := func(count int, face Dice) float64 {
+		return BidOdds(v.Rules, v.Palifico, v.Hand, v.unknownDice(), count, face)
+	}
+
+	msg := fmt.Sprintf("Odds in %v with your hand %v and %v other dice:", roomTitle, b.handText(g.Rules, v.Hand), v.unknownDice())
+	if g.CurrentBid.Count > 0 {
+		msg += fmt.Sprintf("\nCurrent bid %v %v is good: %v", g.CurrentBid.Count, b.diceText(g.Rules, g.CurrentBid.Dice), percent(odds(g.CurrentBid.Count, g.CurrentBid.Dice)))
+	}
+	for _, row := range keyboard(g) {
+		for _, button := range row {
+			params := strings.Split(button.Data, " ")
+			c := g.CurrentBid
+			switch params[0] {
+			case bidCallback:
+				bid, err := callbackDataToBid(params[1:])
+				if err == nil {
+					msg += fmt.Sprintf("\n%v: %v", button.Text, percent(odds(bid.Count, bid.Dice)))
+				}
+			case challengeCallback:
+				msg += fmt.Sprintf("\n%v wins: %v", button.Text, percent(1-odds(c.Count, c.Dice)))
+			case exactCallback:
+				msg += fmt.Sprintf("\n%v wins: %v", button.Text, percent(odds(c.Count, c.Dice)-odds(c.Count+1, c.Dice)))
+			}
+		}
+	}
+	return msg
+}
+
+// Start or stop watching the game. Spectators get the hands of all the players as private messages every round.
+func (b *Bot) onWatchCmd(c Command) {
+	off := len(c.Args) > 0 && c.Args[0] == "off"
+	name := c.Args
+	if off {
+		name = c.Args[1:]
+	}
+	g, err := b.chatGame(c.Room.ID, c.From.ID, strings.Join(name, " "))
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	if off {
+		if err := g.RemoveSpectator(c.From.ID); err != nil {
+			b.send(c.Room.ID, err.Error())
+			return
+		}
+		b.send(c.Room.ID, b.gameText(g, fmt.Sprintf("%v stopped watching the game", c.From.Name)))
+		return
+	}
+
+	if err := g.AddSpectator(PlayerInfo{ID: c.From.ID, Name: c.From.Name}); err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	b.send(c.Room.ID, b.gameText(g, fmt.Sprintf("%v is watching the game and gets everyone's hands as private messages. Send \"%v off\" command to stop watching.", c.From.Name, watchCmd)))
+	if g.State == STARTED {
+		b.sendPrivate(c.From.ID, b.spectatorHandsMsg(g, gameTitle(g, c.Room.Title)))
+	}
+}
+
+// Check the hands of the last ended round of each table against the commitments made when the round started
+func (b *Bot) onVerifyCmd(c Command) {
+	rounds := b.chatRevealedRounds(c.Room.ID)
+	if len(rounds) == 0 {
+		b.send(c.Room.ID, "No hands have been revealed in this chat yet")
+		return
+	}
+	// The tables are named only when the chat has had several
+	roundName := func(r revealedRound) string {
+		if len(rounds) > 1 {
+			return fmt.Sprintf("the last round at %v", r.Table)
+		}
+		return "the last round"
+	}
+
+	// Check the commitments given as arguments, copied from the message posted when the round started. Each hash
+	// identifies its hand, so all the tables are searched.
+	if len(c.Args) > 0 {
+		response := "Commitments checked against the hands of the last round:\n"
+		if len(rounds) > 1 {
+			response = "Commitments checked against the hands of the last round at each table:\n"
+		}
+		for _, hash := range c.Args {
+			matched := false
+			for _, r := range rounds {
+				if p, found := r.find(hash); found {
+					response += fmt.Sprintf("%v matches %v's hand %v", hash, p.Info.Name, b.handText(r.Rules, p.Hand))
+					if len(rounds) > 1 {
+						response += fmt.Sprintf(" at %v", r.Table)
+					}
+					response += " ✅\n"
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				response += fmt.Sprintf("%v DOESN'T match any hand ❌\n", hash)
+			}
+		}
+		b.send(c.Room.ID, response)
+		return
+	}
+
+	response := ""
+	for _, r := range rounds {
+		response += fmt.Sprintf("Hashes of the hands of %v, computed from the revealed salts:\n", roundName(r))
+		for _, p := range r.Players {
+			if hash := r.hash(p); hash != "" {
+				response += fmt.Sprintf("%v: %v %v\n", p.Info.Name, b.handText(r.Rules, p.Hand), hash)
+			} else {
+				response += fmt.Sprintf("%v: %v, no commitment\n", p.Info.Name, b.handText(r.Rules, p.Hand))
+			}
+		}
+		response += "\n"
+	}
+	response += fmt.Sprintf("Each hash is the SHA-256 hash of the salt, a colon and the faces of the hand, e.g. \"0f1e:%v\". ", handFaces(rounds[0].Rules, []Dice{WILD, ONE, ONE, TWO}))
+	response += fmt.Sprintf("Compare them with the commitments posted when the round started, or send %v command followed by the commitments to check them.", verifyCmd)
+	b.send(c.Room.ID, response)
+}
+
+// Show the stats of the sender, or of the player given as a parameter, in the current chat
+func (b *Bot) onStatsCmd(c Command) {
+	stats, err := b.loadStats(c.Room.ID)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	s, found := stats[c.From.ID]
+	if len(c.Args) > 0 {
+		s, found = findPlayerStats(stats, c.Args[0])
+	}
+	if !found || s.GamesPlayed+s.Challenges+s.BidsChallenged == 0 {
+		who := c.From.Name
+		if len(c.Args) > 0 {
+			who = c.Args[0]
+		}
+		b.send(c.Room.ID, fmt.Sprintf("No stats for %v in this chat yet", who))
+		return
+	}
+
+	response := fmt.Sprintf("Stats of %v in this chat:\n", s.Name)
+	response += fmt.Sprintf("Games played: %v, won: %v (%v)\n", s.GamesPlayed, s.GamesWon, percent(s.WinRate()))
+	if s.GamesPlayed > 0 {
+		response += fmt.Sprintf("Average finishing place: %.1f\n", s.AveragePlace())
+	}
+	response += fmt.Sprintf("Challenges made: %v, right: %v (%v)\n", s.Challenges, s.ChallengesWon, percent(s.ChallengeSuccessRate()))
+	response += fmt.Sprintf("Bids challenged: %v, held: %v (%v)\n", s.BidsChallenged, s.BidsHeld, percent(s.BidHoldRate()))
+	response += fmt.Sprintf("Exactly right bids: %v", s.ExactBids)
+	b.send(c.Room.ID, response)
+}
+
+// Show the players of the current chat ranked by their wins
+func (b *Bot) onLeaderboardCmd(c Command) {
+	stats, err := b.loadStats(c.Room.ID)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	board := leaderboard(stats)
+	if len(board) == 0 {
+		b.send(c.Room.ID, "No games have been finished in this chat yet")
+		return
+	}
+	response := "Leaderboard:"
+	for i, s := range board {
+		if i == leaderboardSize {
+			break
+		}
+		response += fmt.Sprintf("\n%v. %v: %v wins in %v games (%v), average place %.1f", i+1, s.Name, s.GamesWon, s.GamesPlayed, percent(s.WinRate()), s.AveragePlace())
+	}
+	b.send(c.Room.ID, response)
+}
+
+// Show the ratings of the players of the current chat, or the ratings of the player given as a parameter
+func (b *Bot) onRatingCmd(c Command) {
+	stats, err := b.loadStats(c.Room.ID)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	if len(c.Args) == 0 {
+		b.send(c.Room.ID, ratingListMsg(stats))
+		return
+	}
+	global, err := b.loadGlobalStats()
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	for id, s := range stats {
+		if matchesPlayer(s, c.Args[0]) && s.RatedGames > 0 {
+			g := global[id]
+			response := fmt.Sprintf("%v has rating %.0f in this chat after %v games", s.Name, s.Rating, s.RatedGames)
+			response += fmt.Sprintf(", and %.0f in all chats after %v games.", g.rating(), g.RatedGames)
+			b.send(c.Room.ID, response)
+			return
+		}
+	}
+	b.send(c.Room.ID, fmt.Sprintf("No rated games for %v in this chat yet", c.Args[0]))
+}
+
+// Seat the players of a game by their ratings in the chat, the highest rated first
+func (b *Bot) onSeedCmd(c Command) {
+	g, err := b.chatGame(c.Room.ID, c.From.ID, "")
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+	stats, err := b.loadStats(c.Room.ID)
+	if err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	infos := make([]PlayerInfo, len(g.Players))
+	for i, p := range g.Players {
+		infos[i] = p.Info
+	}
+	seeded := SeedByRating(infos, stats)
+	if err := g.SetPlayerOrder(seeded); err != nil {
+		b.send(c.Room.ID, err.Error())
+		return
+	}
+
+	response := "Players seeded by their ratings in this chat:"
+	for i, p := range seeded {
+		response += fmt.Sprintf("\n%v. %v: %.0f", i+1, p.Name, stats[p.ID].rating())
+	}
+	b.send(c.Room.ID, b.gameText(g, response))
+}
+
+func ratingListMsg(stats map[int]PlayerStats) string {
+	list := ratingList(stats)
+	if len(list) == 0 {
+		return "No rated games in this chat yet. Games with at least two human players are rated."
+	}
+	msg := "Ratings in this chat:"
+	for i, s := range list {
+		if i == leaderboardSize {
+			break
+		}
+		msg += fmt.Sprintf("\n%v. %v: %.0f (%v games)", i+1, s.Name, s.Rating, s.RatedGames)
+	}
+	return msg
+}
+
+// Remember the name and the username of a user in the stats, so that the user can be found by them
+func rememberUser(stats map[int]PlayerStats, u User) {
+	s := stats[u.ID]
+	s.Name = u.Name
+	if u.Username != "" {
+		s.Username = u.Username
+	}
+	stats[u.ID] = s
+}
+
+// Find the stats of a player by @username or name
+func findPlayerStats(stats map[int]PlayerStats, name string) (PlayerStats, bool) {
+	for _, s := range stats {
+		if matchesPlayer(s, name) {
+			return s, true
+		}
 	}
+	return PlayerStats{}, false
 }
 
-func (b *Bot) startGame(chatId int, msg string) {
-	b.games[chatId] = &Game{}
-	b.telegram.SendMessage(chatId, msg)
+// Is name the @username or the name of the player?
+func matchesPlayer(s PlayerStats, name string) bool {
+	name = strings.TrimPrefix(name, "@")
+	return (s.Username != "" && strings.EqualFold(s.Username, name)) || strings.EqualFold(s.Name, name)
 }
 
-func (b *Bot) finishGame(chatId int, msg string) {
-	b.telegram.SendMessageAndRemoveCustomKeyboard(chatId, msg)
-	delete(b.games, chatId)
+func percent(x float64) string {
+	return fmt.Sprintf("%.0f%%", 100*x)
 }
 
-func (b *Bot) beginRound(chat *telegram.Chat, g *Game, msg string) {
-	b.telegram.SendMessageAndDisplayCustomKeyboard(chat.ID, msg, keyboard(g))
-	b.sendHands(g, chat.Title)
+// Let the game continue after a move: computer-controlled players make their moves, and the turn timer starts
+// for the next human player
+func (b *Bot) afterMove(room Room, g *Game) {
+	b.playAITurns(room, g)
+	b.startTurnTimer(room, g)
 }
 
-func (b *Bot) sendHands(g *Game, chatname *string) {
-	var cn string
-	if chatname != nil {
-		cn = *chatname
+// Make moves for computer-controlled players for as long as it's their turn
+func (b *Bot) playAITurns(room Room, g *Game) {
+	for g.State == STARTED && g.IsAI(g.Players[g.TurnIdx].Info.ID) {
+		p := g.Players[g.TurnIdx].Info
+		m, err := g.AIMove()
+		if err == nil {
+			if m.Challenge {
+				err = b.challenge(room, g, p.ID)
+			} else {
+				err = b.bid(room, g, p.Name, m.Bid)
+			}
+		}
+
+		if err != nil {
+			b.log().Warn("Invalid move from computer player", "game_id", g.ID, "name", p.Name, "err", err)
+			if err = b.fallbackMove(room, g, p); err != nil {
+				// Leave the game as it is rather than trying the same moves forever
+				b.log().Error("Computer player can't move", "game_id", g.ID, "name", p.Name, "err", err)
+				return
+			}
+		}
 	}
+}
+
+// Make a move for a computer player whose own move was rejected: the minimal raise, or if even that is rejected, a
+// challenge, or finally leaving the game
+func (b *Bot) fallbackMove(room Room, g *Game, p PlayerInfo) error {
+	bid := nextValidBid(g.engine(), g.CurrentBid)
+	bid.PlayerID = p.ID
+	err := b.bid(room, g, p.Name, bid)
+	if err != nil && g.CurrentBid.Count > 0 {
+		err = b.challenge(room, g, p.ID)
+	}
+	if err != nil {
+		err = b.eliminate(room, g, p)
+	}
+	return err
+}
+
+func (b *Bot) startGame(g *Game, msg string) {
+	b.attachEventSink(g)
+	b.setGame(g)
+	b.send(g.ChatID, msg)
+}
+
+// Make a new random game ID. The IDs are opaque, so that e.g. a link for joining a game doesn't tell which chat the
+// game is in.
+func newGameID() string {
+	return randomHex(gameIDLength)
+}
+
+// Length of the tokens made by NewToken in bytes
+const tokenLength = 16
+
+// Make a new random token that is hard to guess, e.g. for identifying a player of a game hosted by a server
+func NewToken() string {
+	return randomHex(tokenLength)
+}
+
+// Make n random bytes as a hex string
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Default name of the nth table of a chat
+func tableName(n int) string {
+	return fmt.Sprintf("Table %v", n)
+}
+
+// Mark a message about a game with the game's table if the chat has several games
+func (b *Bot) gameText(g *Game, text string) string {
+	if len(b.chatGames(g.ChatID)) > 1 {
+		return fmt.Sprintf("%v: %v", g.Name, text)
+	}
+	return text
+}
+
+// Name a game in the private messages about it, e.g. "Game night (Table 1)"
+func gameTitle(g *Game, roomTitle string) string {
+	if roomTitle == "" {
+		return g.Name
+	}
+	return fmt.Sprintf("%v (%v)", roomTitle, g.Name)
+}
+
+// Send a message to a room
+func (b *Bot) send(roomID int, text string) {
+	if err := b.messenger.Send(roomID, text); err != nil {
+		b.log().Error("Failed to send message", "room_id", roomID, "err", err)
+	}
+}
+
+// Send a private message to a user
+func (b *Bot) sendPrivate(userID int, text string) {
+	if err := b.messenger.SendPrivate(userID, text); err != nil {
+		b.log().Error("Failed to send private message", "user_id", userID, "err", err)
+	}
+}
+
+// Answer a button press
+func (b *Bot) answer(pressID string, text string) {
+	if err := b.messenger.AnswerPress(pressID, text); err != nil {
+		b.log().Error("Failed to answer button press", "press_id", pressID, "err", err)
+	}
+}
+
+// Announce the winner of a game that has finished and record the game to the player stats
+func (b *Bot) gameFinished(g *Game, msg string) {
+	if w := winner(g.Players); w != nil {
+		msg += fmt.Sprintf("Game finished! %v is the winner!", w.Name)
+	}
+	msg += fmt.Sprintf("\n\nSend %v, %v or %v command to see how everyone has done in this chat.", statsCmd, leaderboardCmd, ratingCmd)
+	b.updateStats(g.ChatID, func(stats map[int]PlayerStats) {
+		recordGame(stats, g)
+		recordRatings(stats, g)
+	})
+	b.updateGlobalStats(func(stats map[int]PlayerStats) { recordRatings(stats, g) })
+	b.finishGame(g, msg)
+}
+
+func (b *Bot) finishGame(g *Game, msg string) {
+	b.closeStatus(g)
+	if err := b.messenger.SendFinal(g.ChatID, b.gameText(g, msg)); err != nil {
+		b.log().Error("Failed to send message", "room_id", g.ChatID, "game_id", g.ID, "err", err)
+	}
+	b.stopTurnTimer(g.ID)
+	b.deleteGame(g)
+}
+
+func (b *Bot) beginRound(room Room, g *Game, msg string) {
+	b.send(room.ID, b.gameText(g, msg+"\n\n"+commitmentsMsg(g)))
+	b.updateStatus(g, turnMsg(g))
+	b.sendHands(g, room.Title)
+}
+
+// Show text and the buttons for the next move in the status message of a game. A new status message is sent if
+// the game doesn't have one yet.
+func (b *Bot) updateStatus(g *Game, text string) {
+	text = b.gameText(g, text)
+	m, found := b.statusMessage(g.ID)
+	if found {
+		if err := b.messenger.Edit(g.ChatID, m.ID, text, keyboard(g)); err != nil {
+			b.log().Error("Failed to edit status message", "game_id", g.ID, "message_id", m.ID, "err", err)
+		}
+	} else {
+		var err error
+		m.ID, err = b.messenger.SendWithButtons(g.ChatID, text, keyboard(g))
+		if err != nil {
+			b.log().Error("Failed to send status message", "game_id", g.ID, "err", err)
+			return
+		}
+	}
+	m.Text = text
+	b.setStatusMessage(g.ID, m)
+}
+
+// Remove the buttons from the status message of a game. The next status message is sent as a new message.
+func (b *Bot) closeStatus(g *Game) {
+	if m, found := b.statusMessage(g.ID); found {
+		if err := b.messenger.Edit(g.ChatID, m.ID, m.Text, nil); err != nil {
+			b.log().Error("Failed to edit status message", "game_id", g.ID, "message_id", m.ID, "err", err)
+		}
+		b.deleteStatusMessage(g.ID)
+	}
+}
+
+func (b *Bot) sendHands(g *Game, roomTitle string) {
+	roomTitle = gameTitle(g, roomTitle)
+	for _, p := range g.Players {
+		// Players who are out of the game have no hand to send
+		if g.IsAI(p.Info.ID) || len(p.Hand) == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("Your %v hand in %v:\n%v", gameName, roomTitle, b.handText(g.Rules, p.Hand))
+		if c, found := commitment(g.Commitments, p.Info.ID); found {
+			msg += fmt.Sprintf("\n\nCommitment: %v", c.Hash)
+		}
+		b.sendPrivate(p.Info.ID, msg)
+	}
+	if len(g.Spectators) > 0 {
+		msg := b.spectatorHandsMsg(g, roomTitle)
+		for _, s := range g.Spectators {
+			b.sendPrivate(s.ID, msg)
+		}
+	}
+}
+
+// List the commitments to the hands of all the players still in the game, computer-controlled players included
+func commitmentsMsg(g *Game) string {
+	msg := "Commitments to the hands of this round:"
+	for _, p := range g.Players {
+		if c, found := commitment(g.Commitments, p.Info.ID); found {
+			msg += fmt.Sprintf("\n%v: %v", p.Info.Name, c.Hash)
+		}
+	}
+	return msg
+}
+
+// List the hands of all the players still in the game. title names the game.
+func (b *Bot) spectatorHandsMsg(g *Game, title string) string {
+	msg := fmt.Sprintf("%v hands in %v:", gameName, title)
 	for _, p := range g.Players {
-		b.telegram.SendMessage(p.Info.ID, fmt.Sprintf("Your %v hand in %v:\n%v", gameName, cn, handToString(p.Hand)))
+		if len(p.Hand) > 0 {
+			msg += fmt.Sprintf("\n%v: %v", p.Info.Name, b.handText(g.Rules, p.Hand))
+		}
 	}
+	return msg
 }
 
 const gameName = "Bluff"
 
 const startCmd = "/start"
+const joinCmd = "/join"
 const stopCmd = "/stop"
 const beginCmd = "/begin"
 const bidCmd = "/bid"
 const challengeCmd = "/challenge"
-const bidButtonText = "Bid"
+const exactCmd = "/exact"
+const addBotCmd = "/addbot"
+const timeoutCmd = "/timeout"
+const rulesCmd = "/rules"
+const verifyCmd = "/verify"
+const statsCmd = "/stats"
+const leaderboardCmd = "/leaderboard"
+const ratingCmd = "/rating"
+const seedCmd = "/seed"
+const oddsCmd = "/odds"
+const watchCmd = "/watch"
+const challengeButtonText = "Challenge"
+const exactButtonText = "Exact"
+
+// Callback data of inline keyboard buttons
+const bidCallback = "bid"
+const challengeCallback = "challenge"
+const exactCallback = "exact"
+
+// Length of the game IDs in bytes
+const gameIDLength = 6
+
+// Number of players shown in the leaderboard
+const leaderboardSize = 10
 
 func gameStatusMsg(g *Game) string {
 	msg := "Game status:"
@@ -247,6 +1391,10 @@ func diceToString(d Dice) string {
 	case FIVE:
 		return "5️⃣"
 	}
+	// Keycap emoji for the faces of dice with more than six faces
+	if d > FIVE && d <= 9 {
+		return strconv.Itoa(int(d)) + "\uFE0F\u20E3"
+	}
 	return "?"
 }
 
@@ -264,36 +1412,85 @@ func stringToDice(s string) (Dice, error) {
 		return FOUR, nil
 	case "5", diceToString(FIVE):
 		return FIVE, nil
-	default:
-		return WILD, fmt.Errorf("Unknown dice: %v", s)
 	}
+	for d := FIVE + 1; d <= 9; d++ {
+		if s == strconv.Itoa(int(d)) || s == diceToString(d) {
+			return d, nil
+		}
+	}
+	return WILD, fmt.Errorf("Unknown dice: %v", s)
 }
 
-func handToString(hand []Dice) string {
+func handToString(r Rules, hand []Dice) string {
 	s := ""
 	for _, d := range hand {
-		s += diceToString(d)
+		s += r.diceString(d)
 	}
 	return s
 }
 
-func keyboard(g *Game) [][]string {
-	b := g.CurrentBid
-	kb := make([][]string, 4)
+// Show a dice as emoji, or as a plain face if the messenger can't show emoji
+func (b *Bot) diceText(r Rules, d Dice) string {
+	if b.messenger.Emoji() {
+		return r.diceString(d)
+	}
+	return r.FaceName(d)
+}
+
+// Show a hand as emoji, or as plain faces separated by spaces if the messenger can't show emoji
+func (b *Bot) handText(r Rules, hand []Dice) string {
+	if b.messenger.Emoji() {
+		return handToString(r, hand)
+	}
+	faces := make([]string, len(hand))
+	for i, d := range hand {
+		faces[i] = r.FaceName(d)
+	}
+	return strings.Join(faces, " ")
+}
+
+func keyboard(g *Game) [][]Button {
+	bids := g.ValidBids(16)
+	kb := make([][]Button, 4)
 	for row := range kb {
-		kb[row] = make([]string, 4)
+		kb[row] = make([]Button, 4)
 		for col := range kb[row] {
-			b = nextBid(b)
-			kb[row][col] = bidButton(b)
+			kb[row][col] = bidButton(g.Rules, bids[4*row+col])
 		}
 	}
+	if g.CurrentBid.Count > 0 {
+		kb = append(kb, []Button{
+			{Text: challengeButtonText, Data: challengeCallback},
+			{Text: exactButtonText, Data: exactCallback}})
+	}
 	return kb
 }
 
-func bidButton(b Bid) string {
-	return fmt.Sprintf("%v %v %v", bidButtonText, b.Count, diceToString(b.Dice))
+func bidButton(r Rules, b Bid) Button {
+	return Button{
+		Text: fmt.Sprintf("%v %v", b.Count, r.diceString(b.Dice)),
+		Data: fmt.Sprintf("%v %v %v", bidCallback, b.Count, diceToCallbackData(b.Dice))}
 }
 
-func nextBid(b Bid) Bid {
-	return bidFromScore(b.score() + 1)
+func diceToCallbackData(d Dice) string {
+	if d == WILD {
+		return "*"
+	}
+	return strconv.Itoa(int(d))
+}
+
+// Parse the count and dice of a bid button's callback data
+func callbackDataToBid(params []string) (Bid, error) {
+	if len(params) != 2 {
+		return Bid{}, fmt.Errorf("Invalid bid")
+	}
+	count, err := strconv.Atoi(params[0])
+	if err != nil {
+		return Bid{}, fmt.Errorf("Invalid count: %v", params[0])
+	}
+	d, err := stringToDice(params[1])
+	if err != nil {
+		return Bid{}, err
+	}
+	return Bid{Dice: d, Count: count}, nil
 }
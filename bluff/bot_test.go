@@ -0,0 +1,466 @@
+package bluff
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+type sentMessage struct {
+	ChatID   int
+	Text     string
+	Keyboard [][]telegram.InlineKeyboardButton
+}
+
+// msgRecorder is a telegram.MsgSender recording all sent messages. Edited messages are replaced in place.
+type msgRecorder struct {
+	mutex    sync.Mutex
+	messages []sentMessage
+	// Answers to callback queries, keyed by query ID
+	answers map[string]string
+}
+
+func (r *msgRecorder) SendMessage(chatid int, text string) error {
+	_, err := r.SendMessageWithInlineKeyboard(chatid, text, nil)
+	return err
+}
+
+func (r *msgRecorder) SendMessageAndRemoveCustomKeyboard(chatid int, text string) error {
+	return r.SendMessage(chatid, text)
+}
+
+// Message IDs are indices to messages
+func (r *msgRecorder) SendMessageWithInlineKeyboard(chatid int, text string, kb [][]telegram.InlineKeyboardButton) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.messages = append(r.messages, sentMessage{chatid, text, kb})
+	return len(r.messages) - 1, nil
+}
+
+func (r *msgRecorder) EditMessageText(chatid int, messageid int, text string, kb [][]telegram.InlineKeyboardButton) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.messages[messageid] = sentMessage{chatid, text, kb}
+	return nil
+}
+
+func (r *msgRecorder) AnswerCallbackQuery(queryid string, text string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.answers == nil {
+		r.answers = make(map[string]string)
+	}
+	r.answers[queryid] = text
+	return nil
+}
+
+// Count messages sent to a chat starting with prefix
+func (r *msgRecorder) count(chatid int, prefix string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	n := 0
+	for _, m := range r.messages {
+		if m.ChatID == chatid && strings.HasPrefix(m.Text, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// Make an update for a message sent by user to chat
+func update(chatID int, user telegram.User, text string) telegram.Update {
+	return telegram.Update{Message: &telegram.Message{Chat: telegram.Chat{ID: chatID}, From: &user, Text: &text}}
+}
+
+func TestConcurrentStartInSameChat(t *testing.T) {
+	var r msgRecorder
+	tg, _ := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tg.HandleUpdate(update(-100, alice, startCmd))
+		}()
+	}
+	wg.Wait()
+
+	if r.count(-100, "Starting a new game") != 1 {
+		t.Fail()
+	}
+	if r.count(-100, "There's already a game started") != 49 {
+		t.Fail()
+	}
+}
+
+func TestConcurrentJoinsToSameGame(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	tg.HandleUpdate(update(-100, telegram.User{ID: 1, FirstName: "Alice"}, startCmd))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			u := telegram.User{ID: id, FirstName: fmt.Sprintf("P%v", id)}
+			tg.HandleUpdate(update(id, u, joinText(b, -100)))
+		}(i + 1)
+	}
+	wg.Wait()
+
+	g, found := onlyGame(b, -100)
+	if !found {
+		t.FailNow()
+	}
+	if len(g.Players) != 50 {
+		t.Fail()
+	}
+}
+
+func TestConcurrentGamesInDifferentChats(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(chatID int) {
+			defer wg.Done()
+			alice := telegram.User{ID: chatID*10 + 1, FirstName: "Alice"}
+			bob := telegram.User{ID: chatID*10 + 2, FirstName: "Bob"}
+			tg.HandleUpdate(update(-chatID, alice, startCmd))
+			tg.HandleUpdate(update(alice.ID, alice, joinText(b, -chatID)))
+			tg.HandleUpdate(update(bob.ID, bob, joinText(b, -chatID)))
+			tg.HandleUpdate(update(-chatID, alice, beginCmd))
+			tg.HandleUpdate(update(-chatID, alice, bidCmd+" 1 3"))
+			tg.HandleUpdate(update(-chatID, bob, bidCmd+" 2 3"))
+			tg.HandleUpdate(update(-chatID, alice, bidCmd+" 3 3"))
+		}(i + 1)
+	}
+
+	// Hammer the same chats with concurrent stray commands
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(chatID int) {
+			defer wg.Done()
+			carl := telegram.User{ID: chatID*10 + 3, FirstName: "Carl"}
+			for j := 0; j < 10; j++ {
+				tg.HandleUpdate(update(-chatID, carl, challengeCmd))
+				tg.HandleUpdate(update(-chatID, carl, bidCmd+" 9 5"))
+			}
+		}(i + 1)
+	}
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		g, found := onlyGame(b, -(i + 1))
+		if !found {
+			t.FailNow()
+		}
+		if g.State != STARTED || len(g.Players) != 2 {
+			t.Fail()
+		}
+		if g.CurrentBid != (Bid{PlayerID: (i+1)*10 + 1, Dice: THREE, Count: 3}) {
+			t.Fail()
+		}
+		if g.TurnIdx != 1 {
+			t.Fail()
+		}
+	}
+}
+
+func TestSeveralGamesInChat(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	users := make([]telegram.User, 5)
+	for i, name := range []string{"Alice", "Bob", "Carol", "Dave", "Eve"} {
+		users[i] = telegram.User{ID: i + 1, FirstName: name}
+	}
+	alice, bob, carol, dave, eve := users[0], users[1], users[2], users[3], users[4]
+
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(-100, carol, startCmd))
+	tg.HandleUpdate(update(-100, carol, startCmd+" High rollers"))
+	tg.HandleUpdate(update(-100, dave, startCmd+" high ROLLERS"))
+	if r.count(-100, "There's already a game started in this chat. Send \"/start name\"") != 1 ||
+		r.count(-100, "Starting a new game of Bluff at High rollers!") != 1 ||
+		r.count(-100, "There's already a game at High rollers in this chat") != 1 {
+		t.Error(r.messages)
+	}
+	table1, err1 := b.chatGame(-100, 0, "Table 1")
+	table2, err2 := b.chatGame(-100, 0, "high rollers")
+	if err1 != nil || err2 != nil || table1.ID == table2.ID || strings.Contains(table1.ID, "100") {
+		t.Fatal(err1, err2)
+	}
+
+	tg.HandleUpdate(update(alice.ID, alice, startCmd+" "+table1.ID))
+	tg.HandleUpdate(update(bob.ID, bob, startCmd+" "+table1.ID))
+	tg.HandleUpdate(update(carol.ID, carol, startCmd+" "+table2.ID))
+	tg.HandleUpdate(update(dave.ID, dave, startCmd+" "+table2.ID))
+	tg.HandleUpdate(update(alice.ID, alice, startCmd+" "+table2.ID))
+	if r.count(-100, "Table 1: Bob joined") != 1 || r.count(-100, "High rollers: Dave joined") != 1 || r.count(alice.ID, "You're already playing at Table 1") != 1 {
+		t.Error(r.messages)
+	}
+
+	// The commands of the players go to their own games
+	tg.HandleUpdate(update(-100, eve, beginCmd))
+	if r.count(-100, "There are several games in this chat, at High rollers, Table 1. Join one of them first.") != 1 {
+		t.Error(r.messages)
+	}
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" dice 1"))
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	tg.HandleUpdate(update(-100, carol, beginCmd))
+	if table1.Rules.DicePerPlayer != 1 || table2.Rules.DicePerPlayer != 0 || table1.State != STARTED || table2.State != STARTED {
+		t.Error(table1, table2)
+	}
+	if r.count(alice.ID, "Your Bluff hand in Table 1:") != 1 || r.count(dave.ID, "Your Bluff hand in High rollers:") != 1 {
+		t.Error(r.messages)
+	}
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 1 3"))
+	if table1.CurrentBid.Count != 1 || table2.CurrentBid.Count != 0 {
+		t.Error(table1.CurrentBid, table2.CurrentBid)
+	}
+
+	// The buttons of a status message make moves in its game
+	m, _ := b.statusMessage(table2.ID)
+	tg.HandleUpdate(callback(-100, m.ID, carol, "q1", "bid 2 4"))
+	if table2.CurrentBid != (Bid{carol.ID, FOUR, 2}) || r.count(-100, "High rollers: Carol bid 2") != 1 {
+		t.Error(table2.CurrentBid)
+	}
+
+	tg.HandleUpdate(update(-100, eve, watchCmd+" High rollers"))
+	tg.HandleUpdate(update(-100, carol, stopCmd))
+	if g, found := onlyGame(b, -100); !found || g != table1 {
+		t.Error(g)
+	}
+	if !table2.IsSpectator(eve.ID) || r.count(-100, "High rollers: Game ended") != 1 {
+		t.Error(table2.Spectators)
+	}
+}
+
+// failingStore is a GameStore failing to save games
+type failingStore struct {
+	*MemoryStore
+}
+
+func (failingStore) SaveGame(id string, g *Game) error {
+	return &GameError{"Disk full"}
+}
+
+func TestBotLogsFailures(t *testing.T) {
+	var r msgRecorder
+	var log bytes.Buffer
+	tg, _ := newTelegram("bluffbot", &r, failingStore{NewMemoryStore()})
+	b := tg.Bot()
+	b.SetLogger(slog.New(slog.NewTextHandler(&log, nil)))
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+
+	g, _ := onlyGame(b, -100)
+	if !strings.Contains(log.String(), "level=ERROR msg=\"Failed to store game\" game_id="+g.ID+" err=\"Disk full\"") {
+		t.Error(log.String())
+	}
+}
+
+// Make an update for user pressing an inline keyboard button of message msgID in chat
+func callback(chatID int, msgID int, user telegram.User, queryID string, data string) telegram.Update {
+	return telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:      queryID,
+		From:    user,
+		Message: &telegram.Message{MessageID: msgID, Chat: telegram.Chat{ID: chatID}},
+		Data:    &data}}
+}
+
+// Get the ID of the last message sent to a chat with an inline keyboard
+func (r *msgRecorder) lastKeyboardMessage(chatid int) (int, sentMessage) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := len(r.messages) - 1; i >= 0; i-- {
+		if r.messages[i].ChatID == chatid && r.messages[i].Keyboard != nil {
+			return i, r.messages[i]
+		}
+	}
+	return -1, sentMessage{}
+}
+
+func TestInlineKeyboard(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	g, _ := onlyGame(b, -100)
+	// No twos, so that the challenge below doesn't end the game
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{ONE, THREE, FOUR, FIVE}})
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+
+	statusID, status := r.lastKeyboardMessage(-100)
+	if statusID < 0 || status.Text != "It's Alice's turn." {
+		t.Fatal(status)
+	}
+	// No challenge button before the first bid
+	if len(status.Keyboard) != 4 || status.Keyboard[0][0].CallbackData != "bid 1 1" {
+		t.Error(status.Keyboard)
+	}
+
+	// Bid 1 2s from the second button
+	tg.HandleUpdate(callback(-100, statusID, alice, "q1", status.Keyboard[0][1].CallbackData))
+	if g.CurrentBid != (Bid{alice.ID, TWO, 1}) {
+		t.Error(g.CurrentBid)
+	}
+	if answer, found := r.answers["q1"]; !found || answer != "" {
+		t.Error(r.answers)
+	}
+	id, status := r.lastKeyboardMessage(-100)
+	if id != statusID || !strings.HasPrefix(status.Text, "Alice bid 1 2") {
+		t.Error(id, status)
+	}
+	if len(status.Keyboard) != 5 || status.Keyboard[4][0].CallbackData != challengeCallback || status.Keyboard[4][1].CallbackData != exactCallback {
+		t.Error(status.Keyboard)
+	}
+
+	// Only the player in turn can press the buttons
+	tg.HandleUpdate(callback(-100, statusID, alice, "q2", status.Keyboard[0][0].CallbackData))
+	if r.answers["q2"] != "It's Bob's turn" {
+		t.Error(r.answers)
+	}
+	if g.CurrentBid != (Bid{alice.ID, TWO, 1}) {
+		t.Error(g.CurrentBid)
+	}
+
+	// Challenge ends the round and starts a new status message
+	tg.HandleUpdate(callback(-100, statusID, bob, "q3", challengeCallback))
+	if r.answers["q3"] != "" {
+		t.Error(r.answers)
+	}
+	if r.messages[statusID].Keyboard != nil {
+		t.Error(r.messages[statusID])
+	}
+	if g.CurrentBid.Count != 0 {
+		t.Error(g.CurrentBid)
+	}
+	id, _ = r.lastKeyboardMessage(-100)
+	if id <= statusID {
+		t.Error(id)
+	}
+}
+
+func TestCallbackQueryWithoutGame(t *testing.T) {
+	var r msgRecorder
+	tg, _ := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	tg.HandleUpdate(callback(-100, 0, alice, "q1", challengeCallback))
+	if r.answers["q1"] == "" {
+		t.Error(r.answers)
+	}
+	tg.HandleUpdate(telegram.Update{CallbackQuery: &telegram.CallbackQuery{ID: "q2", From: alice, Data: new(string)}})
+	if r.answers["q2"] == "" {
+		t.Error(r.answers)
+	}
+}
+
+func TestExactCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	g, _ := onlyGame(b, -100)
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{WILD, ONE, ONE, TWO, TWO, ONE, THREE, THREE, FOUR, FIVE}})
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+
+	tg.HandleUpdate(update(-100, alice, exactCmd))
+	if r.count(-100, "No bid has been made yet") != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 4 1"))
+	tg.HandleUpdate(update(-100, bob, exactCmd))
+	if r.count(-100, "Alice: *️⃣1️⃣1️⃣2️⃣2️⃣ (salt ") != 1 {
+		t.Error(r.messages)
+	}
+	found := false
+	for _, m := range r.messages {
+		if strings.Contains(m.Text, "\n\nBob called Alice's bid exact and was right! Bob already has all the dice.") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error(r.messages)
+	}
+	if g.TurnIdx != 1 || g.CurrentBid.Count != 0 {
+		t.Error(g)
+	}
+}
+
+func TestOddsCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" dice 1"))
+	g, _ := onlyGame(b, -100)
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{TWO}})
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+
+	tg.HandleUpdate(update(-100, bob, oddsCmd))
+	if last := r.messages[len(r.messages)-1]; last.ChatID != -100 || last.Text != "It's Alice's turn" {
+		t.Error(last)
+	}
+
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 1 2"))
+	tg.HandleUpdate(update(-100, bob, oddsCmd))
+	if r.count(-100, "Sent the odds to Bob") != 1 {
+		t.Error(r.messages)
+	}
+	// Bob holds a two, and Alice's one dice matches a face with probability 2/6, or 1/6 for wild
+	expected := "Odds in Table 1 with your hand 2️⃣ and 1 other dice:\n" +
+		"Current bid 1 2️⃣ is good: 100%\n" +
+		"1 3️⃣: 33%\n1 4️⃣: 33%\n1 5️⃣: 33%\n1 *️⃣: 17%\n2 1️⃣: 0%\n2 2️⃣: 33%\n"
+	if r.count(bob.ID, expected) != 1 {
+		t.Fatal(r.messages)
+	}
+	last := r.messages[len(r.messages)-2].Text
+	if !strings.HasSuffix(last, "\nChallenge wins: 0%\nExact wins: 67%") {
+		t.Error(last)
+	}
+}
+
+// Create a bot running on Telegram, keeping games only in memory
+func newTelegramBot(api telegram.MsgSender) (*Telegram, *Bot) {
+	tg, _ := newTelegram("bluffbot", api, NewMemoryStore())
+	return tg, tg.Bot()
+}
+
+// Get the game of a chat that has only one game
+func onlyGame(b *Bot, chatID int) (*Game, bool) {
+	games := b.chatGames(chatID)
+	if len(games) != 1 {
+		return nil, false
+	}
+	return games[0], true
+}
+
+// Make the text of the command joining the game of a chat from a private chat
+func joinText(b *Bot, chatID int) string {
+	g, found := onlyGame(b, chatID)
+	if !found {
+		return startCmd + " no-game"
+	}
+	return startCmd + " " + g.ID
+}
@@ -0,0 +1,114 @@
+package bluff
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// HandCommitment commits the bot to a player's hand before the round is played. The hashes of all the hands are
+// posted in the chat when the round starts, and the salts are revealed with the hands when the round ends, so that
+// anyone can check that no hand was changed in between.
+type HandCommitment struct {
+	PlayerID int
+	// Hex encoded SHA-256 of the salt, a colon and the faces of the hand without separators, e.g. "0f1e:*1123"
+	Hash string
+	// Hex encoded random salt, secret until the hands are revealed
+	Salt string
+}
+
+// Length of the salts of hand commitments in bytes
+const saltLength = 16
+
+// Commit to the hand of a player with a new random salt
+func commitHand(r Rules, playerID int, hand []Dice) HandCommitment {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	c := HandCommitment{PlayerID: playerID, Salt: hex.EncodeToString(salt)}
+	c.Hash = handHash(r, c.Salt, hand)
+	return c
+}
+
+func handHash(r Rules, salt string, hand []Dice) string {
+	h := sha256.Sum256([]byte(salt + ":" + handFaces(r, hand)))
+	return hex.EncodeToString(h[:])
+}
+
+// List the faces of a hand without emoji or separators, e.g. "*1123"
+func handFaces(r Rules, hand []Dice) string {
+	s := ""
+	for _, d := range hand {
+		s += r.FaceName(d)
+	}
+	return s
+}
+
+// Commit to the current hands of all the players with dice
+func commitHands(r Rules, players []Player) []HandCommitment {
+	var commitments []HandCommitment
+	for _, p := range players {
+		if len(p.Hand) > 0 {
+			commitments = append(commitments, commitHand(r, p.Info.ID, p.Hand))
+		}
+	}
+	return commitments
+}
+
+// Get the commitment to a player's hand
+func commitment(commitments []HandCommitment, playerID int) (HandCommitment, bool) {
+	for _, c := range commitments {
+		if c.PlayerID == playerID {
+			return c, true
+		}
+	}
+	return HandCommitment{}, false
+}
+
+// The hands of an ended round with the salts of their commitments. The hashes posted when the round started aren't
+// kept, so the hands can be checked only against the hashes the players saw.
+type revealedRound struct {
+	GameID  string
+	ChatID  int
+	Rules   Rules
+	Players []Player
+	// Salts of the hands keyed by player ID
+	Salts map[int]string
+	// The table of the game
+	Table string
+}
+
+// Save the hands and salts of a game's current round, to be revealed when the round ends
+func revealRound(g *Game) revealedRound {
+	r := revealedRound{GameID: g.ID, ChatID: g.ChatID, Rules: g.Rules, Salts: make(map[int]string), Table: g.Name}
+	for _, p := range g.Players {
+		if len(p.Hand) > 0 {
+			r.Players = append(r.Players, Player{p.Info, append([]Dice{}, p.Hand...)})
+		}
+	}
+	for _, c := range g.Commitments {
+		r.Salts[c.PlayerID] = c.Salt
+	}
+	return r
+}
+
+// Hash of a revealed hand computed from its salt. Empty if the hand had no commitment.
+func (r revealedRound) hash(p Player) string {
+	salt, found := r.Salts[p.Info.ID]
+	if !found {
+		return ""
+	}
+	return handHash(r.Rules, salt, p.Hand)
+}
+
+// Find the revealed hand whose commitment is hash
+func (r revealedRound) find(hash string) (Player, bool) {
+	for _, p := range r.Players {
+		if h := r.hash(p); h != "" && h == strings.ToLower(hash) {
+			return p, true
+		}
+	}
+	return Player{}, false
+}
@@ -0,0 +1,194 @@
+package bluff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+func TestHandCommitment(t *testing.T) {
+	hand := []Dice{WILD, ONE, ONE, TWO}
+	c := commitHand(Rules{}, 1, hand)
+	if len(c.Salt) != 2*saltLength || c.PlayerID != 1 {
+		t.Error(c)
+	}
+	// The hash can be computed without the bot
+	h := sha256.Sum256([]byte(c.Salt + ":*112"))
+	if c.Hash != hex.EncodeToString(h[:]) {
+		t.Error(c)
+	}
+	if handHash(Rules{}, c.Salt, []Dice{WILD, ONE, ONE, THREE}) == c.Hash || handHash(Rules{}, c.Salt, []Dice{WILD, ONE, ONE}) == c.Hash {
+		t.Error(c)
+	}
+	if commitHand(Rules{}, 1, hand).Hash == c.Hash {
+		t.Error("Same salt twice")
+	}
+
+	// Perudo faces are named 1-6
+	p := commitHand(Rules{Variant: PERUDO}, 1, hand)
+	h = sha256.Sum256([]byte(p.Salt + ":1223"))
+	if p.Hash != hex.EncodeToString(h[:]) {
+		t.Error(p)
+	}
+}
+
+func TestCommitmentsFollowRolls(t *testing.T) {
+	var g Game
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.StartGame()
+	for round := 0; round < 3; round++ {
+		if len(g.Commitments) != 2 {
+			t.Fatal(g.Commitments)
+		}
+		for _, p := range g.Players {
+			c, found := commitment(g.Commitments, p.Info.ID)
+			if !found || handHash(g.Rules, c.Salt, p.Hand) != c.Hash {
+				t.Error(c, p)
+			}
+		}
+		g.rollDice()
+	}
+}
+
+func TestVerifyCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(-100, alice, verifyCmd))
+	if r.count(-100, "No hands have been revealed") != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, addBotCmd))
+	g, _ := onlyGame(b, -100)
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{ONE, TWO, THREE, FOUR, FIVE}})
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+
+	// The commitments to all the hands, the computer player's included, are posted in the chat
+	published := regexp.MustCompile("Commitments to the hands of this round:\nAlice: ([0-9a-f]{64})\nBob: ([0-9a-f]{64})\nBot 1 \\(normal\\): ([0-9a-f]{64})")
+	var hashes []string
+	for _, m := range r.messages {
+		if h := published.FindStringSubmatch(m.Text); m.ChatID == -100 && h != nil {
+			hashes = h[1:]
+			break
+		}
+	}
+	if hashes == nil {
+		t.Fatal(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 5 5"))
+	tg.HandleUpdate(update(-100, bob, challengeCmd))
+
+	// The salt revealed in the chat lets anyone check Alice's hand without the bot
+	salt := regexp.MustCompile(`Alice: \S+ \(salt ([0-9a-f]+)\)`)
+	var aliceSalt string
+	for _, m := range r.messages {
+		if s := salt.FindStringSubmatch(m.Text); m.ChatID == -100 && s != nil {
+			aliceSalt = s[1]
+		}
+	}
+	h := sha256.Sum256([]byte(aliceSalt + ":12345"))
+	if hex.EncodeToString(h[:]) != hashes[0] {
+		t.Error(aliceSalt, hashes[0])
+	}
+
+	tg.HandleUpdate(update(-100, bob, verifyCmd+" "+strings.Join(hashes, " ")))
+	expected := "Commitments checked against the hands of the last round:\n" + hashes[0] + " matches Alice's hand 1️⃣2️⃣3️⃣4️⃣5️⃣ ✅\n" +
+		hashes[1] + " matches Bob's hand 1️⃣2️⃣3️⃣4️⃣5️⃣ ✅\n" + hashes[2] + " matches Bot 1 (normal)'s hand 1️⃣2️⃣3️⃣4️⃣5️⃣ ✅\n"
+	if r.count(-100, expected) != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, bob, verifyCmd))
+	if r.count(-100, "Hashes of the hands of the last round, computed from the revealed salts:\nAlice: 1️⃣2️⃣3️⃣4️⃣5️⃣ "+hashes[0]+"\n") != 1 {
+		t.Error(r.messages)
+	}
+
+	// A hand changed after the commitment was posted is caught
+	revealed := b.chatRevealedRounds(-100)
+	revealed[0].Players[1].Hand[0] = WILD
+	tg.HandleUpdate(update(-100, bob, verifyCmd+" "+hashes[1]))
+	if r.count(-100, "Commitments checked against the hands of the last round:\n"+hashes[1]+" DOESN'T match any hand ❌") != 1 {
+		t.Error(r.messages)
+	}
+}
+
+func TestVerifyCmdSeveralTables(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	carol := telegram.User{ID: 3, FirstName: "Carol"}
+	dave := telegram.User{ID: 4, FirstName: "Dave"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(-100, carol, startCmd+" High rollers"))
+	table1, _ := b.chatGame(-100, 0, "Table 1")
+	table2, _ := b.chatGame(-100, 0, "High rollers")
+	tg.HandleUpdate(update(alice.ID, alice, startCmd+" "+table1.ID))
+	tg.HandleUpdate(update(bob.ID, bob, startCmd+" "+table1.ID))
+	tg.HandleUpdate(update(carol.ID, carol, startCmd+" "+table2.ID))
+	tg.HandleUpdate(update(dave.ID, dave, startCmd+" "+table2.ID))
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	tg.HandleUpdate(update(-100, carol, beginCmd))
+
+	published := regexp.MustCompile("(Alice|Carol): ([0-9a-f]{64})")
+	hashes := make(map[string]string)
+	for _, m := range r.messages {
+		for _, h := range published.FindAllStringSubmatch(m.Text, -1) {
+			hashes[h[1]] = h[2]
+		}
+	}
+	if len(hashes) != 2 {
+		t.Fatal(r.messages)
+	}
+
+	// Ending a round at one table doesn't replace the hands revealed at the other
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 1 3"))
+	tg.HandleUpdate(update(-100, bob, challengeCmd))
+	tg.HandleUpdate(update(-100, carol, bidCmd+" 1 3"))
+	tg.HandleUpdate(update(-100, dave, challengeCmd))
+	tg.HandleUpdate(update(-100, bob, verifyCmd+" "+hashes["Alice"]+" "+hashes["Carol"]))
+	checked := regexp.MustCompile("^Commitments checked against the hands of the last round at each table:\n" +
+		hashes["Alice"] + " matches Alice's hand \\S+ at Table 1 ✅\n" + hashes["Carol"] + " matches Carol's hand \\S+ at High rollers ✅\n$")
+	if m := r.messages[len(r.messages)-1]; !checked.MatchString(m.Text) {
+		t.Error(m)
+	}
+	tg.HandleUpdate(update(-100, bob, verifyCmd))
+	if r.count(-100, "Hashes of the hands of the last round at High rollers, computed from the revealed salts:\nCarol:") != 1 ||
+		!strings.Contains(r.messages[len(r.messages)-1].Text, "\n\nHashes of the hands of the last round at Table 1, computed from the revealed salts:\nAlice:") {
+		t.Error(r.messages)
+	}
+}
+
+func TestVerifyEliminatedRound(t *testing.T) {
+	tg, b, r, c, alice, _ := timeoutGame("60 eliminate")
+	g, _ := onlyGame(b, -100)
+	committed := g.Commitments
+	c.Advance(60 * time.Second)
+
+	// The round ended by the elimination is revealed before the hands are rolled again
+	if r.count(-100, "Alice is out of the game. The hands of the round were:\nAlice: ") != 1 {
+		t.Fatal(r.messages)
+	}
+	var hashes []string
+	for _, cm := range committed {
+		hashes = append(hashes, cm.Hash)
+	}
+	tg.HandleUpdate(update(-100, alice, verifyCmd+" "+strings.Join(hashes, " ")))
+	checked := regexp.MustCompile("^Commitments checked against the hands of the last round:\n" +
+		hashes[0] + " matches Alice's hand \\S+ ✅\n" + hashes[1] + " matches Bob's hand \\S+ ✅\n$")
+	if m := r.messages[len(r.messages)-1]; !checked.MatchString(m.Text) {
+		t.Error(m)
+	}
+}
@@ -0,0 +1,81 @@
+package bluff
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// DiceRoller rolls the dice of a game
+type DiceRoller interface {
+	// Roll a dice with the given number of faces
+	Roll(faces int) Dice
+}
+
+// Length of the seeds of SeededRoller in bytes
+const seedLength = 32
+
+// SeededRoller rolls dice from SHA-256 hashes of a seed and a counter. The rolls can't be predicted without the seed,
+// and the same seed gives the same rolls.
+type SeededRoller struct {
+	Seed []byte
+	// Number of hashes used so far
+	Counter uint64
+}
+
+// Create a roller with a random seed from crypto/rand
+func NewRandomSeededRoller() *SeededRoller {
+	seed := make([]byte, seedLength)
+	if _, err := rand.Read(seed); err != nil {
+		panic(err)
+	}
+	return &SeededRoller{Seed: seed}
+}
+
+// Create a roller with the given seed, e.g. to reproduce the rolls of a recorded game
+func NewSeededRoller(seed []byte) *SeededRoller {
+	return &SeededRoller{Seed: append([]byte{}, seed...)}
+}
+
+func (r *SeededRoller) Roll(faces int) Dice {
+	// Reject the values above the largest multiple of faces, so that every face is equally likely
+	limit := ^uint64(0) - ^uint64(0)%uint64(faces)
+	for {
+		var counter [8]byte
+		binary.BigEndian.PutUint64(counter[:], r.Counter)
+		r.Counter++
+		h := sha256.Sum256(append(append([]byte{}, r.Seed...), counter[:]...))
+		v := binary.BigEndian.Uint64(h[:8])
+		if v < limit {
+			return Dice(v % uint64(faces))
+		}
+	}
+}
+
+// ScriptedRoller returns the given dice in order, starting over after the last one. Meant for tests.
+type ScriptedRoller struct {
+	Dice []Dice
+	next int
+}
+
+func (r *ScriptedRoller) Roll(faces int) Dice {
+	d := r.Dice[r.next%len(r.Dice)]
+	r.next++
+	return d
+}
+
+// Set the roller used for the dice of the game. nil restores the game's own SeededRoller.
+func (g *Game) SetDiceRoller(r DiceRoller) {
+	g.roller = r
+}
+
+// Get the roller used for the dice of the game
+func (g *Game) diceRoller() DiceRoller {
+	if g.roller != nil {
+		return g.roller
+	}
+	if g.Roller.Seed == nil {
+		g.Roller = *NewRandomSeededRoller()
+	}
+	return &g.Roller
+}
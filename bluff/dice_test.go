@@ -0,0 +1,140 @@
+package bluff
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func rolls(r DiceRoller, n int, faces int) []Dice {
+	d := make([]Dice, n)
+	for i := range d {
+		d[i] = r.Roll(faces)
+	}
+	return d
+}
+
+func TestSeededRoller(t *testing.T) {
+	seed := []byte("0123456789abcdef0123456789abcdef")
+	a := rolls(NewSeededRoller(seed), 1000, 6)
+	b := rolls(NewSeededRoller(seed), 1000, 6)
+	c := rolls(NewSeededRoller([]byte("another seed")), 1000, 6)
+
+	counts := make([]int, 6)
+	same := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal(i, a[i], b[i])
+		}
+		if a[i] == c[i] {
+			same++
+		}
+		if a[i] < WILD || a[i] > FIVE {
+			t.Fatal(a[i])
+		}
+		counts[a[i]]++
+	}
+	if same > 300 {
+		t.Error(same)
+	}
+	for _, n := range counts {
+		if n < 100 || n > 240 {
+			t.Error(counts)
+		}
+	}
+}
+
+func TestRandomSeededRoller(t *testing.T) {
+	a := NewRandomSeededRoller()
+	b := NewRandomSeededRoller()
+	if len(a.Seed) != seedLength || bytes.Equal(a.Seed, b.Seed) {
+		t.Error(a.Seed, b.Seed)
+	}
+	for _, d := range rolls(a, 100, 10) {
+		if d < 0 || d >= 10 {
+			t.Error(d)
+		}
+	}
+}
+
+func TestScriptedRoller(t *testing.T) {
+	var g Game
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{ONE, TWO, THREE}})
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.SetRules(Rules{DicePerPlayer: 2})
+	g.StartGame()
+	if !equalDice(g.Players[0].Hand, []Dice{ONE, TWO}) || !equalDice(g.Players[1].Hand, []Dice{THREE, ONE}) {
+		t.Error(g.Players)
+	}
+	if g.Roller.Seed != nil {
+		t.Error(g.Roller)
+	}
+}
+
+// The game's own roller continues from where it was after the game is stored and loaded
+func TestGameRollerSurvivesStore(t *testing.T) {
+	var g Game
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.StartGame()
+	if len(g.Roller.Seed) != seedLength || g.Roller.Counter < 10 {
+		t.Fatal(g.Roller)
+	}
+
+	data, _ := json.Marshal(&g)
+	var loaded Game
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	g.rollDice()
+	loaded.rollDice()
+	for i := range g.Players {
+		if !equalDice(g.Players[i].Hand, loaded.Players[i].Hand) {
+			t.Error(g.Players[i], loaded.Players[i])
+		}
+	}
+}
+
+func TestReplayVerifiesSeed(t *testing.T) {
+	var r eventRecorder
+	var g Game
+	g.SetEventSink(&r)
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.StartGame()
+	g.Stop()
+
+	finished := &r.events[len(r.events)-1]
+	if !bytes.Equal(finished.Seed, g.Roller.Seed) {
+		t.Fatal(finished)
+	}
+	replay := func() error {
+		rep := NewReplayer()
+		for _, e := range r.events {
+			if err := rep.Apply(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := replay(); err != nil {
+		t.Fatal(err)
+	}
+	finished.Seed = []byte("not the seed")
+	if replay() == nil {
+		t.Error("Wrong seed accepted")
+	}
+}
+
+func equalDice(a []Dice, b []Dice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package bluff
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	PLAYER_JOINED     EventType = "player_joined"
+	GAME_STARTED      EventType = "game_started"
+	HANDS_ROLLED      EventType = "hands_rolled"
+	BID_MADE          EventType = "bid"
+	CHALLENGE_MADE    EventType = "challenge"
+	PLAYER_ELIMINATED EventType = "player_eliminated"
+	GAME_FINISHED     EventType = "game_finished"
+)
+
+// Event is something that happened in a game. Only the fields relevant to the event type are set.
+type Event struct {
+	// Sequence number of the event within its game, starting from 1
+	Seq int `json:"seq"`
+	// When the event happened, from the clock of the Bot. Set by the Bot.
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+	// The game the event belongs to and the chat it's played in. Set by the Bot.
+	GameID string `json:"game_id,omitempty"`
+	ChatID int    `json:"chat_id,omitempty"`
+	// PLAYER_JOINED, PLAYER_ELIMINATED: the player
+	Player *PlayerInfo `json:"player,omitempty"`
+	// PLAYER_JOINED: difficulty of a computer-controlled player
+	Difficulty string `json:"difficulty,omitempty"`
+	// GAME_STARTED: the rules of the game
+	Rules *Rules `json:"rules,omitempty"`
+	// HANDS_ROLLED: the new hands, keyed by player ID
+	Hands map[int][]Dice `json:"hands,omitempty"`
+	// BID_MADE: the bid
+	Bid *Bid `json:"bid,omitempty"`
+	// CHALLENGE_MADE: the result of a challenge or an exact call, and the number of dice matching the called bid
+	Result      *ChallengeResult `json:"result,omitempty"`
+	ActualCount int              `json:"actual_count,omitempty"`
+	// GAME_FINISHED: the winner, nil if the game was stopped before it finished
+	Winner *PlayerInfo `json:"winner,omitempty"`
+	// GAME_FINISHED: the seed all the hands of the game were rolled from. It's revealed only at the end, so that
+	// the hands can't be predicted during the game.
+	Seed []byte `json:"seed,omitempty"`
+}
+
+// EventSink receives the events of games. The Bot logs the errors returned by the sink.
+type EventSink interface {
+	Event(e Event) error
+}
+
+// JSONLinesSink writes events to a writer as JSON, one event per line. Safe to use from multiple goroutines.
+type JSONLinesSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+func (s *JSONLinesSink) Event(e Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return json.NewEncoder(s.w).Encode(e)
+}
+
+// Read events written by a JSONLinesSink
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// gameEventSink tags the events of one game with the game's ID and chat and the time of the bot's clock, and logs
+// the errors of the bot's sink
+type gameEventSink struct {
+	gameID string
+	chatID int
+	bot    *Bot
+	sink   EventSink
+}
+
+func (s gameEventSink) Event(e Event) error {
+	e.GameID = s.gameID
+	e.ChatID = s.chatID
+	e.Time = s.bot.now()
+	if err := s.sink.Event(e); err != nil {
+		s.bot.log().Error("Failed to write event", "game_id", s.gameID, "seq", e.Seq, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Set the sink receiving the events of the game. nil disables the events.
+func (g *Game) SetEventSink(s EventSink) {
+	g.events = s
+}
+
+// Send an event to the game's sink. A failure to record the event doesn't stop the game.
+func (g *Game) emit(e Event) {
+	if g.events == nil {
+		return
+	}
+	g.EventSeq++
+	e.Seq = g.EventSeq
+	g.events.Event(e)
+}
+
+// Copy the hands of the players with dice, keyed by player ID
+func hands(players []Player) map[int][]Dice {
+	h := make(map[int][]Dice)
+	for _, p := range players {
+		if len(p.Hand) > 0 {
+			h[p.Info.ID] = append([]Dice{}, p.Hand...)
+		}
+	}
+	return h
+}
+
+// Get the only player with dice left
+func winner(players []Player) *PlayerInfo {
+	for _, p := range players {
+		if len(p.Hand) > 0 {
+			info := p.Info
+			return &info
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package bluff
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+// eventRecorder is an EventSink keeping the events in memory
+type eventRecorder struct {
+	events []Event
+}
+
+func (r *eventRecorder) Event(e Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestGameEvents(t *testing.T) {
+	var r eventRecorder
+	var g Game
+	g.SetEventSink(&r)
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddAIPlayer(PlayerInfo{-1, "Bot"}, EASY)
+	g.StartGame()
+	g.Players[0].Hand = []Dice{ONE, ONE, ONE, ONE, ONE}
+	g.Players[1].Hand = []Dice{TWO, TWO, TWO, TWO, TWO}
+	g.Bid(Bid{1, TWO, 5})
+	g.ChallengeCurrentBid(-1)
+	g.EliminatePlayer(1)
+
+	types := []EventType{PLAYER_JOINED, PLAYER_JOINED, GAME_STARTED, HANDS_ROLLED, BID_MADE, CHALLENGE_MADE, HANDS_ROLLED, PLAYER_ELIMINATED, HANDS_ROLLED, GAME_FINISHED}
+	if len(r.events) != len(types) {
+		t.Fatal(r.events)
+	}
+	for i, e := range r.events {
+		if e.Type != types[i] || e.Seq != i+1 {
+			t.Error(i, e)
+		}
+	}
+	if r.events[1].Difficulty != EASY || r.events[5].ActualCount != 5 || r.events[5].Result.Result != EXACT_BID {
+		t.Error(r.events[1], r.events[5])
+	}
+	if len(r.events[6].Hands[1]) != 5 || len(r.events[6].Hands[-1]) != 4 {
+		t.Error(r.events[6])
+	}
+	if *r.events[9].Winner != (PlayerInfo{-1, "Bot"}) {
+		t.Error(r.events[9])
+	}
+}
+
+// Play a game with a computer-controlled opponent through the bot, logging its events as JSON lines
+func playLoggedGame(t *testing.T) *bytes.Buffer {
+	var r msgRecorder
+	var log bytes.Buffer
+	tg, b := newTelegramBot(&r)
+	b.SetEventSink(NewJSONLinesSink(&log))
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, addBotCmd+" "+HARD))
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" dice 2"))
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+
+	for i := 0; i < 100; i++ {
+		g, found := onlyGame(b, -100)
+		if !found {
+			return &log
+		}
+		if g.CurrentBid.Count == 0 {
+			tg.HandleUpdate(update(-100, alice, bidCmd+" 1 1"))
+		} else if i%3 == 0 {
+			tg.HandleUpdate(update(-100, alice, exactCmd))
+		} else {
+			tg.HandleUpdate(update(-100, alice, challengeCmd))
+		}
+	}
+	t.Fatal("Game didn't finish")
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	log := playLoggedGame(t)
+	events, err := ReadEvents(bytes.NewReader(log.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReplayer()
+	for _, e := range events {
+		if e.ChatID != -100 || e.GameID == "" || e.GameID != events[0].GameID {
+			t.Error(e)
+		}
+		if strings.HasPrefix(r.Describe(e), "Invalid") {
+			t.Error(e)
+		}
+		if err := r.Apply(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := events[len(events)-1]
+	if r.Game.State != FINISHED || last.Type != GAME_FINISHED || last.Winner == nil {
+		t.Error(r.Game, last)
+	}
+	if winner(r.Game.Players).ID != last.Winner.ID {
+		t.Error(r.Game.Players, last)
+	}
+}
+
+func TestReplayDetectsTampering(t *testing.T) {
+	var r eventRecorder
+	var g Game
+	g.SetEventSink(&r)
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.StartGame()
+	g.Players[0].Hand = []Dice{ONE, ONE, ONE, ONE, ONE}
+	g.Players[1].Hand = []Dice{TWO, TWO, TWO, TWO, TWO}
+	// Log the hands as they are after the edit
+	r.events[3].Hands = hands(g.Players)
+	g.Bid(Bid{1, TWO, 5})
+	g.ChallengeCurrentBid(2)
+
+	replay := func() error {
+		rep := NewReplayer()
+		for _, e := range r.events {
+			if err := rep.Apply(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := replay(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A claims to have had twos too
+	r.events[3].Hands[1] = []Dice{TWO, ONE, ONE, ONE, ONE}
+	if replay() == nil {
+		t.Error("Tampered hands replayed")
+	}
+	r.events[3].Hands[1] = []Dice{ONE, ONE, ONE, ONE, ONE}
+
+	// A claims to have bid lower
+	r.events[4].Bid.Count = 4
+	if replay() == nil {
+		t.Error("Tampered bid replayed")
+	}
+}
+
+func TestReplayStoppedGame(t *testing.T) {
+	var r msgRecorder
+	var log eventRecorder
+	tg, b := newTelegramBot(&r)
+	b.SetEventSink(&log)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(-100, alice, stopCmd))
+
+	if len(log.events) != 1 || log.events[0].Type != GAME_FINISHED || log.events[0].Winner != nil {
+		t.Error(log.events)
+	}
+	rep := NewReplayer()
+	if rep.Describe(log.events[0]) != "Game stopped" || rep.Apply(log.events[0]) != nil {
+		t.Error(rep.Game)
+	}
+}
+
+// failingSink is an EventSink that can't record the events
+type failingSink struct{}
+
+func (failingSink) Event(e Event) error {
+	return &GameError{"Disk full"}
+}
+
+func TestBotEventTimeAndFailures(t *testing.T) {
+	var r msgRecorder
+	var events eventRecorder
+	var c fakeClock
+	var log bytes.Buffer
+	tg, b := newTelegramBot(&r)
+	b.SetClock(&c)
+	b.SetLogger(slog.New(slog.NewTextHandler(&log, nil)))
+	b.SetEventSink(&events)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	c.Advance(time.Minute)
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+
+	if len(events.events) != 1 || !events.events[0].Time.Equal(time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC)) {
+		t.Error(events.events)
+	}
+
+	// The game goes on without the events
+	b.SetEventSink(failingSink{})
+	tg.HandleUpdate(update(-100, alice, stopCmd))
+	if _, found := onlyGame(b, -100); found || !strings.Contains(log.String(), "msg=\"Failed to write event\"") {
+		t.Error(log.String())
+	}
+}
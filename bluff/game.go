@@ -2,7 +2,7 @@ package bluff
 
 import (
 	"fmt"
-	"math/rand"
+	"time"
 )
 
 const N_DICE_PER_PLAYER = 5
@@ -29,6 +29,17 @@ const (
 	FINISHED
 )
 
+// Name the state without spaces, e.g. "not_started"
+func (s GameState) Name() string {
+	switch s {
+	case STARTED:
+		return "started"
+	case FINISHED:
+		return "finished"
+	}
+	return "not_started"
+}
+
 type PlayerInfo struct {
 	ID   int
 	Name string
@@ -39,10 +50,17 @@ type Player struct {
 	Hand []Dice
 }
 
+// PlayerSummary is what everyone can see of a player: the number of dice but not the hand
+type PlayerSummary struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Dice int    `json:"dice"`
+}
+
 // Set new random dice for a player
-func (p *Player) rollDice() {
+func (p *Player) rollDice(r DiceRoller, faces int) {
 	for i := range p.Hand {
-		p.Hand[i] = Dice(rand.Intn(int(FIVE + 1)))
+		p.Hand[i] = r.Roll(faces)
 	}
 }
 
@@ -61,16 +79,9 @@ type Bid struct {
 	Count    int
 }
 
-// Calculate score from bid to enable comparing bids
+// Calculate score from bid to enable comparing bids with the default rules
 func (b *Bid) score() int {
-	if b.Count <= 0 {
-		return 0
-	} else if b.Dice == WILD {
-		return 6 + (b.Count - 1) * 11
-	}
-	// Leave "space" for stars
-	stars := b.Count / 2
-	return (b.Count - 1) * 5 + int(b.Dice) + stars
+	return Rules{}.score(*b)
 }
 
 // Return quotient and remainder
@@ -78,17 +89,9 @@ func divmod(x, y int) (quot, rem int) {
 	return x / y, x % y
 }
 
-// Construct a bid from score value
+// Construct a bid from score value with the default rules
 func bidFromScore(score int) Bid {
-	if score <= 0 {
-		return Bid{Count: 0, Dice: ONE}
-	}
-	stars, starsRem := divmod(score + 5, 11)
-	if starsRem == 0 {
-		return Bid{Count: stars, Dice: WILD}
-	}
-	count, face := divmod(score - stars - 1, 5)
-	return Bid{Count: count + 1, Dice: Dice(face + 1)}
+	return Rules{}.bidFromScore(score)
 }
 
 type BidClass int
@@ -100,14 +103,58 @@ const (
 	EXACT_BID
 	// The bid was too high, bidder loses
 	HIGH_BID
+	// The bid was called exact and it was, the caller gets back one dice
+	EXACT_CALL_WON
+	// The bid was called exact but it wasn't, the caller loses one dice
+	EXACT_CALL_LOST
 )
 
+// Name the class without spaces, e.g. "low_bid"
+func (c BidClass) Name() string {
+	switch c {
+	case LOW_BID:
+		return "low_bid"
+	case EXACT_BID:
+		return "exact_bid"
+	case HIGH_BID:
+		return "high_bid"
+	case EXACT_CALL_WON:
+		return "exact_call_won"
+	case EXACT_CALL_LOST:
+		return "exact_call_lost"
+	}
+	return "?"
+}
+
 type ChallengeResult struct {
 	Result        BidClass
 	LostDiceCount int
 	ChallengedBid Bid
 	Bidder        PlayerInfo
 	Challenger    PlayerInfo
+	// Number of dice the caller got back on EXACT_CALL_WON. Zero if the caller already had all the dice.
+	GainedDiceCount int
+}
+
+type TimeoutAction int
+
+const (
+	// Challenge the current bid, or make the minimal bid if there's no bid to challenge
+	AUTO_CHALLENGE TimeoutAction = iota
+	// Make the minimal bid above the current bid
+	AUTO_BID
+	// Remove the player from the game
+	ELIMINATE
+)
+
+// TurnTimeout configures how long a player can take to make a move
+type TurnTimeout struct {
+	// Time a player has to make a move. Zero disables the timeout.
+	Limit time.Duration
+	// The player is warned when this much time is left
+	Warning time.Duration
+	// What to do when the time runs out
+	Action TimeoutAction
 }
 
 type Game struct {
@@ -115,6 +162,38 @@ type Game struct {
 	Players    []Player
 	TurnIdx    int
 	CurrentBid Bid
+	// Difficulty of each computer-controlled player, keyed by player ID
+	AIPlayers   map[int]string
+	TurnTimeout TurnTimeout
+	Rules       Rules
+	// Perudo: the current round is a palifico round
+	Palifico bool
+	// Perudo: IDs of the players who have already had their palifico round
+	PalificoPlayers []int
+	// Sequence number of the last event sent to the event sink
+	EventSeq int
+	events   EventSink
+	// Rolls the dice unless another roller is set with SetDiceRoller. The seed is recorded so that the game can be
+	// re-rolled exactly.
+	Roller SeededRoller
+	roller DiceRoller
+	// Commitments to the hands of the current round
+	Commitments []HandCommitment
+	// Finishing place of each player who is out of the game, and of the winner once the game has finished. Players
+	// going out in the same round share the place.
+	Places map[int]int
+	// Number of the current round, starting from 1. A new round starts every time the dice are rolled.
+	Round int
+	// The round in which each player who is out of the game lost their last dice
+	OutRounds map[int]int
+	// People following the game without playing. They receive the hands of all the players every round.
+	Spectators []PlayerInfo
+	// Opaque ID of the game, used e.g. in the links for joining the game. Set by the Bot.
+	ID string
+	// The chat the game is played in. Set by the Bot.
+	ChatID int
+	// Name of the table the game is played at. A chat can have several games at tables of their own.
+	Name string
 }
 
 type GameError struct {
@@ -126,6 +205,19 @@ func (e *GameError) Error() string {
 }
 
 func (g *Game) AddPlayer(p PlayerInfo) error {
+	return g.addPlayer(p, "")
+}
+
+// Add a computer-controlled player playing with the given difficulty
+func (g *Game) AddAIPlayer(p PlayerInfo, difficulty string) error {
+	if _, err := strategyFor(difficulty); err != nil {
+		return err
+	}
+	return g.addPlayer(p, difficulty)
+}
+
+// Add a player, computer-controlled if difficulty isn't empty
+func (g *Game) addPlayer(p PlayerInfo, difficulty string) error {
 	if g.State != NOT_STARTED {
 		return &GameError{"Can't add players when the game has already started"}
 	}
@@ -135,10 +227,155 @@ func (g *Game) AddPlayer(p PlayerInfo) error {
 		}
 	}
 
+	// A spectator joining the game stops watching it, so that they don't see the other players' hands
+	g.RemoveSpectator(p.ID)
 	g.Players = append(g.Players, Player{p, nil})
+	if difficulty != "" {
+		if g.AIPlayers == nil {
+			g.AIPlayers = make(map[int]string)
+		}
+		g.AIPlayers[p.ID] = difficulty
+	}
+	g.emit(Event{Type: PLAYER_JOINED, Player: &p, Difficulty: difficulty})
+	return nil
+}
+
+// Is the player computer-controlled?
+func (g *Game) IsAI(playerID int) bool {
+	_, found := g.AIPlayers[playerID]
+	return found
+}
+
+// Add a spectator to the game. Players who are out of the game can watch it, but the others can't, as they would see
+// the hands of their opponents.
+func (g *Game) AddSpectator(p PlayerInfo) error {
+	for _, v := range g.Players {
+		if v.Info.ID == p.ID && (g.State == NOT_STARTED || len(v.Hand) > 0) {
+			return &GameError{"Players can't watch the game they are playing"}
+		}
+	}
+	if g.IsSpectator(p.ID) {
+		return &GameError{"Already watching the game"}
+	}
+	g.Spectators = append(g.Spectators, p)
+	return nil
+}
+
+// Remove a spectator from the game
+func (g *Game) RemoveSpectator(id int) error {
+	for i, s := range g.Spectators {
+		if s.ID == id {
+			g.Spectators = append(g.Spectators[:i], g.Spectators[i+1:]...)
+			return nil
+		}
+	}
+	return &GameError{"Not watching the game"}
+}
+
+// Is the person watching the game?
+func (g *Game) IsSpectator(id int) bool {
+	for _, s := range g.Spectators {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the name of a player of the game. Empty if the player isn't in the game.
+func (g *Game) PlayerName(playerID int) string {
+	if idx := indexOfId(g.Players, playerID); idx >= 0 {
+		return g.Players[idx].Info.Name
+	}
+	return ""
+}
+
+// Get the summaries of the players in turn order
+func (g *Game) PlayerSummaries() []PlayerSummary {
+	summaries := []PlayerSummary{}
+	for _, p := range g.Players {
+		summaries = append(summaries, PlayerSummary{p.Info.ID, p.Info.Name, len(p.Hand)})
+	}
+	return summaries
+}
+
+// Get the faces of a player's hand, e.g. for showing the hand to the player. Empty if the game hasn't started.
+func (g *Game) HandFaceNames(playerID int) []string {
+	for _, p := range g.Players {
+		if p.Info.ID == playerID && g.State != NOT_STARTED {
+			return g.Rules.HandFaceNames(p.Hand)
+		}
+	}
+	return []string{}
+}
+
+// Set the turn timeout of the game. It can be changed only before the game starts.
+func (g *Game) SetTurnTimeout(t TurnTimeout) error {
+	if g.State != NOT_STARTED {
+		return &GameError{"Can't change the turn timeout when the game has already started"}
+	}
+	if t.Limit < 0 || t.Warning < 0 {
+		return &GameError{"Turn timeout can't be negative"}
+	}
+	g.TurnTimeout = t
+	return nil
+}
+
+// Set the rules of the game. They can be changed only before the game starts.
+func (g *Game) SetRules(r Rules) error {
+	if g.State != NOT_STARTED {
+		return &GameError{"Can't change the rules when the game has already started"}
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	g.Rules = r
+	return nil
+}
+
+// Seat the players in the given order, e.g. by their ratings. The first player starts the game. The order can be
+// changed only before the game starts.
+func (g *Game) SetPlayerOrder(order []PlayerInfo) error {
+	if g.State != NOT_STARTED {
+		return &GameError{"Can't change the order of the players when the game has already started"}
+	}
+	if len(order) != len(g.Players) {
+		return &GameError{"The order must have all the players"}
+	}
+	players := make([]Player, len(order))
+	for i, p := range order {
+		idx := indexOfId(g.Players, p.ID)
+		if idx < 0 {
+			return &GameError{"The order must have all the players"}
+		}
+		players[i] = g.Players[idx]
+	}
+	g.Players = players
 	return nil
 }
 
+// Get the rule engine for the current round
+func (g *Game) engine() ruleEngine {
+	return g.Rules.engine(g.Palifico)
+}
+
+// Get the n lowest bids that can be made on top of the current bid, lowest first. The bot shows the same bids as
+// buttons.
+func (g *Game) ValidBids(n int) []Bid {
+	return validBidsAbove(g.engine(), g.CurrentBid, n)
+}
+
+// Roll new dice for every player
+func (g *Game) rollDice() {
+	g.Round++
+	r := g.diceRoller()
+	for i := range g.Players {
+		g.Players[i].rollDice(r, g.Rules.faces())
+	}
+	g.Commitments = commitHands(g.Rules, g.Players)
+	g.emit(Event{Type: HANDS_ROLLED, Hands: hands(g.Players)})
+}
+
 func (g *Game) StartGame() error {
 	if g.State != NOT_STARTED {
 		return &GameError{"Game already started"}
@@ -148,10 +385,12 @@ func (g *Game) StartGame() error {
 	}
 
 	g.State = STARTED
+	rules := g.Rules
+	g.emit(Event{Type: GAME_STARTED, Rules: &rules})
 	for i := range g.Players {
-		g.Players[i].Hand = make([]Dice, N_DICE_PER_PLAYER)
-		g.Players[i].rollDice()
+		g.Players[i].Hand = make([]Dice, g.Rules.dicePerPlayer())
 	}
+	g.rollDice()
 	g.TurnIdx = 0
 	g.CurrentBid = Bid{}
 	return nil
@@ -164,14 +403,12 @@ func (g *Game) Bid(b Bid) error {
 	if b.PlayerID != g.Players[g.TurnIdx].Info.ID {
 		return &GameError{fmt.Sprintf("It's %v's turn", g.Players[g.TurnIdx].Info.Name)}
 	}
-	if b.Count < 1 {
-		return &GameError{"You must bid at least 1 dice"}
-	}
-	if !isGreater(b, g.CurrentBid) {
-		return &GameError{"You must make a higher bid than the current one"}
+	if err := g.engine().checkBid(g.CurrentBid, b); err != nil {
+		return err
 	}
 
 	g.CurrentBid = b
+	g.emit(Event{Type: BID_MADE, Bid: &b})
 	var e error
 	g.TurnIdx, e = indexOfNextPlayerWithDice(g.Players, g.TurnIdx)
 	if e != nil {
@@ -182,69 +419,130 @@ func (g *Game) Bid(b Bid) error {
 }
 
 func (g *Game) ChallengeCurrentBid(playerID int) (ChallengeResult, error) {
+	if err := g.checkCanCall(playerID); err != nil {
+		return ChallengeResult{}, err
+	}
+
+	e := g.engine()
+	actualCount := totalCount(e, g.Players, g.CurrentBid.Dice)
+	result := e.resolveChallenge(g, actualCount)
+	g.emit(Event{Type: CHALLENGE_MADE, Result: &result, ActualCount: actualCount})
+	g.endRound()
+	return result, nil
+}
+
+// Claim that the current bid is exactly right. If it is, the player gets back one lost dice, otherwise the player
+// loses one dice.
+func (g *Game) CallExact(playerID int) (ChallengeResult, error) {
+	if err := g.checkCanCall(playerID); err != nil {
+		return ChallengeResult{}, err
+	}
+
+	e := g.engine()
+	actualCount := totalCount(e, g.Players, g.CurrentBid.Dice)
+	result := e.resolveExactCall(g, actualCount)
+	g.emit(Event{Type: CHALLENGE_MADE, Result: &result, ActualCount: actualCount})
+	g.endRound()
+	return result, nil
+}
+
+// Check that the player can challenge or call the current bid exact
+func (g *Game) checkCanCall(playerID int) error {
 	if g.State != STARTED {
-		return ChallengeResult{}, &GameError{"Game not started"}
+		return &GameError{"Game not started"}
 	}
 	if playerID != g.Players[g.TurnIdx].Info.ID {
-		return ChallengeResult{}, &GameError{fmt.Sprintf("It's %v's turn", g.Players[g.TurnIdx].Info.Name)}
+		return &GameError{fmt.Sprintf("It's %v's turn", g.Players[g.TurnIdx].Info.Name)}
 	}
 	if g.CurrentBid.Count < 1 {
-		return ChallengeResult{}, &GameError{"No bid has been made yet"}
-	}
-
-	actualCount := totalCount(g.Players, g.CurrentBid.Dice)
-	bidderIdx := indexOfId(g.Players, g.CurrentBid.PlayerID)
-	bidder := &g.Players[bidderIdx]
-	challenger := &g.Players[g.TurnIdx]
-	result := ChallengeResult{ChallengedBid: g.CurrentBid, Bidder: bidder.Info, Challenger: challenger.Info}
-
-	switch {
-	// Less dice found than the bid -> bidder loses, challenger starts next round
-	case actualCount < g.CurrentBid.Count:
-		nLost := g.CurrentBid.Count - actualCount
-		bidder.lostDice(nLost)
-		result.Result = HIGH_BID
-		result.LostDiceCount = nLost
-
-	// More dice found than the bid -> challenger loses, bidder starts the next round
-	case actualCount > g.CurrentBid.Count:
-		nLost := actualCount - g.CurrentBid.Count
-		challenger.lostDice(nLost)
-		g.TurnIdx = bidderIdx
-		result.Result = LOW_BID
-		result.LostDiceCount = nLost
-
-	// Bid was exactly right -> everyone except bidder loses one dice, bidder starts next round
-	default:
-		for i := range g.Players {
-			if i != bidderIdx {
-				g.Players[i].lostDice(1)
-			}
-		}
-		g.TurnIdx = bidderIdx
-		result.Result = EXACT_BID
-		result.LostDiceCount = 1
+		return &GameError{"No bid has been made yet"}
 	}
+	return nil
+}
+
+// Start the next round after the current bid has been called, or finish the game
+func (g *Game) endRound() {
+	g.updatePlaces()
 
 	// Roll new hand for everyone
-	for i := range g.Players {
-		g.Players[i].rollDice()
-	}
+	g.rollDice()
 
 	g.CurrentBid = Bid{}
 
 	// Check whether the game ended
-	_, e := indexOfNextPlayerWithDice(g.Players, g.TurnIdx)
-	if e != nil {
+	if playersWithDice(g.Players) < 2 {
+		g.finish()
+	}
+}
+
+func (g *Game) finish() {
+	g.State = FINISHED
+	if w := winner(g.Players); w != nil {
+		g.setPlace(w.ID, 1)
+	}
+	g.emit(Event{Type: GAME_FINISHED, Winner: winner(g.Players), Seed: g.Roller.Seed})
+}
+
+// End the game before it has finished
+func (g *Game) Stop() {
+	if g.State != FINISHED {
 		g.State = FINISHED
+		g.emit(Event{Type: GAME_FINISHED, Seed: g.Roller.Seed})
 	}
+}
 
-	return result, nil
+// Remove all dice from a player who has left the game. The current round is restarted with new hands for the
+// remaining players.
+func (g *Game) EliminatePlayer(playerID int) error {
+	if g.State != STARTED {
+		return &GameError{"Game not started"}
+	}
+	idx := indexOfId(g.Players, playerID)
+	if idx < 0 || len(g.Players[idx].Hand) == 0 {
+		return &GameError{"Player not in game"}
+	}
+
+	g.Players[idx].lostDice(len(g.Players[idx].Hand))
+	g.updatePlaces()
+	info := g.Players[idx].Info
+	g.emit(Event{Type: PLAYER_ELIMINATED, Player: &info})
+	g.rollDice()
+	g.CurrentBid = Bid{}
+	g.Palifico = false
+
+	if idx == g.TurnIdx {
+		g.TurnIdx, _ = indexOfNextPlayerWithDice(g.Players, g.TurnIdx)
+	}
+	if playersWithDice(g.Players) < 2 {
+		g.finish()
+	}
+	return nil
+}
+
+// Give a finishing place to the players who have just run out of dice, and record the round they went out in
+func (g *Game) updatePlaces() {
+	n := playersWithDice(g.Players)
+	for _, p := range g.Players {
+		if _, found := g.Places[p.Info.ID]; !found && len(p.Hand) == 0 {
+			g.setPlace(p.Info.ID, n+1)
+			if g.OutRounds == nil {
+				g.OutRounds = make(map[int]int)
+			}
+			g.OutRounds[p.Info.ID] = g.Round
+		}
+	}
 }
 
-// Compare two bids: is b1 > b2?
+func (g *Game) setPlace(playerID int, place int) {
+	if g.Places == nil {
+		g.Places = make(map[int]int)
+	}
+	g.Places[playerID] = place
+}
+
+// Compare two bids with the default rules: is b1 > b2?
 func isGreater(b1 Bid, b2 Bid) bool {
-	return b1.score() > b2.score()
+	return Rules{}.isGreater(b1, b2)
 }
 
 // Find index of next Player with > 0 dice
@@ -264,14 +562,32 @@ func indexOfNextPlayerWithDice(players []Player, currentIndex int) (int, error)
 	return i, nil
 }
 
+// Get the number of players still having dice
+func playersWithDice(players []Player) int {
+	n := 0
+	for _, p := range players {
+		if len(p.Hand) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
 // Get total count of a dice value among players
-func totalCount(players []Player, value Dice) int {
+func totalCount(m diceMatcher, players []Player, value Dice) int {
 	c := 0
 	for _, p := range players {
-		for _, d := range p.Hand {
-			if d == value || d == WILD {
-				c++
-			}
+		c += handCount(m, p.Hand, value)
+	}
+	return c
+}
+
+// Get count of a dice value in a hand
+func handCount(m diceMatcher, hand []Dice, value Dice) int {
+	c := 0
+	for _, d := range hand {
+		if m.matches(d, value) {
+			c++
 		}
 	}
 	return c
@@ -561,3 +561,152 @@ func TestFindingNextPlayer(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestEliminatePlayer(t *testing.T) {
+	var g Game
+	g.State = STARTED
+	g.Players = []Player{
+		Player{PlayerInfo{1, "A"}, []Dice{ONE, ONE}},
+		Player{PlayerInfo{2, "B"}, []Dice{TWO}},
+		Player{PlayerInfo{3, "C"}, []Dice{THREE, THREE, THREE}}}
+	g.TurnIdx = 1
+	g.CurrentBid = Bid{1, ONE, 2}
+
+	if g.EliminatePlayer(2) != nil {
+		t.Fail()
+	}
+	if len(g.Players[1].Hand) != 0 || len(g.Players[0].Hand) != 2 || len(g.Players[2].Hand) != 3 {
+		t.Fail()
+	}
+	if g.TurnIdx != 2 || g.CurrentBid.Count != 0 || g.State != STARTED {
+		t.Fail()
+	}
+
+	// Eliminating a player not in turn
+	if g.EliminatePlayer(1) != nil {
+		t.Fail()
+	}
+	if g.TurnIdx != 2 || g.State != FINISHED {
+		t.Fail()
+	}
+}
+
+func TestEliminatePlayerNotInGame(t *testing.T) {
+	var g Game
+	g.State = STARTED
+	g.Players = []Player{
+		Player{PlayerInfo{1, "A"}, []Dice{ONE, ONE}},
+		Player{PlayerInfo{2, "B"}, []Dice{}}}
+	if g.EliminatePlayer(2) == nil {
+		t.Fail()
+	}
+	if g.EliminatePlayer(3) == nil {
+		t.Fail()
+	}
+}
+
+func TestCallExact(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    Rules
+		bid      Bid
+		hands    [][]Dice
+		result   BidClass
+		gained   int
+		lost     int
+		sizes    []int
+		turnIdx  int
+		finished bool
+	}{
+		// A has 2 fours counting the wild, B has 1
+		{"right", Rules{}, Bid{1, FOUR, 3}, [][]Dice{{WILD, FOUR, ONE, TWO, THREE}, {FOUR, ONE, TWO, TWO}}, EXACT_CALL_WON, 1, 0, []int{5, 5}, 1, false},
+		{"right, all dice", Rules{}, Bid{1, FOUR, 2}, [][]Dice{{WILD, ONE, TWO}, {FOUR, ONE, TWO, TWO, THREE}}, EXACT_CALL_WON, 0, 0, []int{3, 5}, 1, false},
+		{"wrong", Rules{}, Bid{1, FOUR, 2}, [][]Dice{{WILD, FOUR, ONE}, {FOUR, ONE, TWO}}, EXACT_CALL_LOST, 0, 1, []int{3, 2}, 1, false},
+		{"wrong, last dice", Rules{}, Bid{1, FOUR, 2}, [][]Dice{{WILD, FOUR, ONE}, {FOUR}}, EXACT_CALL_LOST, 0, 1, []int{3, 0}, 0, true},
+		{"perudo, right", Rules{Variant: PERUDO}, Bid{1, FOUR, 3}, [][]Dice{{WILD, FOUR}, {FOUR, ONE}}, EXACT_CALL_WON, 1, 0, []int{2, 3}, 1, false},
+	}
+	for _, tt := range tests {
+		var g Game
+		g.Rules = tt.rules
+		g.State = STARTED
+		g.Players = []Player{Player{PlayerInfo{1, "A"}, tt.hands[0]}, Player{PlayerInfo{2, "B"}, tt.hands[1]}}
+		g.TurnIdx = 1
+		g.CurrentBid = tt.bid
+		r, e := g.CallExact(2)
+		if e != nil {
+			t.Error(tt.name, e)
+			continue
+		}
+		if r.Result != tt.result || r.GainedDiceCount != tt.gained || r.LostDiceCount != tt.lost || r.Challenger.ID != 2 {
+			t.Error(tt.name, r)
+		}
+		if len(g.Players[0].Hand) != tt.sizes[0] || len(g.Players[1].Hand) != tt.sizes[1] {
+			t.Error(tt.name, len(g.Players[0].Hand), len(g.Players[1].Hand))
+		}
+		if g.TurnIdx != tt.turnIdx || (g.State == FINISHED) != tt.finished || g.CurrentBid.Count != 0 {
+			t.Error(tt.name, g.TurnIdx, g.State)
+		}
+	}
+}
+
+func TestCallExactPalifico(t *testing.T) {
+	g := perudoGame([]Dice{WILD, WILD, ONE}, []Dice{THREE, FOUR})
+	g.CurrentBid = Bid{1, THREE, 2}
+	g.TurnIdx = 1
+	if r, e := g.CallExact(2); e != nil || r.Result != EXACT_CALL_LOST {
+		t.Fatal(r, e)
+	}
+	if !g.Palifico || g.TurnIdx != 1 {
+		t.Error(g)
+	}
+}
+
+func TestCallExactWithoutBid(t *testing.T) {
+	var g Game
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	if _, e := g.CallExact(1); e == nil {
+		t.Fail()
+	}
+	g.StartGame()
+	if _, e := g.CallExact(1); e == nil {
+		t.Fail()
+	}
+	g.Bid(Bid{1, ONE, 1})
+	if _, e := g.CallExact(1); e == nil {
+		t.Fail()
+	}
+}
+
+func TestSpectators(t *testing.T) {
+	var g Game
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	if g.AddSpectator(PlayerInfo{1, "A"}) == nil {
+		t.Error("Player added as spectator")
+	}
+	if g.AddSpectator(PlayerInfo{3, "C"}) != nil || !g.IsSpectator(3) {
+		t.Fail()
+	}
+	if g.AddSpectator(PlayerInfo{3, "C"}) == nil {
+		t.Error("Spectator added twice")
+	}
+
+	// A spectator joining the game stops watching it
+	g.AddSpectator(PlayerInfo{4, "D"})
+	g.AddPlayer(PlayerInfo{4, "D"})
+	if g.IsSpectator(4) || len(g.Spectators) != 1 {
+		t.Error(g.Spectators)
+	}
+
+	// Players can watch once they are out of the game
+	g.StartGame()
+	g.Players[1].Hand = nil
+	if g.AddSpectator(PlayerInfo{1, "A"}) == nil || g.AddSpectator(PlayerInfo{2, "B"}) != nil {
+		t.Fail()
+	}
+
+	if g.RemoveSpectator(3) != nil || g.IsSpectator(3) || g.RemoveSpectator(3) == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,146 @@
+package bluff
+
+import (
+	"fmt"
+)
+
+// Number of faces on a Perudo dice that aren't aces
+const perudoNonAces = 5
+
+// perudoEngine implements the Perudo rules. The WILD face is the ace, and faces ONE to FIVE are the faces 2 to 6.
+type perudoEngine struct {
+	// In a palifico round aces aren't wild and the face of the first bid can't be changed
+	palifico bool
+}
+
+func (e perudoEngine) matches(d Dice, value Dice) bool {
+	return d == value || (d == WILD && !e.palifico)
+}
+
+func (e perudoEngine) matchProbability(value Dice) float64 {
+	if value == WILD || e.palifico {
+		return 1.0 / 6
+	}
+	return 2.0 / 6
+}
+
+func (e perudoEngine) checkBid(current Bid, b Bid) error {
+	if err := checkBidDice(Rules{Variant: PERUDO}, b); err != nil {
+		return err
+	}
+
+	if e.palifico {
+		if current.Count > 0 && b.Dice != current.Dice {
+			return &GameError{"The face can't be changed in a palifico round"}
+		}
+		if b.Count <= current.Count {
+			return &GameError{"You must make a higher bid than the current one"}
+		}
+		return nil
+	}
+
+	if current.Count == 0 && b.Dice == WILD {
+		return &GameError{"The first bid of a round can't be on aces"}
+	}
+	if perudoScore(b) <= perudoScore(current) {
+		switch {
+		case b.Dice == WILD && current.Dice != WILD:
+			return &GameError{fmt.Sprintf("You must bid at least %v aces", (current.Count+1)/2)}
+		case b.Dice != WILD && current.Dice == WILD:
+			return &GameError{fmt.Sprintf("You must bid at least %v dice when switching from aces", 2*current.Count+1)}
+		}
+		return &GameError{"You must make a higher bid than the current one"}
+	}
+	return nil
+}
+
+func (e perudoEngine) successor(b Bid) Bid {
+	if e.palifico {
+		// Aces are a face like any other
+		return Rules{NoWilds: true}.nextBid(b)
+	}
+	return perudoBidFromScore(perudoScore(b) + 1)
+}
+
+// The loser of a challenge loses one dice and starts the next round. The next round is a palifico round if the
+// loser dropped to one dice for the first time.
+func (e perudoEngine) resolveChallenge(g *Game, actualCount int) ChallengeResult {
+	bidderIdx := indexOfId(g.Players, g.CurrentBid.PlayerID)
+	result := ChallengeResult{
+		ChallengedBid: g.CurrentBid,
+		Bidder:        g.Players[bidderIdx].Info,
+		Challenger:    g.Players[g.TurnIdx].Info,
+		LostDiceCount: 1}
+
+	loserIdx := g.TurnIdx
+	if actualCount < g.CurrentBid.Count {
+		loserIdx = bidderIdx
+		result.Result = HIGH_BID
+	} else {
+		result.Result = LOW_BID
+	}
+
+	g.Players[loserIdx].lostDice(1)
+	g.TurnIdx = loserIdx
+	if len(g.Players[loserIdx].Hand) == 0 {
+		g.TurnIdx, _ = indexOfNextPlayerWithDice(g.Players, loserIdx)
+	}
+	startPalifico(g, loserIdx)
+	return result
+}
+
+// The caller starts the next round. A wrong call can start a palifico round like a lost challenge.
+func (e perudoEngine) resolveExactCall(g *Game, actualCount int) ChallengeResult {
+	callerIdx := g.TurnIdx
+	result := settleExactCall(g, actualCount)
+	g.Palifico = false
+	if result.Result == EXACT_CALL_LOST {
+		startPalifico(g, callerIdx)
+	}
+	return result
+}
+
+// Make the next round a palifico round if the player who lost a dice dropped to one dice for the first time
+func startPalifico(g *Game, loserIdx int) {
+	loser := g.Players[loserIdx]
+	g.Palifico = len(loser.Hand) == 1 && !containsID(g.PalificoPlayers, loser.Info.ID)
+	if g.Palifico {
+		g.PalificoPlayers = append(g.PalificoPlayers, loser.Info.ID)
+	}
+}
+
+// Calculate score from bid to enable comparing bids. The ace bids of count n are placed between the bids of
+// counts 2n and 2n+1, so that switching to aces halves the count (rounded up) and switching from aces doubles it
+// plus one.
+func perudoScore(b Bid) int {
+	if b.Count <= 0 {
+		return 0
+	}
+	if b.Dice == WILD {
+		return b.Count * (2*perudoNonAces + 1)
+	}
+	aces := (b.Count - 1) / 2
+	return (b.Count-1)*perudoNonAces + int(b.Dice) + aces
+}
+
+// Construct a bid from score value
+func perudoBidFromScore(score int) Bid {
+	if score <= 0 {
+		return Bid{Count: 0, Dice: ONE}
+	}
+	aces, acesRem := divmod(score, 2*perudoNonAces+1)
+	if acesRem == 0 {
+		return Bid{Count: aces, Dice: WILD}
+	}
+	count, face := divmod(score-aces-1, perudoNonAces)
+	return Bid{Count: count + 1, Dice: Dice(face + 1)}
+}
+
+func containsID(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
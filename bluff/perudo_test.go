@@ -0,0 +1,210 @@
+package bluff
+
+import (
+	"testing"
+)
+
+func TestPerudoScoreRoundTrip(t *testing.T) {
+	for score := 1; score < 1000; score++ {
+		b := perudoBidFromScore(score)
+		if perudoScore(b) != score || b.Count < 1 || b.Dice < WILD || b.Dice > FIVE {
+			t.Error(score, b)
+		}
+	}
+}
+
+func TestPerudoBids(t *testing.T) {
+	tests := []struct {
+		palifico bool
+		current  Bid
+		b        Bid
+		valid    bool
+	}{
+		{false, Bid{}, Bid{1, ONE, 1}, true},
+		{false, Bid{}, Bid{1, WILD, 1}, false},
+		{false, Bid{1, THREE, 4}, Bid{1, FOUR, 4}, true},
+		{false, Bid{1, THREE, 4}, Bid{1, TWO, 4}, false},
+		{false, Bid{1, THREE, 4}, Bid{1, ONE, 5}, true},
+		// Switching to aces halves the count, rounded up
+		{false, Bid{1, THREE, 4}, Bid{1, WILD, 2}, true},
+		{false, Bid{1, THREE, 4}, Bid{1, WILD, 1}, false},
+		{false, Bid{1, THREE, 5}, Bid{1, WILD, 3}, true},
+		{false, Bid{1, THREE, 5}, Bid{1, WILD, 2}, false},
+		// Switching from aces doubles the count plus one
+		{false, Bid{1, WILD, 2}, Bid{1, ONE, 5}, true},
+		{false, Bid{1, WILD, 2}, Bid{1, FIVE, 4}, false},
+		{false, Bid{1, WILD, 2}, Bid{1, WILD, 3}, true},
+		// Palifico: aces can be bid first, and the face is locked
+		{true, Bid{}, Bid{1, WILD, 1}, true},
+		{true, Bid{1, THREE, 2}, Bid{1, THREE, 3}, true},
+		{true, Bid{1, THREE, 2}, Bid{1, FOUR, 2}, false},
+		{true, Bid{1, THREE, 2}, Bid{1, FOUR, 3}, false},
+		{true, Bid{1, THREE, 2}, Bid{1, WILD, 3}, false},
+		{true, Bid{1, THREE, 2}, Bid{1, THREE, 2}, false},
+	}
+	for _, tt := range tests {
+		e := Rules{Variant: PERUDO}.engine(tt.palifico)
+		if (e.checkBid(tt.current, tt.b) == nil) != tt.valid {
+			t.Error(tt)
+		}
+	}
+}
+
+func TestPerudoValidBidsAbove(t *testing.T) {
+	e := Rules{Variant: PERUDO}.engine(false)
+	for _, b := range validBidsAbove(e, Bid{}, 16) {
+		if b.Dice == WILD {
+			t.Error(b)
+		}
+	}
+	bids := validBidsAbove(e, Bid{1, FIVE, 2}, 2)
+	if bids[0] != (Bid{Dice: WILD, Count: 1}) || bids[1] != (Bid{Dice: ONE, Count: 3}) {
+		t.Error(bids)
+	}
+
+	e = Rules{Variant: PERUDO}.engine(true)
+	for i, b := range validBidsAbove(e, Bid{1, TWO, 1}, 4) {
+		if b != (Bid{Dice: TWO, Count: i + 2}) {
+			t.Error(b)
+		}
+	}
+}
+
+func perudoGame(hands ...[]Dice) *Game {
+	g := &Game{State: STARTED, Rules: Rules{Variant: PERUDO}}
+	for i, h := range hands {
+		g.Players = append(g.Players, Player{PlayerInfo{i + 1, string(rune('A' + i))}, h})
+	}
+	return g
+}
+
+func TestPerudoChallenge(t *testing.T) {
+	// A has 2 fours counting the ace, B has 1
+	tests := []struct {
+		name    string
+		bid     Bid
+		result  BidClass
+		hands   []int
+		turnIdx int
+	}{
+		{"low", Bid{1, FOUR, 2}, LOW_BID, []int{5, 4}, 1},
+		{"exact", Bid{1, FOUR, 3}, LOW_BID, []int{5, 4}, 1},
+		{"high", Bid{1, FOUR, 4}, HIGH_BID, []int{4, 5}, 0},
+	}
+	for _, tt := range tests {
+		g := perudoGame(
+			[]Dice{WILD, FOUR, ONE, TWO, THREE},
+			[]Dice{FOUR, ONE, TWO, TWO, FIVE})
+		g.TurnIdx = 1
+		g.CurrentBid = tt.bid
+		r, e := g.ChallengeCurrentBid(2)
+		if e != nil {
+			t.Error(tt.name, e)
+			continue
+		}
+		if r.Result != tt.result || r.LostDiceCount != 1 {
+			t.Error(tt.name, r)
+		}
+		if len(g.Players[0].Hand) != tt.hands[0] || len(g.Players[1].Hand) != tt.hands[1] {
+			t.Error(tt.name, len(g.Players[0].Hand), len(g.Players[1].Hand))
+		}
+		// The loser starts the next round
+		if g.TurnIdx != tt.turnIdx {
+			t.Error(tt.name, g.TurnIdx)
+		}
+		if g.Palifico {
+			t.Error(tt.name)
+		}
+	}
+}
+
+func TestPerudoPalifico(t *testing.T) {
+	g := perudoGame([]Dice{WILD, WILD}, []Dice{THREE, FOUR}, []Dice{FOUR, FIVE})
+
+	// A drops to one dice and gets a palifico round
+	g.CurrentBid = Bid{1, THREE, 5}
+	g.TurnIdx = 1
+	if _, e := g.ChallengeCurrentBid(2); e != nil {
+		t.Fatal(e)
+	}
+	if !g.Palifico || g.TurnIdx != 0 || len(g.Players[0].Hand) != 1 {
+		t.Fatal(g)
+	}
+
+	// Aces aren't wild in the palifico round
+	g.Players[0].Hand = []Dice{WILD}
+	g.Players[1].Hand = []Dice{THREE, FOUR}
+	g.Players[2].Hand = []Dice{FOUR, FIVE}
+	if g.Bid(Bid{1, FOUR, 2}) != nil {
+		t.Fatal(g)
+	}
+	if g.Bid(Bid{2, FIVE, 3}) == nil {
+		t.Error(g.CurrentBid)
+	}
+	if g.Bid(Bid{2, FOUR, 3}) != nil {
+		t.Fatal(g)
+	}
+	r, e := g.ChallengeCurrentBid(3)
+	if e != nil || r.Result != HIGH_BID {
+		t.Fatal(r, e)
+	}
+
+	// B drops to one dice, the next round is palifico again
+	if !g.Palifico || g.TurnIdx != 1 {
+		t.Fatal(g)
+	}
+
+	// No palifico when the loser has more than one dice left
+	g.Players[0].Hand = []Dice{WILD}
+	g.Players[1].Hand = []Dice{FOUR}
+	g.Players[2].Hand = []Dice{FOUR, FIVE, FIVE}
+	g.Bid(Bid{2, FOUR, 1})
+	if r, _ := g.ChallengeCurrentBid(3); r.Result != LOW_BID || g.Palifico || g.TurnIdx != 2 {
+		t.Fatal(r, g)
+	}
+
+	// A drops to one dice again, but has already had a palifico round. Aces are wild again.
+	g.Players[0].Hand = []Dice{ONE, ONE}
+	g.Players[1].Hand = []Dice{ONE}
+	g.Players[2].Hand = []Dice{FOUR, WILD}
+	g.Bid(Bid{3, FOUR, 1})
+	g.Bid(Bid{1, FOUR, 3})
+	if r, _ := g.ChallengeCurrentBid(2); r.Result != HIGH_BID || g.Palifico || len(g.Players[0].Hand) != 1 {
+		t.Fatal(r, g)
+	}
+}
+
+func TestPerudoEliminatedLoserPassesTurn(t *testing.T) {
+	g := perudoGame([]Dice{ONE}, []Dice{TWO}, []Dice{THREE})
+	g.PalificoPlayers = []int{1, 2, 3}
+	g.CurrentBid = Bid{1, FIVE, 2}
+	g.TurnIdx = 1
+	if _, e := g.ChallengeCurrentBid(2); e != nil {
+		t.Fatal(e)
+	}
+	if len(g.Players[0].Hand) != 0 || g.TurnIdx != 1 || g.State != STARTED || g.Palifico {
+		t.Error(g)
+	}
+}
+
+func TestPerudoDiceStrings(t *testing.T) {
+	r := Rules{Variant: PERUDO}
+	for d := WILD; d <= FIVE; d++ {
+		p, err := r.parseDice(r.diceString(d))
+		if err != nil || p != d {
+			t.Error(d, p, err)
+		}
+	}
+	if d, _ := r.parseDice("1"); d != WILD {
+		t.Error(d)
+	}
+	if d, _ := r.parseDice("6"); d != FIVE {
+		t.Error(d)
+	}
+	if _, err := r.parseDice("*"); err == nil {
+		t.Fail()
+	}
+	if _, err := r.parseDice("7"); err == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,118 @@
+package bluff
+
+import (
+	"math"
+	"sort"
+)
+
+// Rating of a player who hasn't played any rated games
+const initialRating = 1500
+
+// How much a single game can change a rating
+const ratingK = 32
+
+// Calculate the new ratings of the players of a game with the Elo system generalized to many players. Every player
+// is compared with every other player: outlasting a player counts as a win against them, and going out in the same
+// round counts as a draw. rounds[i] is the number of rounds player i lasted.
+func updateRatings(ratings []float64, rounds []int) []float64 {
+	updated := append([]float64{}, ratings...)
+	n := len(ratings)
+	if n < 2 {
+		return updated
+	}
+	for i := range ratings {
+		delta := 0.0
+		for j := range ratings {
+			if i != j {
+				delta += pairScore(rounds[i], rounds[j]) - expectedScore(ratings[i], ratings[j])
+			}
+		}
+		updated[i] += ratingK * delta / float64(n-1)
+	}
+	return updated
+}
+
+// Expected score of a player rated a against a player rated b, between 0 and 1
+func expectedScore(a float64, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Score of a player who lasted a rounds against a player who lasted b rounds
+func pairScore(a int, b int) float64 {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return 0
+	}
+	return 0.5
+}
+
+// Current rating of the player
+func (s PlayerStats) rating() float64 {
+	if s.RatedGames == 0 {
+		return initialRating
+	}
+	return s.Rating
+}
+
+// Update the ratings of the players of a finished game. Computer-controlled players aren't rated, so a game changes
+// the ratings only if it had at least two human players.
+func recordRatings(stats map[int]PlayerStats, g *Game) {
+	var players []PlayerInfo
+	var ratings []float64
+	var rounds []int
+	for _, p := range g.Players {
+		if !g.IsAI(p.Info.ID) {
+			players = append(players, p.Info)
+			ratings = append(ratings, stats[p.Info.ID].rating())
+			rounds = append(rounds, roundsLasted(g, p.Info.ID))
+		}
+	}
+	if len(players) < 2 {
+		return
+	}
+
+	for i, r := range updateRatings(ratings, rounds) {
+		s := stats[players[i].ID]
+		s.Name = players[i].Name
+		s.Rating = r
+		s.RatedGames++
+		stats[players[i].ID] = s
+	}
+}
+
+// Number of rounds a player lasted in a finished game. The winner outlasts everyone.
+func roundsLasted(g *Game, playerID int) int {
+	if r, found := g.OutRounds[playerID]; found {
+		return r
+	}
+	return g.Round + 1
+}
+
+// Sort the rated players by their rating, the highest first
+func ratingList(stats map[int]PlayerStats) []PlayerStats {
+	var list []PlayerStats
+	for _, s := range stats {
+		if s.RatedGames > 0 {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Rating != list[j].Rating {
+			return list[i].Rating > list[j].Rating
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Order players for seeding a tournament bracket, the highest rated first. Players without rated games get the
+// initial rating, and players with equal ratings keep their order.
+func SeedByRating(players []PlayerInfo, stats map[int]PlayerStats) []PlayerInfo {
+	seeded := append([]PlayerInfo{}, players...)
+	sort.SliceStable(seeded, func(i, j int) bool {
+		return stats[seeded[i].ID].rating() > stats[seeded[j].ID].rating()
+	})
+	return seeded
+}
@@ -0,0 +1,218 @@
+package bluff
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestExpectedScore(t *testing.T) {
+	var tests = []struct {
+		a, b     float64
+		expected float64
+	}{
+		{1500, 1500, 0.5},
+		{1900, 1500, 10.0 / 11},
+		{1500, 1900, 1.0 / 11},
+		{1600, 1400, 0.76},
+	}
+
+	for _, test := range tests {
+		if e := expectedScore(test.a, test.b); !near(e, test.expected) {
+			t.Error(test, e)
+		}
+	}
+}
+
+func TestUpdateRatings(t *testing.T) {
+	var tests = []struct {
+		ratings  []float64
+		rounds   []int
+		expected []float64
+	}{
+		// Equal players: the winner takes half of K from the loser
+		{[]float64{1500, 1500}, []int{5, 4}, []float64{1516, 1484}},
+		// A draw between equal players changes nothing
+		{[]float64{1500, 1500}, []int{4, 4}, []float64{1500, 1500}},
+		// An upset moves the ratings more than an expected result
+		{[]float64{1400, 1600}, []int{5, 4}, []float64{1424.31, 1575.69}},
+		{[]float64{1600, 1400}, []int{5, 4}, []float64{1607.69, 1392.31}},
+		// The middle of three equal players wins one and loses one
+		{[]float64{1500, 1500, 1500}, []int{3, 7, 5}, []float64{1484, 1516, 1500}},
+		// Two players going out in the same round draw against each other
+		{[]float64{1500, 1500, 1500}, []int{3, 3, 5}, []float64{1492, 1492, 1516}},
+		// A single player can't be rated
+		{[]float64{1500}, []int{1}, []float64{1500}},
+	}
+
+	for _, test := range tests {
+		updated := updateRatings(test.ratings, test.rounds)
+		sum, sumBefore := 0.0, 0.0
+		for i := range updated {
+			if !near(updated[i], test.expected[i]) {
+				t.Error(test, updated)
+			}
+			sum += updated[i]
+			sumBefore += test.ratings[i]
+		}
+		// The points are only moved between the players
+		if !near(sum, sumBefore) {
+			t.Error(test, updated)
+		}
+	}
+}
+
+func TestOutRounds(t *testing.T) {
+	g := Game{}
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.AddPlayer(PlayerInfo{3, "C"})
+	g.StartGame()
+	if g.Round != 1 {
+		t.Error(g.Round)
+	}
+
+	g.EliminatePlayer(3)
+	g.Players[0].Hand = []Dice{ONE}
+	g.Players[1].Hand = []Dice{TWO}
+	g.CurrentBid = Bid{PlayerID: 1, Dice: ONE, Count: 1}
+	g.TurnIdx = 1
+	g.ChallengeCurrentBid(2)
+	if g.State != FINISHED || g.Round != 3 || !reflect.DeepEqual(g.OutRounds, map[int]int{2: 2, 3: 1}) {
+		t.Error(g.Round, g.OutRounds)
+	}
+	if roundsLasted(&g, 1) != 4 || roundsLasted(&g, 2) != 2 {
+		t.Error(g.OutRounds)
+	}
+}
+
+func TestRecordRatings(t *testing.T) {
+	g := Game{
+		State: FINISHED,
+		Players: []Player{
+			Player{PlayerInfo{1, "A"}, []Dice{ONE}},
+			Player{PlayerInfo{2, "B"}, []Dice{}},
+			Player{PlayerInfo{-1, "Bot"}, []Dice{}},
+			Player{PlayerInfo{3, "C"}, []Dice{}},
+		},
+		AIPlayers: map[int]string{-1: NORMAL},
+		Round:     9,
+		OutRounds: map[int]int{2: 8, -1: 6, 3: 3},
+	}
+	stats := map[int]PlayerStats{2: PlayerStats{Name: "B", Rating: 1600, RatedGames: 10}}
+	recordRatings(stats, &g)
+
+	if _, found := stats[-1]; found || len(stats) != 3 {
+		t.Fatal(stats)
+	}
+	if stats[1].RatedGames != 1 || stats[2].RatedGames != 11 || stats[3].RatedGames != 1 {
+		t.Error(stats)
+	}
+	if !(stats[1].Rating > 1500 && stats[2].Rating < 1600 && stats[3].Rating < 1500) {
+		t.Error(stats)
+	}
+	if !near(stats[1].Rating+stats[2].Rating+stats[3].Rating, 4600) {
+		t.Error(stats)
+	}
+
+	// A game against computer-controlled players only isn't rated
+	g.AIPlayers = map[int]string{-1: NORMAL, 2: NORMAL, 3: NORMAL}
+	before := copyStats(stats)
+	recordRatings(stats, &g)
+	if !reflect.DeepEqual(stats, before) {
+		t.Error(stats)
+	}
+}
+
+func TestSeedByRating(t *testing.T) {
+	players := []PlayerInfo{PlayerInfo{1, "A"}, PlayerInfo{2, "B"}, PlayerInfo{3, "C"}, PlayerInfo{4, "D"}}
+	stats := map[int]PlayerStats{
+		2: PlayerStats{Rating: 1450, RatedGames: 3},
+		3: PlayerStats{Rating: 1700, RatedGames: 3},
+		4: PlayerStats{Rating: 1500, RatedGames: 1},
+	}
+	seeded := SeedByRating(players, stats)
+	if !reflect.DeepEqual(seeded, []PlayerInfo{PlayerInfo{3, "C"}, PlayerInfo{1, "A"}, PlayerInfo{4, "D"}, PlayerInfo{2, "B"}}) {
+		t.Error(seeded)
+	}
+}
+
+// Play a game with one dice per player where bob challenges alice's bid and wins
+func playRatedGame(tg *Telegram, chatID int, alice telegram.User, bob telegram.User) {
+	tg.HandleUpdate(update(chatID, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(tg.Bot(), chatID)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(tg.Bot(), chatID)))
+	tg.HandleUpdate(update(chatID, alice, rulesCmd+" dice 1"))
+	g, _ := onlyGame(tg.Bot(), chatID)
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{TWO}})
+	tg.HandleUpdate(update(chatID, alice, beginCmd))
+	tg.HandleUpdate(update(chatID, alice, bidCmd+" 1 3"))
+	tg.HandleUpdate(update(chatID, bob, challengeCmd))
+}
+
+func TestRatingCmd(t *testing.T) {
+	var r msgRecorder
+	tg, _ := newTelegramBot(&r)
+	username := "alice_w"
+	alice := telegram.User{ID: 1, FirstName: "Alice", Username: &username}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+
+	tg.HandleUpdate(update(-100, alice, ratingCmd))
+	if r.count(-100, "No rated games in this chat yet") != 1 {
+		t.Error(r.messages)
+	}
+
+	playRatedGame(tg, -100, alice, bob)
+	playRatedGame(tg, -200, alice, bob)
+
+	tg.HandleUpdate(update(-100, alice, ratingCmd))
+	if r.count(-100, "Ratings in this chat:\n1. Bob: 1516 (1 games)\n2. Alice: 1484 (1 games)") != 1 {
+		t.Error(r.messages)
+	}
+
+	// Ratings are kept per chat and over all chats
+	tg.HandleUpdate(update(-200, bob, ratingCmd+" @alice_w"))
+	if r.count(-200, "Alice has rating 1484 in this chat after 1 games, and 1469 in all chats after 2 games.") != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(-200, bob, ratingCmd+" carol"))
+	if r.count(-200, "No rated games for carol in this chat yet") != 1 {
+		t.Error(r.messages)
+	}
+}
+
+func TestSeedCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	carol := telegram.User{ID: 3, FirstName: "Carol"}
+	playRatedGame(tg, -100, alice, bob)
+
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(carol.ID, carol, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, seedCmd))
+	if r.count(-100, "Players seeded by their ratings in this chat:\n1. Bob: 1516\n2. Carol: 1500\n3. Alice: 1484") != 1 {
+		t.Error(r.messages)
+	}
+	g, _ := onlyGame(b, -100)
+	if g.Players[0].Info != (PlayerInfo{bob.ID, "Bob"}) || g.Players[2].Info != (PlayerInfo{alice.ID, "Alice"}) {
+		t.Error(g.Players)
+	}
+
+	// The players can't be moved once the game has begun
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	tg.HandleUpdate(update(-100, alice, seedCmd))
+	if r.count(-100, "Can't change the order of the players when the game has already started") != 1 {
+		t.Error(r.messages)
+	}
+}
@@ -0,0 +1,193 @@
+package bluff
+
+import (
+	"fmt"
+)
+
+// Replayer rebuilds a game from its events. Every move is replayed through the game rules, so an event log that
+// doesn't follow the rules is detected.
+type Replayer struct {
+	Game *Game
+	// All the dice rolled in the game, in the order they were rolled
+	rolls []Dice
+}
+
+func NewReplayer() *Replayer {
+	return &Replayer{Game: &Game{}}
+}
+
+// Apply the next event of the game
+func (r *Replayer) Apply(e Event) error {
+	g := r.Game
+	if e.Seq != g.EventSeq+1 {
+		return fmt.Errorf("Event %v: expected sequence number %v", e.Seq, g.EventSeq+1)
+	}
+	g.EventSeq = e.Seq
+
+	switch e.Type {
+	case PLAYER_JOINED:
+		if e.Player == nil {
+			return fmt.Errorf("Event %v: no player", e.Seq)
+		}
+		return g.addPlayer(*e.Player, e.Difficulty)
+	case GAME_STARTED:
+		if e.Rules != nil {
+			if err := g.SetRules(*e.Rules); err != nil {
+				return err
+			}
+		}
+		return g.StartGame()
+	case HANDS_ROLLED:
+		// Replace the hands rolled by the replayed game with the logged ones
+		for i, p := range g.Players {
+			if len(e.Hands[p.Info.ID]) != len(p.Hand) {
+				return fmt.Errorf("Event %v: %v should have %v dice", e.Seq, p.Info.Name, len(p.Hand))
+			}
+			g.Players[i].Hand = append([]Dice{}, e.Hands[p.Info.ID]...)
+			r.rolls = append(r.rolls, g.Players[i].Hand...)
+		}
+	case BID_MADE:
+		if e.Bid == nil {
+			return fmt.Errorf("Event %v: no bid", e.Seq)
+		}
+		return g.Bid(*e.Bid)
+	case CHALLENGE_MADE:
+		if e.Result == nil {
+			return fmt.Errorf("Event %v: no result", e.Seq)
+		}
+		var result ChallengeResult
+		var err error
+		if e.Result.Result == EXACT_CALL_WON || e.Result.Result == EXACT_CALL_LOST {
+			result, err = g.CallExact(e.Result.Challenger.ID)
+		} else {
+			result, err = g.ChallengeCurrentBid(e.Result.Challenger.ID)
+		}
+		if err != nil {
+			return err
+		}
+		if result != *e.Result {
+			return fmt.Errorf("Event %v: logged result %+v, but the dice give %+v", e.Seq, *e.Result, result)
+		}
+	case PLAYER_ELIMINATED:
+		if e.Player == nil {
+			return fmt.Errorf("Event %v: no player", e.Seq)
+		}
+		return g.EliminatePlayer(e.Player.ID)
+	case GAME_FINISHED:
+		if e.Winner != nil && g.State != FINISHED {
+			return fmt.Errorf("Event %v: game finished before the last player was out", e.Seq)
+		}
+		g.State = FINISHED
+		if e.Seed != nil {
+			return r.verifyRolls(e)
+		}
+	default:
+		return fmt.Errorf("Event %v: unknown type %v", e.Seq, e.Type)
+	}
+	return nil
+}
+
+// Check that re-rolling the dice from the seed revealed at the end of the game gives the logged hands
+func (r *Replayer) verifyRolls(e Event) error {
+	roller := NewSeededRoller(e.Seed)
+	for i, d := range r.rolls {
+		if roller.Roll(r.Game.Rules.faces()) != d {
+			return fmt.Errorf("Event %v: dice %v of the game doesn't match the seed", e.Seq, i+1)
+		}
+	}
+	return nil
+}
+
+// Describe an event for a reader. Call before applying the event, so that it can be described in the context of the
+// game state before it.
+func (r *Replayer) Describe(e Event) string {
+	g := r.Game
+	switch e.Type {
+	case PLAYER_JOINED:
+		if e.Player == nil {
+			break
+		}
+		if e.Difficulty != "" {
+			return fmt.Sprintf("%v joined, computer-controlled (%v)", e.Player.Name, e.Difficulty)
+		}
+		return fmt.Sprintf("%v joined", e.Player.Name)
+	case GAME_STARTED:
+		if e.Rules == nil {
+			return "Game started"
+		}
+		return fmt.Sprintf("Game started. Rules: %v.", *e.Rules)
+	case HANDS_ROLLED:
+		s := "New hands:"
+		for _, p := range g.Players {
+			if h, found := e.Hands[p.Info.ID]; found {
+				s += fmt.Sprintf(" %v [%v]", p.Info.Name, r.handString(h))
+			}
+		}
+		return s
+	case BID_MADE:
+		if e.Bid == nil {
+			break
+		}
+		s := fmt.Sprintf("%v bid %v", r.name(e.Bid.PlayerID), r.bidString(*e.Bid))
+		if g.CurrentBid.Count > 0 {
+			s += fmt.Sprintf(" on top of %v's %v", r.name(g.CurrentBid.PlayerID), r.bidString(g.CurrentBid))
+		}
+		return s
+	case CHALLENGE_MADE:
+		if e.Result == nil {
+			break
+		}
+		res := e.Result
+		action := "challenged"
+		if res.Result == EXACT_CALL_WON || res.Result == EXACT_CALL_LOST {
+			action = "called exact"
+		}
+		s := fmt.Sprintf("%v %v %v's bid of %v, there were %v.", res.Challenger.Name, action, res.Bidder.Name, r.bidString(res.ChallengedBid), e.ActualCount)
+		switch res.Result {
+		case LOW_BID:
+			s += fmt.Sprintf(" %v loses %v dice.", res.Challenger.Name, res.LostDiceCount)
+		case EXACT_BID:
+			s += fmt.Sprintf(" Exactly right, %v dice lost.", res.LostDiceCount)
+		case HIGH_BID:
+			s += fmt.Sprintf(" %v loses %v dice.", res.Bidder.Name, res.LostDiceCount)
+		case EXACT_CALL_WON:
+			s += fmt.Sprintf(" %v gets back %v dice.", res.Challenger.Name, res.GainedDiceCount)
+		case EXACT_CALL_LOST:
+			s += fmt.Sprintf(" %v loses %v dice.", res.Challenger.Name, res.LostDiceCount)
+		}
+		return s
+	case PLAYER_ELIMINATED:
+		if e.Player == nil {
+			break
+		}
+		return fmt.Sprintf("%v is out of the game", e.Player.Name)
+	case GAME_FINISHED:
+		if e.Winner == nil {
+			return "Game stopped"
+		}
+		return fmt.Sprintf("Game finished, %v is the winner", e.Winner.Name)
+	}
+	return fmt.Sprintf("Invalid %v event", e.Type)
+}
+
+func (r *Replayer) name(playerID int) string {
+	if i := indexOfId(r.Game.Players, playerID); i >= 0 {
+		return r.Game.Players[i].Info.Name
+	}
+	return fmt.Sprintf("Player %v", playerID)
+}
+
+func (r *Replayer) bidString(b Bid) string {
+	return fmt.Sprintf("%v %vs", b.Count, r.Game.Rules.FaceName(b.Dice))
+}
+
+func (r *Replayer) handString(hand []Dice) string {
+	s := ""
+	for i, d := range hand {
+		if i > 0 {
+			s += " "
+		}
+		s += r.Game.Rules.FaceName(d)
+	}
+	return s
+}
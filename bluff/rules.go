@@ -0,0 +1,478 @@
+package bluff
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type LossRule int
+
+const (
+	// The loser of a challenge loses the difference between the bid and the actual count
+	DIFFERENCE_LOSS LossRule = iota
+	// The loser of a challenge loses one dice
+	ONE_DICE_LOSS
+)
+
+type ExactBidRule int
+
+const (
+	// When the bid was exactly right, everyone except the bidder loses one dice
+	OTHERS_LOSE_ONE ExactBidRule = iota
+	// When the bid was exactly right, the challenger loses one dice
+	CHALLENGER_LOSES_ONE
+)
+
+type Variant int
+
+const (
+	// The rules of this bot, adjustable with the other fields of Rules
+	CLASSIC Variant = iota
+	// Perudo: six-sided dice with ones (aces) wild, one dice lost per challenge and palifico rounds
+	PERUDO
+)
+
+// Rules of a game. The zero value is the classic rule set of this bot: five six-sided dice per player, with the
+// wild face counting toward every face.
+type Rules struct {
+	// Number of dice each player starts with. Zero means N_DICE_PER_PLAYER.
+	DicePerPlayer int
+	// Number of faces on a dice, including the wild face. Zero means DEFAULT_FACES.
+	Faces int
+	// Don't count the wild face toward the other faces. It's then a face like any other, ranked highest in bids.
+	NoWilds bool
+	Loss    LossRule
+	Exact   ExactBidRule
+	// With PERUDO, only DicePerPlayer can be changed
+	Variant Variant
+}
+
+const DEFAULT_FACES = 6
+
+// Allowed number of faces. Faces are displayed as *, 1, 2, ..., 9.
+const MIN_FACES = 2
+const MAX_FACES = 10
+
+// Allowed number of dice per player
+const MAX_DICE_PER_PLAYER = 20
+
+func (r Rules) dicePerPlayer() int {
+	if r.DicePerPlayer == 0 {
+		return N_DICE_PER_PLAYER
+	}
+	return r.DicePerPlayer
+}
+
+func (r Rules) faces() int {
+	if r.Faces == 0 {
+		return DEFAULT_FACES
+	}
+	return r.Faces
+}
+
+// Check that the rules describe a playable game
+func (r Rules) validate() error {
+	if r.dicePerPlayer() < 1 || r.dicePerPlayer() > MAX_DICE_PER_PLAYER {
+		return &GameError{fmt.Sprintf("Number of dice must be between 1 and %v", MAX_DICE_PER_PLAYER)}
+	}
+	if r.faces() < MIN_FACES || r.faces() > MAX_FACES {
+		return &GameError{fmt.Sprintf("Number of faces must be between %v and %v", MIN_FACES, MAX_FACES)}
+	}
+	if r.Variant == PERUDO && r != (Rules{DicePerPlayer: r.DicePerPlayer, Variant: PERUDO}) {
+		return &GameError{"Only the number of dice can be changed in Perudo"}
+	}
+	return nil
+}
+
+// Get the rule engine for the rules. palifico tells whether the current round is a Perudo palifico round.
+func (r Rules) engine(palifico bool) ruleEngine {
+	if r.Variant == PERUDO {
+		return perudoEngine{palifico}
+	}
+	return classicEngine{r}
+}
+
+// Is d one of the faces of a dice?
+func (r Rules) validDice(d Dice) bool {
+	return d >= WILD && int(d) < r.faces()
+}
+
+// Does dice d count toward value?
+func (r Rules) matches(d Dice, value Dice) bool {
+	return d == value || (d == WILD && !r.NoWilds)
+}
+
+// Probability that a single unknown dice counts toward value
+func (r Rules) matchProbability(value Dice) float64 {
+	if value == WILD || r.NoWilds {
+		return 1 / float64(r.faces())
+	}
+	return 2 / float64(r.faces())
+}
+
+// Calculate score from bid to enable comparing bids. With wilds, the wild bids of count n are placed between the
+// bids of counts 2n-1 and 2n. Without wilds, the wild face is ranked above all the other faces.
+func (r Rules) score(b Bid) int {
+	if b.Count <= 0 {
+		return 0
+	}
+	if r.NoWilds {
+		rank := int(b.Dice)
+		if b.Dice == WILD {
+			rank = r.faces()
+		}
+		return (b.Count-1)*r.faces() + rank
+	}
+	nonWild := r.faces() - 1
+	if b.Dice == WILD {
+		return (2*b.Count-1)*nonWild + b.Count
+	}
+	// Leave "space" for stars
+	stars := b.Count / 2
+	return (b.Count-1)*nonWild + int(b.Dice) + stars
+}
+
+// Construct a bid from score value
+func (r Rules) bidFromScore(score int) Bid {
+	if score <= 0 {
+		return Bid{Count: 0, Dice: ONE}
+	}
+	if r.NoWilds {
+		count, rank := divmod(score, r.faces())
+		if rank == 0 {
+			return Bid{Count: count, Dice: WILD}
+		}
+		return Bid{Count: count + 1, Dice: Dice(rank)}
+	}
+	nonWild := r.faces() - 1
+	stars, starsRem := divmod(score+nonWild, 2*nonWild+1)
+	if starsRem == 0 {
+		return Bid{Count: stars, Dice: WILD}
+	}
+	count, face := divmod(score-stars-1, nonWild)
+	return Bid{Count: count + 1, Dice: Dice(face + 1)}
+}
+
+// Compare two bids: is b1 > b2?
+func (r Rules) isGreater(b1 Bid, b2 Bid) bool {
+	return r.score(b1) > r.score(b2)
+}
+
+// Get the lowest bid greater than b
+func (r Rules) nextBid(b Bid) Bid {
+	return r.bidFromScore(r.score(b) + 1)
+}
+
+// Describe the rules for the players
+func (r Rules) String() string {
+	if r.Variant == PERUDO {
+		return fmt.Sprintf("Perudo, %v dice per player, 1s are wild, loser of a challenge loses one dice", r.dicePerPlayer())
+	}
+	wilds := "* is wild"
+	if r.NoWilds {
+		wilds = "no wilds"
+	}
+	loss := "loser loses the difference between the bid and the actual count"
+	if r.Loss == ONE_DICE_LOSS {
+		loss = "loser loses one dice"
+	}
+	exact := "on an exact bid everyone except the bidder loses one dice"
+	if r.Exact == CHALLENGER_LOSES_ONE {
+		exact = "on an exact bid the challenger loses one dice"
+	}
+	return fmt.Sprintf("%v dice per player, %v faces (%v), %v, %v", r.dicePerPlayer(), r.faces(), r.facesString(), wilds, loss+", "+exact)
+}
+
+// List the faces of a dice, e.g. "*, 1, 2, 3, 4, 5"
+func (r Rules) facesString() string {
+	s := r.FaceName(WILD)
+	for d := ONE; int(d) < r.faces(); d++ {
+		s += ", " + r.FaceName(d)
+	}
+	return s
+}
+
+// Name a face of a dice without emoji, e.g. "*" or "3"
+func (r Rules) FaceName(d Dice) string {
+	if r.Variant == PERUDO {
+		return strconv.Itoa(int(d) + 1)
+	}
+	if d == WILD {
+		return "*"
+	}
+	return strconv.Itoa(int(d))
+}
+
+// Name the faces of a hand without emoji
+func (r Rules) HandFaceNames(hand []Dice) []string {
+	names := make([]string, len(hand))
+	for i, d := range hand {
+		names[i] = r.FaceName(d)
+	}
+	return names
+}
+
+// Describe a bid without emoji, e.g. "3 5s"
+func (r Rules) BidName(b Bid) string {
+	return fmt.Sprintf("%v %vs", b.Count, r.FaceName(b.Dice))
+}
+
+// Get the emoji shown for a dice. In Perudo the wild face is the ace, shown as 1, and the other faces are shifted
+// by one.
+func (r Rules) diceString(d Dice) string {
+	if r.Variant == PERUDO {
+		if d < WILD || d > FIVE {
+			return "?"
+		}
+		return diceToString(d + 1)
+	}
+	return diceToString(d)
+}
+
+// Parse a dice given by a player
+func (r Rules) parseDice(s string) (Dice, error) {
+	if r.Variant == PERUDO {
+		d, err := stringToDice(s)
+		if err != nil || d < ONE || d > FIVE+1 {
+			return WILD, fmt.Errorf("Unknown dice: %v", s)
+		}
+		return d - 1, nil
+	}
+	return stringToDice(s)
+}
+
+// Parse a bid given by a player as a count and a dice, e.g. "5" and "*"
+func (r Rules) ParseBid(count string, dice string) (Bid, error) {
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return Bid{}, &GameError{fmt.Sprintf("Invalid count: %v", count)}
+	}
+	return r.NewBid(n, dice)
+}
+
+// Make a bid of count dice of a face given by a player, e.g. 5 and "*"
+func (r Rules) NewBid(count int, dice string) (Bid, error) {
+	d, err := r.parseDice(dice)
+	if err != nil {
+		return Bid{}, err
+	}
+	return Bid{Dice: d, Count: count}, nil
+}
+
+// Change rules with "name value" pairs, e.g. ["dice", "3", "wilds", "off"]
+func (r Rules) Apply(settings []string) (Rules, error) {
+	if len(settings)%2 != 0 {
+		return r, &GameError{"Rules are changed with rule value pairs"}
+	}
+	for i := 0; i < len(settings); i += 2 {
+		var err error
+		r, err = r.with(settings[i], settings[i+1])
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// Change one rule with a "name value" setting, e.g. "dice 3"
+func (r Rules) with(name string, value string) (Rules, error) {
+	switch name {
+	case "variant":
+		switch value {
+		case "classic":
+			r = Rules{DicePerPlayer: r.DicePerPlayer}
+		case "perudo":
+			r = Rules{DicePerPlayer: r.DicePerPlayer, Variant: PERUDO}
+		default:
+			return r, &GameError{"Variant can be classic or perudo"}
+		}
+	case "dice", "faces":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return r, &GameError{fmt.Sprintf("Invalid number: %v", value)}
+		}
+		if name == "dice" {
+			r.DicePerPlayer = n
+		} else {
+			r.Faces = n
+		}
+	case "wilds":
+		switch value {
+		case "on":
+			r.NoWilds = false
+		case "off":
+			r.NoWilds = true
+		default:
+			return r, &GameError{"Wilds can be on or off"}
+		}
+	case "loss":
+		switch value {
+		case "difference":
+			r.Loss = DIFFERENCE_LOSS
+		case "one":
+			r.Loss = ONE_DICE_LOSS
+		default:
+			return r, &GameError{"Loss can be difference or one"}
+		}
+	case "exact":
+		switch value {
+		case "others":
+			r.Exact = OTHERS_LOSE_ONE
+		case "challenger":
+			r.Exact = CHALLENGER_LOSES_ONE
+		default:
+			return r, &GameError{"Exact can be others or challenger"}
+		}
+	default:
+		return r, &GameError{fmt.Sprintf("Unknown rule: %v", name)}
+	}
+	return r, r.validate()
+}
+
+// diceMatcher decides which dice count toward a bid
+type diceMatcher interface {
+	// Does dice d count toward value?
+	matches(d Dice, value Dice) bool
+	// Probability that a single unknown dice counts toward value
+	matchProbability(value Dice) float64
+}
+
+// ruleEngine implements the bidding and challenge rules of a game variant
+type ruleEngine interface {
+	diceMatcher
+	// Check that b can be bid on top of current. current.Count is 0 for the first bid of a round.
+	checkBid(current Bid, b Bid) error
+	// Get the bid following b in the order of bids. It's not necessarily a valid bid on top of b.
+	successor(b Bid) Bid
+	// Take dice from the loser of a challenge and choose the player starting the next round. actualCount is the
+	// number of dice matching the challenged bid.
+	resolveChallenge(g *Game, actualCount int) ChallengeResult
+	// Give or take dice from the player who called the current bid exact and choose the player starting the next
+	// round
+	resolveExactCall(g *Game, actualCount int) ChallengeResult
+}
+
+// Get the n lowest bids that can be made on top of current
+func validBidsAbove(e ruleEngine, current Bid, n int) []Bid {
+	bids := make([]Bid, 0, n)
+	for b := e.successor(current); len(bids) < n; b = e.successor(b) {
+		if e.checkBid(current, b) == nil {
+			bids = append(bids, b)
+		}
+	}
+	return bids
+}
+
+// Get the lowest bid that can be made on top of current
+func nextValidBid(e ruleEngine, current Bid) Bid {
+	return validBidsAbove(e, current, 1)[0]
+}
+
+// Check the parts of a bid common to all variants
+func checkBidDice(r Rules, b Bid) error {
+	if b.Count < 1 {
+		return &GameError{"You must bid at least 1 dice"}
+	}
+	if !r.validDice(b.Dice) {
+		return &GameError{fmt.Sprintf("The dice have faces %v", r.facesString())}
+	}
+	return nil
+}
+
+// Give one dice to the player calling the current bid exact if the call was right, otherwise take one. The caller
+// starts the next round, or the next player if the caller lost the last dice.
+func settleExactCall(g *Game, actualCount int) ChallengeResult {
+	bidderIdx := indexOfId(g.Players, g.CurrentBid.PlayerID)
+	caller := &g.Players[g.TurnIdx]
+	result := ChallengeResult{ChallengedBid: g.CurrentBid, Bidder: g.Players[bidderIdx].Info, Challenger: caller.Info}
+
+	if actualCount == g.CurrentBid.Count {
+		result.Result = EXACT_CALL_WON
+		// The value of the new dice doesn't matter, everyone rolls before the next round
+		if len(caller.Hand) < g.Rules.dicePerPlayer() {
+			caller.Hand = append(caller.Hand, WILD)
+			result.GainedDiceCount = 1
+		}
+		return result
+	}
+
+	result.Result = EXACT_CALL_LOST
+	result.LostDiceCount = 1
+	caller.lostDice(1)
+	if len(caller.Hand) == 0 {
+		g.TurnIdx, _ = indexOfNextPlayerWithDice(g.Players, g.TurnIdx)
+	}
+	return result
+}
+
+// classicEngine implements the rules of this bot
+type classicEngine struct {
+	Rules
+}
+
+func (e classicEngine) checkBid(current Bid, b Bid) error {
+	if err := checkBidDice(e.Rules, b); err != nil {
+		return err
+	}
+	if !e.isGreater(b, current) {
+		return &GameError{"You must make a higher bid than the current one"}
+	}
+	return nil
+}
+
+func (e classicEngine) successor(b Bid) Bid {
+	return e.nextBid(b)
+}
+
+func (e classicEngine) resolveChallenge(g *Game, actualCount int) ChallengeResult {
+	bidderIdx := indexOfId(g.Players, g.CurrentBid.PlayerID)
+	bidder := &g.Players[bidderIdx]
+	challenger := &g.Players[g.TurnIdx]
+	result := ChallengeResult{ChallengedBid: g.CurrentBid, Bidder: bidder.Info, Challenger: challenger.Info}
+
+	switch {
+	// Less dice found than the bid -> bidder loses, challenger starts next round
+	case actualCount < g.CurrentBid.Count:
+		nLost := g.CurrentBid.Count - actualCount
+		if e.Loss == ONE_DICE_LOSS {
+			nLost = 1
+		}
+		bidder.lostDice(nLost)
+		result.Result = HIGH_BID
+		result.LostDiceCount = nLost
+
+	// More dice found than the bid -> challenger loses, bidder starts the next round
+	case actualCount > g.CurrentBid.Count:
+		nLost := actualCount - g.CurrentBid.Count
+		if e.Loss == ONE_DICE_LOSS {
+			nLost = 1
+		}
+		challenger.lostDice(nLost)
+		g.TurnIdx = bidderIdx
+		result.Result = LOW_BID
+		result.LostDiceCount = nLost
+
+	// Bid was exactly right and challenger loses one dice -> bidder starts next round
+	case e.Exact == CHALLENGER_LOSES_ONE:
+		challenger.lostDice(1)
+		g.TurnIdx = bidderIdx
+		result.Result = EXACT_BID
+		result.LostDiceCount = 1
+
+	// Bid was exactly right -> everyone except bidder loses one dice, bidder starts next round
+	default:
+		for i := range g.Players {
+			if i != bidderIdx {
+				g.Players[i].lostDice(1)
+			}
+		}
+		g.TurnIdx = bidderIdx
+		result.Result = EXACT_BID
+		result.LostDiceCount = 1
+	}
+	return result
+}
+
+func (e classicEngine) resolveExactCall(g *Game, actualCount int) ChallengeResult {
+	return settleExactCall(g, actualCount)
+}
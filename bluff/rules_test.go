@@ -0,0 +1,295 @@
+package bluff
+
+import (
+	"math"
+	"testing"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+var ruleVariants = []Rules{
+	Rules{},
+	Rules{Faces: 2},
+	Rules{Faces: 8},
+	Rules{Faces: 10},
+	Rules{NoWilds: true},
+	Rules{Faces: 4, NoWilds: true},
+	Rules{Faces: 10, NoWilds: true},
+}
+
+func TestRulesScoreRoundTrip(t *testing.T) {
+	for _, r := range ruleVariants {
+		seen := make(map[Bid]bool)
+		for score := 1; score < 1000; score++ {
+			b := r.bidFromScore(score)
+			if r.score(b) != score {
+				t.Error(r, score, b)
+			}
+			if b.Count < 1 || !r.validDice(b.Dice) || seen[b] {
+				t.Error(r, score, b)
+			}
+			seen[b] = true
+		}
+		// Every face of every count up to 20 appears exactly once
+		for count := 1; count <= 20; count++ {
+			for d := WILD; int(d) < r.faces(); d++ {
+				if !seen[Bid{Count: count, Dice: d}] {
+					t.Error(r, count, d)
+				}
+			}
+		}
+	}
+}
+
+func TestRulesBidOrdering(t *testing.T) {
+	tests := []struct {
+		rules   Rules
+		b1, b2  Bid
+		greater bool
+	}{
+		{Rules{}, Bid{1, WILD, 1}, Bid{1, FIVE, 1}, true},
+		{Rules{}, Bid{1, WILD, 1}, Bid{1, ONE, 2}, false},
+		{Rules{Faces: 8}, Bid{1, Dice(7), 1}, Bid{1, FIVE, 1}, true},
+		{Rules{Faces: 8}, Bid{1, WILD, 1}, Bid{1, Dice(7), 1}, true},
+		{Rules{Faces: 8}, Bid{1, WILD, 2}, Bid{1, Dice(7), 3}, true},
+		{Rules{Faces: 8}, Bid{1, WILD, 2}, Bid{1, ONE, 4}, false},
+		{Rules{NoWilds: true}, Bid{1, WILD, 1}, Bid{1, FIVE, 1}, true},
+		{Rules{NoWilds: true}, Bid{1, WILD, 1}, Bid{1, ONE, 2}, false},
+		{Rules{NoWilds: true}, Bid{1, WILD, 3}, Bid{1, WILD, 2}, true},
+		{Rules{NoWilds: true}, Bid{1, ONE, 2}, Bid{1, FIVE, 1}, true},
+	}
+	for _, tt := range tests {
+		if tt.rules.isGreater(tt.b1, tt.b2) != tt.greater {
+			t.Error(tt)
+		}
+	}
+}
+
+func TestRulesChallenge(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    Rules
+		bid      Bid
+		result   BidClass
+		lost     int
+		hands    []int
+		turnIdx  int
+		finished bool
+	}{
+		// A has 2 fours counting the wild, B has 1
+		{"difference, low", Rules{}, Bid{1, FOUR, 1}, LOW_BID, 2, []int{5, 3}, 0, false},
+		{"one, low", Rules{Loss: ONE_DICE_LOSS}, Bid{1, FOUR, 1}, LOW_BID, 1, []int{5, 4}, 0, false},
+		{"difference, high", Rules{}, Bid{1, FOUR, 5}, HIGH_BID, 2, []int{3, 5}, 1, false},
+		{"one, high", Rules{Loss: ONE_DICE_LOSS}, Bid{1, FOUR, 5}, HIGH_BID, 1, []int{4, 5}, 1, false},
+		{"no wilds, high", Rules{NoWilds: true}, Bid{1, FOUR, 3}, HIGH_BID, 1, []int{4, 5}, 1, false},
+		{"no wilds, exact", Rules{NoWilds: true}, Bid{1, FOUR, 2}, EXACT_BID, 1, []int{5, 4}, 0, false},
+		{"exact, others lose", Rules{}, Bid{1, FOUR, 3}, EXACT_BID, 1, []int{5, 4}, 0, false},
+		{"exact, challenger loses", Rules{Exact: CHALLENGER_LOSES_ONE}, Bid{1, FOUR, 3}, EXACT_BID, 1, []int{5, 4}, 0, false},
+	}
+	for _, tt := range tests {
+		var g Game
+		g.Rules = tt.rules
+		g.State = STARTED
+		g.Players = []Player{
+			Player{PlayerInfo{1, "A"}, []Dice{WILD, FOUR, ONE, TWO, THREE}},
+			Player{PlayerInfo{2, "B"}, []Dice{FOUR, ONE, TWO, TWO, FIVE}}}
+		g.TurnIdx = 1
+		g.CurrentBid = tt.bid
+		r, e := g.ChallengeCurrentBid(2)
+		if e != nil {
+			t.Error(tt.name, e)
+			continue
+		}
+		if r.Result != tt.result || r.LostDiceCount != tt.lost {
+			t.Error(tt.name, r)
+		}
+		if len(g.Players[0].Hand) != tt.hands[0] || len(g.Players[1].Hand) != tt.hands[1] {
+			t.Error(tt.name, len(g.Players[0].Hand), len(g.Players[1].Hand))
+		}
+		if g.TurnIdx != tt.turnIdx {
+			t.Error(tt.name, g.TurnIdx)
+		}
+		if (g.State == FINISHED) != tt.finished {
+			t.Error(tt.name, g.State)
+		}
+	}
+}
+
+func TestRulesDiceAndFaces(t *testing.T) {
+	tests := []struct {
+		rules Rules
+		dice  int
+		faces int
+	}{
+		{Rules{}, N_DICE_PER_PLAYER, DEFAULT_FACES},
+		{Rules{DicePerPlayer: 1}, 1, DEFAULT_FACES},
+		{Rules{DicePerPlayer: 3, Faces: 2}, 3, 2},
+		{Rules{DicePerPlayer: 20, Faces: 10}, 20, 10},
+	}
+	for _, tt := range tests {
+		var g Game
+		g.AddPlayer(PlayerInfo{1, "A"})
+		g.AddPlayer(PlayerInfo{2, "B"})
+		if g.SetRules(tt.rules) != nil {
+			t.Error(tt.rules)
+		}
+		g.StartGame()
+		for _, p := range g.Players {
+			if len(p.Hand) != tt.dice {
+				t.Error(tt.rules, p.Hand)
+			}
+			for _, d := range p.Hand {
+				if int(d) >= tt.faces {
+					t.Error(tt.rules, p.Hand)
+				}
+			}
+		}
+
+		// Bids must be on the faces of the dice
+		if g.Bid(Bid{1, Dice(tt.faces), 1}) == nil {
+			t.Error(tt.rules)
+		}
+		if g.Bid(Bid{1, Dice(tt.faces - 1), 1}) != nil {
+			t.Error(tt.rules)
+		}
+	}
+}
+
+// The odds of a bid are defined for all rule variants, including the ones where every dice matches
+func TestRulesBidOdds(t *testing.T) {
+	for _, r := range ruleVariants {
+		for count := 0; count <= 5; count++ {
+			odds := BidOdds(r, false, []Dice{ONE}, 3, count, ONE)
+			if math.IsNaN(odds) || odds < 0 || odds > 1 {
+				t.Error(r, count, odds)
+			}
+		}
+	}
+	if odds := BidOdds(Rules{Faces: 2}, false, []Dice{ONE}, 3, 2, ONE); odds != 1 {
+		t.Error(odds)
+	}
+	if odds := BidOdds(Rules{Faces: 2}, false, []Dice{ONE}, 3, 5, ONE); odds != 0 {
+		t.Error(odds)
+	}
+}
+
+func TestRulesWith(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        Rules
+		valid       bool
+	}{
+		{"dice", "3", Rules{DicePerPlayer: 3}, true},
+		{"dice", "0", Rules{}, false},
+		{"dice", "21", Rules{}, false},
+		{"dice", "x", Rules{}, false},
+		{"faces", "8", Rules{Faces: 8}, true},
+		{"faces", "1", Rules{}, false},
+		{"faces", "11", Rules{}, false},
+		{"wilds", "off", Rules{NoWilds: true}, true},
+		{"wilds", "on", Rules{}, true},
+		{"wilds", "maybe", Rules{}, false},
+		{"loss", "one", Rules{Loss: ONE_DICE_LOSS}, true},
+		{"loss", "difference", Rules{}, true},
+		{"loss", "all", Rules{}, false},
+		{"exact", "challenger", Rules{Exact: CHALLENGER_LOSES_ONE}, true},
+		{"exact", "others", Rules{}, true},
+		{"exact", "nobody", Rules{}, false},
+		{"variant", "perudo", Rules{Variant: PERUDO}, true},
+		{"variant", "classic", Rules{}, true},
+		{"variant", "liars", Rules{}, false},
+		{"color", "red", Rules{}, false},
+	}
+	for _, tt := range tests {
+		r, err := Rules{}.with(tt.name, tt.value)
+		if (err == nil) != tt.valid {
+			t.Error(tt, err)
+		}
+		if tt.valid && r != tt.want {
+			t.Error(tt, r)
+		}
+	}
+}
+
+func TestPerudoRulesWith(t *testing.T) {
+	r, err := Rules{Faces: 8, DicePerPlayer: 3}.with("variant", "perudo")
+	if err != nil || r != (Rules{DicePerPlayer: 3, Variant: PERUDO}) {
+		t.Error(r, err)
+	}
+	if _, err := r.with("faces", "8"); err == nil {
+		t.Fail()
+	}
+	if _, err := r.with("dice", "4"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetRulesAfterStart(t *testing.T) {
+	var g Game
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.StartGame()
+	if g.SetRules(Rules{DicePerPlayer: 2}) == nil {
+		t.Fail()
+	}
+	if g.Rules != (Rules{}) {
+		t.Fail()
+	}
+}
+
+func TestRulesCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" dice 3 faces 8 wilds off"))
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" loss"))
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" loss one exact nobody"))
+
+	g, _ := onlyGame(b, -100)
+	if g.Rules != (Rules{DicePerPlayer: 3, Faces: 8, NoWilds: true}) {
+		t.Error(g.Rules)
+	}
+
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	if len(g.Players[0].Hand) != 3 {
+		t.Error(g.Players[0].Hand)
+	}
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 2 7"))
+	if g.CurrentBid != (Bid{alice.ID, Dice(7), 2}) {
+		t.Error(g.CurrentBid)
+	}
+}
+
+func TestPerudoCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" variant perudo"))
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+
+	g, _ := onlyGame(b, -100)
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 2 1"))
+	if g.CurrentBid.Count != 0 {
+		t.Error(g.CurrentBid)
+	}
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 2 6"))
+	if g.CurrentBid != (Bid{alice.ID, FIVE, 2}) {
+		t.Error(g.CurrentBid)
+	}
+	tg.HandleUpdate(update(-100, bob, bidCmd+" 1 1"))
+	if g.CurrentBid != (Bid{bob.ID, WILD, 1}) {
+		t.Error(g.CurrentBid)
+	}
+	_, status := r.lastKeyboardMessage(-100)
+	if status.Text != "Bob bid 1 1️⃣s. It's Alice's turn." || status.Keyboard[0][0].Text != "3 2️⃣" {
+		t.Error(status)
+	}
+}
@@ -0,0 +1,359 @@
+package bluff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khuttun/bluffbot/telegram"
+	"github.com/khuttun/bluffbot/telegram/telegramtest"
+)
+
+// scenario plays a scripted conversation with a bot running behind the real Telegram API client, connected to a fake
+// Telegram server. Each line of a script is one of
+//
+//	alice: /bid 3 4        alice sends a message to the group chat
+//	alice joins            alice joins the group's game from her private chat
+//	alice taps Challenge   alice presses the button with the text in the group's latest keyboard
+//	dice 2 2 * 5           the dice of the group's game are rolled from this list, over and over
+//	group> text            the group chat receives a message containing text
+//	alice> text            alice's private chat receives a message containing text
+//	alert> text            the previous button press was answered with an alert containing text
+//
+// The messages each chat receives are matched in order: an expected message can't come before the message matched by
+// the previous expectation of the chat. Edits of a message count as new messages. Empty lines and lines starting
+// with # are skipped.
+type scenario struct {
+	t      *testing.T
+	server *telegramtest.Server
+	bot    *Bot
+	group  telegram.Chat
+	// Users by their lower case names, with IDs in the order they first appear in the script
+	users map[string]telegram.User
+	// Index of the message matched by the previous expectation of each chat
+	matched map[int]int
+	// ID of the callback query of the previous button press
+	tapID string
+}
+
+const scenarioGroupID = -100
+
+func newScenario(t *testing.T) *scenario {
+	server := telegramtest.NewServer()
+	api := &telegram.BotAPI{TelegramURL: server.URL(), RetryBackoff: time.Millisecond}
+	tg, b := newTelegramBot(api)
+	api.UpdateHandler = tg.HandleUpdate
+	webhook := httptest.NewServer(api)
+	api.SetWebhook(webhook.URL)
+	t.Cleanup(func() {
+		webhook.Close()
+		server.Close()
+	})
+
+	title := "Game night"
+	return &scenario{
+		t:       t,
+		server:  server,
+		bot:     b,
+		group:   telegram.Chat{ID: scenarioGroupID, Type: "group", Title: &title},
+		users:   make(map[string]telegram.User),
+		matched: make(map[int]int)}
+}
+
+// Run the lines of a script, stopping the test at the first failure
+func (s *scenario) run(script string) {
+	s.t.Helper()
+	for n, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := s.step(line); err != "" {
+			s.t.Fatalf("Line %v \"%v\": %v", n+1, line, err)
+		}
+	}
+}
+
+// Run one line of a script. Returns a description of the failure, empty if the line passed.
+func (s *scenario) step(line string) string {
+	words := strings.Fields(line)
+	switch {
+	case strings.Contains(words[0], ":"):
+		name := strings.TrimSuffix(words[0], ":")
+		text := strings.TrimSpace(strings.TrimPrefix(line, words[0]))
+		return s.send(s.group, s.user(name), text)
+	case len(words) == 2 && words[1] == "joins":
+		u := s.user(words[0])
+		return s.send(telegram.Chat{ID: u.ID, Type: "private"}, u, joinText(s.bot, s.group.ID))
+	case len(words) > 2 && words[1] == "taps":
+		return s.tap(s.user(words[0]), strings.Join(words[2:], " "))
+	case words[0] == "dice":
+		return s.setDice(words[1:])
+	case words[0] == "alert>":
+		return s.expectAlert(strings.TrimSpace(strings.TrimPrefix(line, words[0])))
+	case strings.HasSuffix(words[0], ">"):
+		name := strings.TrimSuffix(words[0], ">")
+		chatID := s.group.ID
+		if name != "group" {
+			chatID = s.user(name).ID
+		}
+		return s.expect(chatID, strings.TrimSpace(strings.TrimPrefix(line, words[0])))
+	}
+	return "Unknown step"
+}
+
+// Get a user by name, adding a new user on the first use of the name
+func (s *scenario) user(name string) telegram.User {
+	key := strings.ToLower(name)
+	u, found := s.users[key]
+	if !found {
+		u = telegram.User{ID: len(s.users) + 1, FirstName: strings.ToUpper(key[:1]) + key[1:]}
+		s.users[key] = u
+	}
+	return u
+}
+
+func (s *scenario) send(chat telegram.Chat, from telegram.User, text string) string {
+	u := telegram.Update{Message: &telegram.Message{Chat: chat, From: &from, Text: &text}}
+	if err := s.server.PushUpdate(u); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// Press a button of the latest message with a keyboard in the group chat
+func (s *scenario) tap(from telegram.User, text string) string {
+	messages := s.server.Messages(s.group.ID)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Keyboard == nil {
+			continue
+		}
+		for _, row := range messages[i].Keyboard {
+			for _, button := range row {
+				if button.Text == text {
+					data := button.CallbackData
+					s.tapID = strconv.Itoa(len(s.server.Requests("answerCallbackQuery")) + 1)
+					q := telegram.CallbackQuery{
+						ID:      s.tapID,
+						From:    from,
+						Message: &telegram.Message{MessageID: messages[i].ID, Chat: s.group},
+						Data:    &data}
+					if err := s.server.PushUpdate(telegram.Update{CallbackQuery: &q}); err != nil {
+						return err.Error()
+					}
+					return ""
+				}
+			}
+		}
+		return "No button " + text
+	}
+	return "No keyboard"
+}
+
+func (s *scenario) setDice(faces []string) string {
+	g, found := onlyGame(s.bot, s.group.ID)
+	if !found {
+		return "No game"
+	}
+	r := &ScriptedRoller{}
+	for _, f := range faces {
+		d, err := g.Rules.parseDice(f)
+		if err != nil {
+			return err.Error()
+		}
+		r.Dice = append(r.Dice, d)
+	}
+	g.SetDiceRoller(r)
+	return ""
+}
+
+// Find the next message of a chat containing text
+func (s *scenario) expect(chatID int, text string) string {
+	log := s.server.Log(chatID)
+	for i := s.matched[chatID]; i < len(log); i++ {
+		if strings.Contains(log[i].Text, text) {
+			s.matched[chatID] = i
+			return ""
+		}
+	}
+	unmatched := ""
+	for _, m := range log[s.matched[chatID]:] {
+		unmatched += "\n" + m.Text
+	}
+	return "Not received. The messages from the previously matched one on:" + unmatched
+}
+
+// Find the answer to the previous button press and check that it shows an alert containing text
+func (s *scenario) expectAlert(text string) string {
+	for _, r := range s.server.Requests("answerCallbackQuery") {
+		var params telegram.AnswerCallbackQueryParams
+		if err := json.Unmarshal(r.Params, &params); err != nil {
+			return err.Error()
+		}
+		if params.CallbackQueryID != s.tapID {
+			continue
+		}
+		if !params.ShowAlert || !strings.Contains(params.Text, text) {
+			return fmt.Sprintf("Answered with \"%v\", alert %v", params.Text, params.ShowAlert)
+		}
+		return ""
+	}
+	return "Not answered"
+}
+
+func TestScenarioFullGame(t *testing.T) {
+	newScenario(t).run(`
+		alice: /start
+		group> Starting a new game of Bluff!
+		group> https://telegram.me/bluffbot?start=
+		alice joins
+		group> Alice joined
+		bob joins
+		group> Bob joined
+		alice: /rules dice 2
+		group> Rules: 2 dice per player
+		dice 3 3 4 5
+		alice: /begin
+		group> The game begins.
+		group> It's Alice's turn.
+		alice> Your Bluff hand in Game night (Table 1):
+		alice> 3️⃣3️⃣
+		bob> 4️⃣5️⃣
+
+		# Bob can't bid out of turn
+		bob: /bid 1 4
+		group> It's Alice's turn
+
+		alice: /bid 2 3
+		group> Alice bid 2 3️⃣s. It's Bob's turn.
+		bob: /challenge
+		group> Alice: 3️⃣3️⃣
+		group> Alice's bid was exactly right! Everyone else loses 1 dice.
+		group> Starting next round.
+		bob> Your Bluff hand in Game night (Table 1):
+		bob> 4️⃣
+
+		alice: /bid 3 3
+		bob: /challenge
+		group> Alice: 3️⃣3️⃣
+		group> Alice's bid was too high. Alice loses 1 dice.
+		group> It's Bob's turn.
+		alice> 5️⃣
+		bob> 3️⃣
+		bob: /bid 1 3
+		alice: /bid 2 5
+		bob: /challenge
+		group> Alice's bid was too high. Alice loses 1 dice.
+		group> Game finished! Bob is the winner!
+	`)
+}
+
+func TestScenarioButtons(t *testing.T) {
+	newScenario(t).run(`
+		alice: /start
+		alice joins
+		bob joins
+		alice: /rules dice 1
+		dice 2
+		alice: /begin
+		group> It's Alice's turn.
+
+		# Only the player in turn can use the buttons
+		bob taps 1 3️⃣
+		alert> It's Alice's turn
+		alice taps 1 3️⃣
+		group> Alice bid 1 3️⃣s. It's Bob's turn.
+		bob taps Challenge
+		group> Bob: 2️⃣
+		group> Alice's bid was too high. Alice loses 1 dice.
+		group> Game finished! Bob is the winner!
+	`)
+}
+
+func TestScenarioSpectators(t *testing.T) {
+	s := newScenario(t)
+	s.run(`
+		alice: /start
+		alice joins
+		bob joins
+		carol joins
+		dave: /watch
+		group> Dave is watching the game
+		bob: /watch
+		group> Players can't watch the game they are playing
+		alice: /rules dice 1
+		dice 3 4 5
+		alice: /begin
+		dave> Bluff hands in Game night (Table 1):
+		dave> Alice: 3️⃣
+
+		alice: /bid 2 3
+		bob: /challenge
+		group> Alice's bid was too high. Alice loses 1 dice.
+		group> Starting next round.
+		bob> Your Bluff hand in Game night (Table 1):
+		dave> Bluff hands in Game night (Table 1):
+
+		# Alice is out of the game and can watch it
+		alice: /watch
+		group> Alice is watching the game
+		alice> Bluff hands in Game night (Table 1):
+		dave: /watch off
+		group> Dave stopped watching the game
+	`)
+
+	// Alice got a hand only for the first round, and Dave got the hands of both rounds
+	count := func(chatID int, text string) int {
+		n := 0
+		for _, m := range s.server.Log(chatID) {
+			if strings.Contains(m.Text, text) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := count(s.user("alice").ID, "Your Bluff hand"); n != 1 {
+		t.Error(n)
+	}
+	if n := count(s.user("dave").ID, "Bluff hands in"); n != 2 {
+		t.Error(n)
+	}
+	g, _ := onlyGame(s.bot, s.group.ID)
+	if g.IsSpectator(s.user("dave").ID) || !g.IsSpectator(s.user("alice").ID) {
+		t.Error(g.Spectators)
+	}
+}
+
+func TestScenarioAPIFailures(t *testing.T) {
+	s := newScenario(t)
+	var log bytes.Buffer
+	s.bot.SetLogger(slog.New(slog.NewTextHandler(&log, nil)))
+
+	// Too many requests are retried
+	s.server.FailNext("sendMessage", telegramtest.Failure{Status: 429, Description: "Too Many Requests: retry after 1", RetryAfter: 1})
+	s.run(`
+		alice: /start
+		group> Starting a new game of Bluff!
+		alice joins
+		bob joins
+		alice: /begin
+		alice> Your Bluff hand
+	`)
+
+	// The odds can't be sent to a user who has blocked the bot
+	s.server.FailNext("sendMessage", telegramtest.Failure{Status: 403, Description: "Forbidden: bot was blocked by the user"})
+	s.run(`
+		alice: /odds
+		group> Sent the odds to Alice
+	`)
+	expected := fmt.Sprintf("msg=\"Failed to send private message\" user_id=%v err=\"sendMessage failed: Forbidden: bot was blocked by the user\"", s.users["alice"].ID)
+	if !strings.Contains(log.String(), expected) {
+		t.Error(log.String())
+	}
+}
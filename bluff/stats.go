@@ -0,0 +1,259 @@
+package bluff
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// PlayerStats are the statistics of one player in one chat
+type PlayerStats struct {
+	Name string
+	// Telegram username without the @, empty if the player doesn't have one
+	Username    string
+	GamesPlayed int
+	GamesWon    int
+	// Sum of the finishing places of all played games
+	TotalPlace int
+	// Challenges and exact calls made by the player, and how many of them were right
+	Challenges    int
+	ChallengesWon int
+	// Bids of the player that were challenged, and how many of them held
+	BidsChallenged int
+	BidsHeld       int
+	// Bids of the player that were challenged or called exact and turned out exactly right
+	ExactBids int
+	// Skill rating, see updateRatings. Meaningful only after the first rated game.
+	Rating     float64
+	RatedGames int
+}
+
+// Average finishing place of the played games, zero if no games have been played
+func (s PlayerStats) AveragePlace() float64 {
+	if s.GamesPlayed == 0 {
+		return 0
+	}
+	return float64(s.TotalPlace) / float64(s.GamesPlayed)
+}
+
+// Share of the played games won, between 0 and 1
+func (s PlayerStats) WinRate() float64 {
+	return ratio(s.GamesWon, s.GamesPlayed)
+}
+
+// Share of the challenges that were right, between 0 and 1
+func (s PlayerStats) ChallengeSuccessRate() float64 {
+	return ratio(s.ChallengesWon, s.Challenges)
+}
+
+// Share of the challenged bids that held, between 0 and 1
+func (s PlayerStats) BidHoldRate() float64 {
+	return ratio(s.BidsHeld, s.BidsChallenged)
+}
+
+func ratio(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// Record the result of a challenge or an exact call to the stats of the bidder and the caller. Computer-controlled
+// players don't get stats.
+func recordChallenge(stats map[int]PlayerStats, g *Game, r ChallengeResult) {
+	exactCall := r.Result == EXACT_CALL_WON || r.Result == EXACT_CALL_LOST
+	if !g.IsAI(r.Challenger.ID) {
+		s := stats[r.Challenger.ID]
+		s.Name = r.Challenger.Name
+		s.Challenges++
+		if r.Result == HIGH_BID || r.Result == EXACT_CALL_WON {
+			s.ChallengesWon++
+		}
+		stats[r.Challenger.ID] = s
+	}
+	if !g.IsAI(r.Bidder.ID) {
+		s := stats[r.Bidder.ID]
+		s.Name = r.Bidder.Name
+		// A wrong exact call doesn't tell whether the bid was too high or too low
+		if !exactCall {
+			s.BidsChallenged++
+			if r.Result != HIGH_BID {
+				s.BidsHeld++
+			}
+		}
+		if r.Result == EXACT_BID || r.Result == EXACT_CALL_WON {
+			s.ExactBids++
+		}
+		stats[r.Bidder.ID] = s
+	}
+}
+
+// Record a finished game to the stats of its players. Computer-controlled players don't get stats.
+func recordGame(stats map[int]PlayerStats, g *Game) {
+	for _, p := range g.Players {
+		if g.IsAI(p.Info.ID) {
+			continue
+		}
+		s := stats[p.Info.ID]
+		s.Name = p.Info.Name
+		s.GamesPlayed++
+		if g.Places[p.Info.ID] == 1 {
+			s.GamesWon++
+		}
+		s.TotalPlace += g.Places[p.Info.ID]
+		stats[p.Info.ID] = s
+	}
+}
+
+// Sort the players who have played games for the leaderboard: most wins first, then the best win rate, then the
+// best average place
+func leaderboard(stats map[int]PlayerStats) []PlayerStats {
+	var board []PlayerStats
+	for _, s := range stats {
+		if s.GamesPlayed > 0 {
+			board = append(board, s)
+		}
+	}
+	sort.Slice(board, func(i, j int) bool {
+		a, b := board[i], board[j]
+		if a.GamesWon != b.GamesWon {
+			return a.GamesWon > b.GamesWon
+		}
+		if a.WinRate() != b.WinRate() {
+			return a.WinRate() > b.WinRate()
+		}
+		if a.AveragePlace() != b.AveragePlace() {
+			return a.AveragePlace() < b.AveragePlace()
+		}
+		return a.Name < b.Name
+	})
+	return board
+}
+
+// StatsStore persists the player stats of a bot, keyed by the chat ID and the player's user ID. The stats over all
+// chats are kept separately from the chats. Only the ratings are recorded to them.
+type StatsStore interface {
+	// Load the stats of all players in a chat
+	LoadStats(chatID int) (map[int]PlayerStats, error)
+	// Store the stats of the players in a chat, replacing the previous stats
+	SaveStats(chatID int, stats map[int]PlayerStats) error
+	// Load the stats of all players over all chats
+	LoadGlobalStats() (map[int]PlayerStats, error)
+	// Store the stats of the players over all chats, replacing the previous stats
+	SaveGlobalStats(stats map[int]PlayerStats) error
+}
+
+func copyStats(stats map[int]PlayerStats) map[int]PlayerStats {
+	c := make(map[int]PlayerStats)
+	for id, s := range stats {
+		c[id] = s
+	}
+	return c
+}
+
+// MemoryStatsStore keeps stats in memory. Stats don't survive a process restart.
+type MemoryStatsStore struct {
+	mutex  sync.Mutex
+	stats  map[int]map[int]PlayerStats
+	global map[int]PlayerStats
+}
+
+func NewMemoryStatsStore() *MemoryStatsStore {
+	return &MemoryStatsStore{stats: make(map[int]map[int]PlayerStats)}
+}
+
+func (s *MemoryStatsStore) LoadStats(chatID int) (map[int]PlayerStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return copyStats(s.stats[chatID]), nil
+}
+
+func (s *MemoryStatsStore) SaveStats(chatID int, stats map[int]PlayerStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stats[chatID] = copyStats(stats)
+	return nil
+}
+
+func (s *MemoryStatsStore) LoadGlobalStats() (map[int]PlayerStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return copyStats(s.global), nil
+}
+
+func (s *MemoryStatsStore) SaveGlobalStats(stats map[int]PlayerStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.global = copyStats(stats)
+	return nil
+}
+
+// JSONFileStatsStore keeps the stats of all chats in a single JSON file, which is rewritten on every change
+type JSONFileStatsStore struct {
+	path  string
+	mutex sync.Mutex
+	file  statsFile
+}
+
+// Contents of the file of a JSONFileStatsStore
+type statsFile struct {
+	Chats  map[int]map[int]PlayerStats `json:"chats"`
+	Global map[int]PlayerStats         `json:"global"`
+}
+
+// Open a JSON file stats store. The file is created on the first save if it doesn't exist.
+func NewJSONFileStatsStore(path string) (*JSONFileStatsStore, error) {
+	s := &JSONFileStatsStore{path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.file.Chats = make(map[int]map[int]PlayerStats)
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.file); err != nil {
+		return nil, err
+	}
+	if s.file.Chats == nil {
+		s.file.Chats = make(map[int]map[int]PlayerStats)
+	}
+	return s, nil
+}
+
+func (s *JSONFileStatsStore) LoadStats(chatID int) (map[int]PlayerStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return copyStats(s.file.Chats[chatID]), nil
+}
+
+func (s *JSONFileStatsStore) SaveStats(chatID int, stats map[int]PlayerStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.file.Chats[chatID] = copyStats(stats)
+	return s.write()
+}
+
+func (s *JSONFileStatsStore) LoadGlobalStats() (map[int]PlayerStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return copyStats(s.file.Global), nil
+}
+
+func (s *JSONFileStatsStore) SaveGlobalStats(stats map[int]PlayerStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.file.Global = copyStats(stats)
+	return s.write()
+}
+
+// Rewrite the file. The mutex must be held.
+func (s *JSONFileStatsStore) write() error {
+	data, err := json.Marshal(s.file)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
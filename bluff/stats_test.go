@@ -0,0 +1,190 @@
+package bluff
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+func TestPlaces(t *testing.T) {
+	g := Game{}
+	g.AddPlayer(PlayerInfo{1, "A"})
+	g.AddPlayer(PlayerInfo{2, "B"})
+	g.AddPlayer(PlayerInfo{3, "C"})
+	g.AddPlayer(PlayerInfo{4, "D"})
+	g.StartGame()
+
+	g.EliminatePlayer(3)
+	if !reflect.DeepEqual(g.Places, map[int]int{3: 4}) {
+		t.Error(g.Places)
+	}
+
+	// Players going out in the same round share the place
+	g.Players[0].Hand = []Dice{TWO, TWO}
+	g.Players[1].Hand = []Dice{ONE}
+	g.Players[3].Hand = []Dice{ONE}
+	g.CurrentBid = Bid{PlayerID: 1, Dice: ONE, Count: 2}
+	g.TurnIdx = 1
+	r, err := g.ChallengeCurrentBid(2)
+	if err != nil || r.Result != EXACT_BID {
+		t.Fatal(r, err)
+	}
+	if g.State != FINISHED || !reflect.DeepEqual(g.Places, map[int]int{1: 1, 2: 2, 3: 4, 4: 2}) {
+		t.Error(g.Places)
+	}
+}
+
+func TestRecordChallenge(t *testing.T) {
+	bidder := PlayerInfo{1, "A"}
+	challenger := PlayerInfo{2, "B"}
+	var tests = []struct {
+		result     BidClass
+		bidder     PlayerStats
+		challenger PlayerStats
+	}{
+		{LOW_BID, PlayerStats{Name: "A", BidsChallenged: 1, BidsHeld: 1}, PlayerStats{Name: "B", Challenges: 1}},
+		{EXACT_BID, PlayerStats{Name: "A", BidsChallenged: 1, BidsHeld: 1, ExactBids: 1}, PlayerStats{Name: "B", Challenges: 1}},
+		{HIGH_BID, PlayerStats{Name: "A", BidsChallenged: 1}, PlayerStats{Name: "B", Challenges: 1, ChallengesWon: 1}},
+		{EXACT_CALL_WON, PlayerStats{Name: "A", ExactBids: 1}, PlayerStats{Name: "B", Challenges: 1, ChallengesWon: 1}},
+		{EXACT_CALL_LOST, PlayerStats{Name: "A"}, PlayerStats{Name: "B", Challenges: 1}},
+	}
+
+	for _, test := range tests {
+		stats := make(map[int]PlayerStats)
+		recordChallenge(stats, &Game{}, ChallengeResult{Result: test.result, Bidder: bidder, Challenger: challenger})
+		if stats[1] != test.bidder || stats[2] != test.challenger {
+			t.Error(test.result, stats)
+		}
+	}
+
+	// Computer-controlled players don't get stats
+	stats := make(map[int]PlayerStats)
+	g := Game{AIPlayers: map[int]string{2: NORMAL}}
+	recordChallenge(stats, &g, ChallengeResult{Result: HIGH_BID, Bidder: bidder, Challenger: challenger})
+	if _, found := stats[2]; found || len(stats) != 1 {
+		t.Error(stats)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	stats := map[int]PlayerStats{
+		1: PlayerStats{Name: "A", GamesPlayed: 4, GamesWon: 2, TotalPlace: 8},
+		2: PlayerStats{Name: "B", GamesPlayed: 2, GamesWon: 2, TotalPlace: 2},
+		3: PlayerStats{Name: "C", GamesPlayed: 3, GamesWon: 3, TotalPlace: 3},
+		4: PlayerStats{Name: "D", GamesPlayed: 4, GamesWon: 2, TotalPlace: 6},
+		5: PlayerStats{Name: "E", Challenges: 3},
+	}
+	var names []string
+	for _, s := range leaderboard(stats) {
+		names = append(names, s.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"C", "B", "D", "A"}) {
+		t.Error(names)
+	}
+	if stats[1].AveragePlace() != 2 || stats[1].WinRate() != 0.5 || stats[5].AveragePlace() != 0 {
+		t.Error(stats[1])
+	}
+}
+
+func TestJSONFileStatsStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	s, err := NewJSONFileStatsStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := map[int]PlayerStats{1: PlayerStats{Name: "A", Username: "a", GamesPlayed: 1, TotalPlace: 2}}
+	if err := s.SaveStats(-100, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewJSONFileStatsStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := s.LoadStats(-100)
+	if err != nil || !reflect.DeepEqual(loaded, stats) {
+		t.Error(loaded, err)
+	}
+	other, err := s.LoadStats(-200)
+	if err != nil || len(other) != 0 {
+		t.Error(other, err)
+	}
+
+	global := map[int]PlayerStats{1: PlayerStats{Name: "A", RatedGames: 3, Rating: 1510}}
+	if err := s.SaveGlobalStats(global); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewJSONFileStatsStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = s.LoadGlobalStats()
+	if err != nil || !reflect.DeepEqual(loaded, global) {
+		t.Error(loaded, err)
+	}
+	loaded, err = s.LoadStats(-100)
+	if err != nil || !reflect.DeepEqual(loaded, stats) {
+		t.Error(loaded, err)
+	}
+}
+
+func TestStatsCmd(t *testing.T) {
+	var r msgRecorder
+	tg, b := newTelegramBot(&r)
+	username := "alice_w"
+	alice := telegram.User{ID: 1, FirstName: "Alice", Username: &username}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+
+	tg.HandleUpdate(update(-100, alice, leaderboardCmd))
+	if r.count(-100, "No games have been finished in this chat yet") != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, rulesCmd+" dice 1"))
+	g, _ := onlyGame(b, -100)
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{TWO}})
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 1 3"))
+	tg.HandleUpdate(update(-100, bob, challengeCmd))
+	if _, found := onlyGame(b, -100); found {
+		t.Fatal(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, bob, statsCmd+" @Alice_W"))
+	expected := "Stats of Alice in this chat:\n" +
+		"Games played: 1, won: 0 (0%)\n" +
+		"Average finishing place: 2.0\n" +
+		"Challenges made: 0, right: 0 (0%)\n" +
+		"Bids challenged: 1, held: 0 (0%)\n" +
+		"Exactly right bids: 0"
+	if r.count(-100, expected) != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, bob, statsCmd))
+	if r.count(-100, "Stats of Bob in this chat:\nGames played: 1, won: 1 (100%)\nAverage finishing place: 1.0\nChallenges made: 1, right: 1 (100%)") != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, bob, statsCmd+" @carol"))
+	if r.count(-100, "No stats for @carol in this chat yet") != 1 {
+		t.Error(r.messages)
+	}
+
+	tg.HandleUpdate(update(-100, bob, leaderboardCmd))
+	last := r.messages[len(r.messages)-1]
+	if last.Text != "Leaderboard:\n1. Bob: 1 wins in 1 games (100%), average place 1.0\n2. Alice: 0 wins in 1 games (0%), average place 2.0" {
+		t.Error(last.Text)
+	}
+
+	// Stats are scoped to the chat
+	tg.HandleUpdate(update(-200, bob, statsCmd))
+	if r.count(-200, "No stats for Bob in this chat yet") != 1 {
+		t.Error(r.messages)
+	}
+}
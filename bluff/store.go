@@ -0,0 +1,316 @@
+package bluff
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// GameStore persists the games of a bot, keyed by the ID of the game
+type GameStore interface {
+	// Load all stored games
+	LoadGames() (map[string]*Game, error)
+	// Store the current state of a game, replacing the previous state
+	SaveGame(id string, g *Game) error
+	// Remove a game from the store
+	DeleteGame(id string) error
+}
+
+// Make a deep copy of a game, so that the stored state isn't modified by later changes to the game
+func copyGame(g *Game) *Game {
+	c := *g
+	c.Players = make([]Player, len(g.Players))
+	for i, p := range g.Players {
+		c.Players[i] = p
+		if p.Hand != nil {
+			c.Players[i].Hand = append([]Dice{}, p.Hand...)
+		}
+	}
+	if g.AIPlayers != nil {
+		c.AIPlayers = make(map[int]string)
+		for id, d := range g.AIPlayers {
+			c.AIPlayers[id] = d
+		}
+	}
+	if g.Roller.Seed != nil {
+		c.Roller.Seed = append([]byte{}, g.Roller.Seed...)
+	}
+	if g.Commitments != nil {
+		c.Commitments = append([]HandCommitment{}, g.Commitments...)
+	}
+	if g.PalificoPlayers != nil {
+		c.PalificoPlayers = append([]int{}, g.PalificoPlayers...)
+	}
+	if g.Places != nil {
+		c.Places = make(map[int]int)
+		for id, place := range g.Places {
+			c.Places[id] = place
+		}
+	}
+	if g.Spectators != nil {
+		c.Spectators = append([]PlayerInfo{}, g.Spectators...)
+	}
+	if g.OutRounds != nil {
+		c.OutRounds = make(map[int]int)
+		for id, round := range g.OutRounds {
+			c.OutRounds[id] = round
+		}
+	}
+	return &c
+}
+
+// MemoryStore keeps games in memory. Games don't survive a process restart.
+type MemoryStore struct {
+	mutex sync.Mutex
+	games map[string]*Game
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{games: make(map[string]*Game)}
+}
+
+func (s *MemoryStore) LoadGames() (map[string]*Game, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	games := make(map[string]*Game)
+	for id, g := range s.games {
+		games[id] = copyGame(g)
+	}
+	return games, nil
+}
+
+func (s *MemoryStore) SaveGame(id string, g *Game) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.games[id] = copyGame(g)
+	return nil
+}
+
+func (s *MemoryStore) DeleteGame(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.games, id)
+	return nil
+}
+
+// JSONFileStore keeps all games in a single JSON file, which is rewritten on every change
+type JSONFileStore struct {
+	path  string
+	mutex sync.Mutex
+	games map[string]*Game
+}
+
+// Open a JSON file store. The file is created on the first save if it doesn't exist.
+func NewJSONFileStore(path string) (*JSONFileStore, error) {
+	s := &JSONFileStore{path: path, games: make(map[string]*Game)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.games); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONFileStore) LoadGames() (map[string]*Game, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	games := make(map[string]*Game)
+	for id, g := range s.games {
+		games[id] = copyGame(g)
+	}
+	return games, nil
+}
+
+func (s *JSONFileStore) SaveGame(id string, g *Game) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.games[id] = copyGame(g)
+	return s.write()
+}
+
+func (s *JSONFileStore) DeleteGame(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, found := s.games[id]; !found {
+		return nil
+	}
+	delete(s.games, id)
+	return s.write()
+}
+
+// Write all games to the file. The file is replaced atomically so that a crash can't leave it half written.
+func (s *JSONFileStore) write() error {
+	data, err := json.Marshal(s.games)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LogStore is an embedded append-only database. Every change is appended to a log file as a single record, so
+// saving a game doesn't rewrite the other games. The log is compacted when it has grown much larger than the
+// number of live games.
+type LogStore struct {
+	path     string
+	mutex    sync.Mutex
+	file     *os.File
+	games    map[string]*Game
+	nRecords int
+}
+
+// A single record in the LogStore file. Game is nil for deleted games.
+type logRecord struct {
+	GameID string `json:"game_id"`
+	Game   *Game  `json:"game"`
+}
+
+// The log is compacted when it has more than this many records per live game
+const logCompactionRatio = 10
+
+// Open a log store, replaying the existing log file if there is one
+func NewLogStore(path string) (*LogStore, error) {
+	s := &LogStore{path: path, games: make(map[string]*Game)}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	// Start from a compacted log to drop any partially written record at the end
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *LogStore) replay() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		var r logRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// Torn write at the end of the log, the rest can't be trusted
+			break
+		}
+		if r.Game != nil {
+			s.games[r.GameID] = r.Game
+		} else {
+			delete(s.games, r.GameID)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *LogStore) LoadGames() (map[string]*Game, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	games := make(map[string]*Game)
+	for id, g := range s.games {
+		games[id] = copyGame(g)
+	}
+	return games, nil
+}
+
+func (s *LogStore) SaveGame(id string, g *Game) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c := copyGame(g)
+	s.games[id] = c
+	return s.append(logRecord{GameID: id, Game: c})
+}
+
+func (s *LogStore) DeleteGame(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, found := s.games[id]; !found {
+		return nil
+	}
+	delete(s.games, id)
+	return s.append(logRecord{GameID: id})
+}
+
+// Close the log file
+func (s *LogStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+func (s *LogStore) append(r logRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.nRecords++
+	if s.nRecords > logCompactionRatio*(len(s.games)+1) {
+		return s.compact()
+	}
+	return nil
+}
+
+// Rewrite the log so that it contains only one record per live game
+func (s *LogStore) compact() error {
+	var data []byte
+	for id, g := range s.games {
+		rec, err := json.Marshal(logRecord{GameID: id, Game: g})
+		if err != nil {
+			return err
+		}
+		data = append(data, rec...)
+		data = append(data, '\n')
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.nRecords = len(s.games)
+	return nil
+}
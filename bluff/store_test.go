@@ -0,0 +1,150 @@
+package bluff
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+// Open each GameStore implementation, reopening from the same files when reopen is called
+func openStores(t *testing.T) map[string]func() GameStore {
+	dir := t.TempDir()
+	memory := NewMemoryStore()
+	return map[string]func() GameStore{
+		"memory": func() GameStore { return memory },
+		"json": func() GameStore {
+			s, err := NewJSONFileStore(filepath.Join(dir, "games.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		"log": func() GameStore {
+			s, err := NewLogStore(filepath.Join(dir, "games.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+	}
+}
+
+func testGame() *Game {
+	return &Game{
+		State: STARTED,
+		Players: []Player{
+			Player{PlayerInfo{1, "A"}, []Dice{WILD, ONE, FIVE}},
+			Player{PlayerInfo{2, "B"}, []Dice{}},
+			Player{PlayerInfo{3, "C"}, []Dice{TWO}}},
+		TurnIdx:    2,
+		CurrentBid: Bid{1, FOUR, 3}}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for name, open := range openStores(t) {
+		s := open()
+		lobby := &Game{Players: []Player{Player{PlayerInfo{4, "D"}, nil}}}
+		if s.SaveGame("-1", testGame()) != nil || s.SaveGame("-2", lobby) != nil || s.SaveGame("-3", &Game{}) != nil {
+			t.Error(name)
+		}
+		if s.DeleteGame("-3") != nil {
+			t.Error(name)
+		}
+
+		games, err := open().LoadGames()
+		if err != nil {
+			t.Error(name, err)
+		}
+		if len(games) != 2 {
+			t.Error(name, games)
+		}
+		if !reflect.DeepEqual(games["-1"], testGame()) {
+			t.Error(name, games["-1"])
+		}
+		if !reflect.DeepEqual(games["-2"], lobby) {
+			t.Error(name, games["-2"])
+		}
+	}
+}
+
+func TestStoreCopiesGames(t *testing.T) {
+	for name, open := range openStores(t) {
+		s := open()
+		g := testGame()
+		s.SaveGame("-1", g)
+		g.Players[0].Hand[0] = FIVE
+		g.TurnIdx = 0
+
+		games, _ := s.LoadGames()
+		if !reflect.DeepEqual(games["-1"], testGame()) {
+			t.Error(name, games["-1"])
+		}
+	}
+}
+
+func TestLogStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.log")
+	s, _ := NewLogStore(path)
+	g := testGame()
+	for i := 0; i < 100; i++ {
+		g.CurrentBid.Count = i
+		s.SaveGame("-1", g)
+	}
+	if s.nRecords > logCompactionRatio*2 {
+		t.Error(s.nRecords)
+	}
+	s.Close()
+
+	s, _ = NewLogStore(path)
+	games, _ := s.LoadGames()
+	if len(games) != 1 || games["-1"].CurrentBid.Count != 99 {
+		t.Error(games)
+	}
+}
+
+func TestBotResumesGamesFromStore(t *testing.T) {
+	for name, open := range openStores(t) {
+		var r msgRecorder
+		tg, err := newTelegram("bluffbot", &r, open())
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		b := tg.Bot()
+		alice := telegram.User{ID: 1, FirstName: "Alice"}
+		bob := telegram.User{ID: 2, FirstName: "Bob"}
+		tg.HandleUpdate(update(-100, alice, startCmd))
+		tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+		tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+		tg.HandleUpdate(update(-200, alice, startCmd))
+		tg.HandleUpdate(update(-200, alice, stopCmd))
+		tg.HandleUpdate(update(-100, alice, beginCmd))
+		tg.HandleUpdate(update(-100, alice, bidCmd+" 2 3"))
+
+		// Restart
+		tg, err = newTelegram("bluffbot", &r, open())
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		b = tg.Bot()
+		if _, found := onlyGame(b, -200); found {
+			t.Error(name)
+		}
+		g, found := onlyGame(b, -100)
+		if !found {
+			t.Fatal(name)
+		}
+		if g.State != STARTED || len(g.Players) != 2 || g.TurnIdx != 1 {
+			t.Error(name, g)
+		}
+		if g.CurrentBid != (Bid{alice.ID, THREE, 2}) {
+			t.Error(name, g.CurrentBid)
+		}
+
+		tg.HandleUpdate(update(-100, bob, bidCmd+" 3 3"))
+		if g.CurrentBid != (Bid{bob.ID, THREE, 3}) {
+			t.Error(name, g.CurrentBid)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package bluff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+// Telegram runs a bot on a telegram.MsgSender for the tests, so that they can drive the bot with Telegram updates
+// and check the requests it makes to the Telegram Bot API. It's a minimal version of telegram/adapter, which can't
+// be used here without an import cycle.
+type Telegram struct {
+	username string
+	api      telegram.MsgSender
+	bot      *Bot
+}
+
+func newTelegram(uname string, api telegram.MsgSender, store GameStore) (*Telegram, error) {
+	t := &Telegram{username: uname, api: api}
+	b, err := NewBotWithMessenger(t, store)
+	if err != nil {
+		return nil, err
+	}
+	t.bot = b
+	return t, nil
+}
+
+func (t *Telegram) Bot() *Bot {
+	return t.bot
+}
+
+func (t *Telegram) HandleUpdate(u telegram.Update) {
+	switch {
+	case u.CallbackQuery != nil:
+		q := *u.CallbackQuery
+		if q.Message == nil {
+			t.AnswerPress(q.ID, "This game has ended")
+			return
+		}
+		p := ButtonPress{ID: q.ID, Room: Room{ID: q.Message.Chat.ID}, From: telegramUser(q.From), MessageID: q.Message.MessageID}
+		if q.Data != nil {
+			p.Data = *q.Data
+		}
+		t.bot.HandleButtonPress(p)
+	case u.Message != nil && u.Message.Text != nil && u.Message.From != nil:
+		msg := *u.Message
+		parts := strings.Split(*msg.Text, " ")
+		room := Room{ID: msg.Chat.ID}
+		if msg.Chat.Title != nil {
+			room.Title = *msg.Chat.Title
+		}
+		t.bot.HandleCommand(Command{Room: room, From: telegramUser(*msg.From), Name: strings.TrimSuffix(parts[0], "@"+t.username), Args: parts[1:]})
+	}
+}
+
+func telegramUser(u telegram.User) User {
+	user := User{ID: u.ID, Name: u.FirstName}
+	if u.Username != nil {
+		user.Username = *u.Username
+	}
+	return user
+}
+
+func inlineKeyboard(buttons [][]Button) [][]telegram.InlineKeyboardButton {
+	if buttons == nil {
+		return nil
+	}
+	kb := make([][]telegram.InlineKeyboardButton, len(buttons))
+	for i, row := range buttons {
+		kb[i] = make([]telegram.InlineKeyboardButton, len(row))
+		for j, button := range row {
+			kb[i][j] = telegram.InlineKeyboardButton{Text: button.Text, CallbackData: button.Data}
+		}
+	}
+	return kb
+}
+
+func (t *Telegram) Send(roomID int, text string) error {
+	return t.api.SendMessage(roomID, text)
+}
+
+func (t *Telegram) SendWithButtons(roomID int, text string, buttons [][]Button) (int, error) {
+	return t.api.SendMessageWithInlineKeyboard(roomID, text, inlineKeyboard(buttons))
+}
+
+func (t *Telegram) SendFinal(roomID int, text string) error {
+	return t.api.SendMessageAndRemoveCustomKeyboard(roomID, text)
+}
+
+func (t *Telegram) Edit(roomID int, messageID int, text string, buttons [][]Button) error {
+	return t.api.EditMessageText(roomID, messageID, text, inlineKeyboard(buttons))
+}
+
+func (t *Telegram) SendPrivate(userID int, text string) error {
+	return t.api.SendMessage(userID, text)
+}
+
+func (t *Telegram) AnswerPress(pressID string, text string) error {
+	return t.api.AnswerCallbackQuery(pressID, text)
+}
+
+func (t *Telegram) JoinInstructions(g *Game) string {
+	return fmt.Sprintf("https://telegram.me/%v?start=%v", t.username, g.ID)
+}
+
+func (t *Telegram) Emoji() bool {
+	return true
+}
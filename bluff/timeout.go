@@ -0,0 +1,200 @@
+package bluff
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timer is a timer started by a Clock
+type Timer interface {
+	// Stop the timer. Returns false if the timer has already fired or been stopped.
+	Stop() bool
+}
+
+// Clock abstracts the passing of time, so that turn timeouts can be tested deterministically
+type Clock interface {
+	// Call f in its own goroutine after duration d
+	AfterFunc(d time.Duration, f func()) Timer
+	// Get the current time
+	Now() time.Time
+}
+
+// realClock is a Clock using the time package
+type realClock struct{}
+
+func (c realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (c realClock) Now() time.Time {
+	return time.Now()
+}
+
+// turnTimer tracks the time the current player of a game has left to make a move
+type turnTimer struct {
+	room     Room
+	gameID   string
+	playerID int
+	timer    Timer
+}
+
+// Replace the clock used for turn timeouts. Running turn timers are restarted with the new clock.
+func (b *Bot) SetClock(c Clock) {
+	b.mutex.Lock()
+	b.clock = c
+	timers := b.turnTimers
+	b.turnTimers = make(map[string]*turnTimer)
+	b.mutex.Unlock()
+
+	for gameID, t := range timers {
+		lock := b.chatLock(t.room.ID)
+		lock.Lock()
+		t.timer.Stop()
+		if g, gameFound := b.game(gameID); gameFound {
+			b.startTurnTimer(t.room, g)
+		}
+		lock.Unlock()
+	}
+}
+
+// Get the current time from the bot's clock
+func (b *Bot) now() time.Time {
+	b.mutex.Lock()
+	c := b.clock
+	b.mutex.Unlock()
+	return c.Now()
+}
+
+func (b *Bot) turnTimer(gameID string) *turnTimer {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.turnTimers[gameID]
+}
+
+// Start the turn timer for the current player of a game, replacing the previous timer of the game. No timer is
+// started for computer-controlled players or if the game has no turn timeout.
+func (b *Bot) startTurnTimer(room Room, g *Game) {
+	b.stopTurnTimer(g.ID)
+	if g.State != STARTED || g.TurnTimeout.Limit <= 0 {
+		return
+	}
+	playerID := g.Players[g.TurnIdx].Info.ID
+	if g.IsAI(playerID) {
+		return
+	}
+
+	t := &turnTimer{room: room, gameID: g.ID, playerID: playerID}
+	warnAfter := g.TurnTimeout.Limit - g.TurnTimeout.Warning
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if g.TurnTimeout.Warning > 0 && warnAfter > 0 {
+		t.timer = b.clock.AfterFunc(warnAfter, func() { b.onTurnTimer(t, true) })
+	} else {
+		t.timer = b.clock.AfterFunc(g.TurnTimeout.Limit, func() { b.onTurnTimer(t, false) })
+	}
+	b.turnTimers[g.ID] = t
+}
+
+func (b *Bot) stopTurnTimer(gameID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if t, found := b.turnTimers[gameID]; found {
+		t.timer.Stop()
+		delete(b.turnTimers, gameID)
+	}
+}
+
+func (b *Bot) onTurnTimer(t *turnTimer, warning bool) {
+	lock := b.chatLock(t.room.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// The player may have made a move while this timer was firing
+	if b.turnTimer(t.gameID) != t {
+		return
+	}
+	g, gameFound := b.game(t.gameID)
+	if !gameFound {
+		return
+	}
+
+	if warning {
+		name := g.Players[g.TurnIdx].Info.Name
+		b.send(t.room.ID, b.gameText(g, fmt.Sprintf("%v, you have %v left to make your move. Otherwise I'll %v.", name, g.TurnTimeout.Warning, timeoutActionString(g.TurnTimeout.Action))))
+		b.mutex.Lock()
+		t.timer = b.clock.AfterFunc(g.TurnTimeout.Warning, func() { b.onTurnTimer(t, false) })
+		b.mutex.Unlock()
+		return
+	}
+
+	defer b.persistGames(t.room.ID)
+	b.onTurnTimeout(t.room, g)
+}
+
+// Make the move dictated by the game's timeout action for the current player
+func (b *Bot) onTurnTimeout(room Room, g *Game) {
+	p := g.Players[g.TurnIdx].Info
+	b.send(room.ID, b.gameText(g, fmt.Sprintf("%v ran out of time.", p.Name)))
+
+	var err error
+	switch {
+	case g.TurnTimeout.Action == ELIMINATE:
+		err = b.eliminate(room, g, p)
+	case g.TurnTimeout.Action == AUTO_CHALLENGE && g.CurrentBid.Count > 0:
+		err = b.challenge(room, g, p.ID)
+	default:
+		bid := nextValidBid(g.engine(), g.CurrentBid)
+		bid.PlayerID = p.ID
+		err = b.bid(room, g, p.Name, bid)
+	}
+	if err != nil {
+		// This runs in the timer's goroutine, so the error must not take down the bot. Some other move is made
+		// instead so that the game doesn't stall.
+		b.log().Warn("Failed to make the timeout move", "game_id", g.ID, "name", p.Name, "err", err)
+		err = b.fallbackMove(room, g, p)
+	}
+	if err != nil {
+		b.log().Error("Failed to make a fallback move", "game_id", g.ID, "name", p.Name, "err", err)
+		b.startTurnTimer(room, g)
+		return
+	}
+	b.afterMove(room, g)
+}
+
+// Eliminate a player and announce it in the chat
+func (b *Bot) eliminate(room Room, g *Game, p PlayerInfo) error {
+	// The hands are rolled again, so the hands committed to are revealed first
+	revealed := revealRound(g)
+	err := g.EliminatePlayer(p.ID)
+	if err != nil {
+		return err
+	}
+	b.closeStatus(g)
+	b.setRevealedRound(revealed)
+
+	response := fmt.Sprintf("%v is out of the game. The hands of the round were:\n", p.Name)
+	response += b.revealedHandsMsg(revealed)
+	response += gameStatusMsg(g)
+	response += "\n\n"
+
+	switch g.State {
+	case STARTED:
+		response += "Starting next round."
+		b.beginRound(room, g, response)
+	case FINISHED:
+		b.gameFinished(g, response)
+	}
+	return nil
+}
+
+func timeoutActionString(a TimeoutAction) string {
+	switch a {
+	case AUTO_CHALLENGE:
+		return "challenge the current bid for you"
+	case AUTO_BID:
+		return "make the minimal bid for you"
+	case ELIMINATE:
+		return "remove you from the game"
+	}
+	return "?"
+}
@@ -0,0 +1,212 @@
+package bluff
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+// fakeClock is a Clock whose time advances only when Advance is called
+type fakeClock struct {
+	mutex  sync.Mutex
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Duration
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := &fakeTimer{clock: c, at: c.now + d, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// The time starts from the beginning of 2020
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Add(c.now)
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	wasRunning := !t.stopped
+	t.stopped = true
+	return wasRunning
+}
+
+// Advance the time, calling the functions of the timers that fire in order
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	end := c.now + d
+	c.mutex.Unlock()
+
+	for {
+		c.mutex.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at < c.timers[j].at })
+		if len(c.timers) == 0 || c.timers[0].at > end {
+			c.now = end
+			c.mutex.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		fire := !t.stopped
+		t.stopped = true
+		c.mutex.Unlock()
+
+		if fire {
+			t.f()
+		}
+	}
+}
+
+// Start a game between Alice and Bob in chat -100 with the given timeout settings
+func timeoutGame(timeoutParams string) (*Telegram, *Bot, *msgRecorder, *fakeClock, telegram.User, telegram.User) {
+	var r msgRecorder
+	var c fakeClock
+	tg, b := newTelegramBot(&r)
+	b.SetClock(&c)
+	alice := telegram.User{ID: 1, FirstName: "Alice"}
+	bob := telegram.User{ID: 2, FirstName: "Bob"}
+	tg.HandleUpdate(update(-100, alice, startCmd))
+	tg.HandleUpdate(update(alice.ID, alice, joinText(b, -100)))
+	tg.HandleUpdate(update(bob.ID, bob, joinText(b, -100)))
+	tg.HandleUpdate(update(-100, alice, timeoutCmd+" "+timeoutParams))
+	tg.HandleUpdate(update(-100, alice, beginCmd))
+	return tg, b, &r, &c, alice, bob
+}
+
+func TestTurnTimeoutWarning(t *testing.T) {
+	tg, b, r, c, alice, _ := timeoutGame("60 bid")
+	g, _ := onlyGame(b, -100)
+
+	c.Advance(44 * time.Second)
+	if r.count(-100, "Alice, you have") != 0 {
+		t.Fail()
+	}
+	c.Advance(time.Second)
+	if r.count(-100, "Alice, you have 15s left") != 1 {
+		t.Fail()
+	}
+	if g.CurrentBid.Count != 0 {
+		t.Fail()
+	}
+
+	// Moving in time stops the timer
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 2 3"))
+	c.Advance(30 * time.Second)
+	if r.count(-100, "Alice ran out of time") != 0 {
+		t.Fail()
+	}
+	if r.count(-100, "Bob, you have") != 0 {
+		t.Fail()
+	}
+}
+
+func TestTurnTimeoutAutoBid(t *testing.T) {
+	tg, b, r, c, alice, _ := timeoutGame("60 bid")
+	g, _ := onlyGame(b, -100)
+	tg.HandleUpdate(update(-100, alice, bidCmd+" 2 3"))
+
+	c.Advance(60 * time.Second)
+	if r.count(-100, "Bob ran out of time") != 1 {
+		t.Fail()
+	}
+	if g.CurrentBid != (Bid{2, FOUR, 2}) {
+		t.Error(g.CurrentBid)
+	}
+
+	// The timer restarts for the next player
+	c.Advance(60 * time.Second)
+	if r.count(-100, "Alice ran out of time") != 1 {
+		t.Fail()
+	}
+	if g.CurrentBid != (Bid{1, FIVE, 2}) {
+		t.Error(g.CurrentBid)
+	}
+}
+
+func TestTurnTimeoutAutoChallenge(t *testing.T) {
+	_, b, r, c, alice, _ := timeoutGame("60 challenge")
+	g, _ := onlyGame(b, -100)
+
+	// Nothing to challenge yet, the minimal bid is made instead
+	c.Advance(60 * time.Second)
+	if g.CurrentBid != (Bid{alice.ID, ONE, 1}) {
+		t.Error(g.CurrentBid)
+	}
+
+	c.Advance(60 * time.Second)
+	if r.count(-100, "Bob ran out of time") != 1 {
+		t.Fail()
+	}
+	if g.CurrentBid.Count != 0 {
+		t.Fail()
+	}
+	if len(g.Players[0].Hand)+len(g.Players[1].Hand) >= 2*N_DICE_PER_PLAYER {
+		t.Fail()
+	}
+}
+
+func TestTurnTimeoutEliminate(t *testing.T) {
+	_, b, r, c, _, _ := timeoutGame("60 eliminate")
+	c.Advance(60 * time.Second)
+	if r.count(-100, "Alice ran out of time") != 1 {
+		t.Fail()
+	}
+	if r.count(-100, "Alice is out of the game") != 1 {
+		t.Fail()
+	}
+	if _, found := onlyGame(b, -100); found {
+		t.Fail()
+	}
+}
+
+func TestTurnTimeoutMoveFails(t *testing.T) {
+	_, b, r, c, _, _ := timeoutGame("60 eliminate")
+	g, _ := onlyGame(b, -100)
+	// Alice has no dice left to take, so she can't be eliminated
+	g.Players[0].Hand = nil
+
+	c.Advance(60 * time.Second)
+	if r.count(-100, "Alice ran out of time") != 1 || g.CurrentBid.Count == 0 {
+		t.Fatal(r.messages)
+	}
+
+	// The timer runs for the next player
+	c.Advance(60 * time.Second)
+	if r.count(-100, "Bob ran out of time") != 1 {
+		t.Error(r.messages)
+	}
+}
+
+func TestTurnTimeoutStoppedWithGame(t *testing.T) {
+	tg, _, r, c, alice, _ := timeoutGame("60")
+	tg.HandleUpdate(update(-100, alice, stopCmd))
+	c.Advance(time.Hour)
+	if r.count(-100, "Alice, you have") != 0 || r.count(-100, "Alice ran out of time") != 0 {
+		t.Fail()
+	}
+}
+
+func TestTimeoutCmdAfterBegin(t *testing.T) {
+	tg, b, _, _, alice, _ := timeoutGame("off")
+	tg.HandleUpdate(update(-100, alice, timeoutCmd+" 30"))
+	g, _ := onlyGame(b, -100)
+	if g.TurnTimeout.Limit != 0 {
+		t.Fail()
+	}
+}
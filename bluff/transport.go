@@ -0,0 +1,68 @@
+package bluff
+
+// User is a person using the bot through a messenger
+type User struct {
+	// Unique, positive ID of the user in the messenger. Computer-controlled players have negative IDs.
+	ID int
+	// Name shown to the other players
+	Name string
+	// Optional. Handle the user can be mentioned with, without the leading @.
+	Username string
+}
+
+// Room is a conversation the bot takes part in, e.g. a group chat or a channel. A room can have several games, each
+// at a table of its own.
+type Room struct {
+	// Unique ID of the room in the messenger. A private conversation with a user has the ID of the user.
+	ID int
+	// Optional. Name of the room shown to the users.
+	Title string
+}
+
+// Command is a command sent by a user to a room, e.g. "/bid 3 4"
+type Command struct {
+	Room Room
+	From User
+	// Name of the command with the leading slash, e.g. "/bid"
+	Name string
+	Args []string
+}
+
+// Button is a button attached to a message. Pressing the button sends its Data back to the bot.
+type Button struct {
+	Text string
+	Data string
+}
+
+// ButtonPress is a press of a button attached to a message sent by the bot
+type ButtonPress struct {
+	// ID used to answer the press
+	ID   string
+	Room Room
+	From User
+	// ID of the message the button is attached to
+	MessageID int
+	Data      string
+}
+
+// Messenger sends the bot's messages to users through a messenger service. Adapters for each service implement it
+// and pass the commands and button presses of the users to Bot.HandleCommand and Bot.HandleButtonPress.
+type Messenger interface {
+	// Send a message to a room
+	Send(roomID int, text string) error
+	// Send a message with rows of buttons to a room. Returns the ID of the sent message.
+	SendWithButtons(roomID int, text string, buttons [][]Button) (int, error)
+	// Send the last message of a game to a room. Any controls the messenger shows for the game besides messages are
+	// removed.
+	SendFinal(roomID int, text string) error
+	// Replace the text and the buttons of a message. The buttons are removed if buttons is nil.
+	Edit(roomID int, messageID int, text string, buttons [][]Button) error
+	// Send a private message to a user, e.g. the user's hand
+	SendPrivate(userID int, text string) error
+	// Answer a button press. A non-empty text is shown to the user who pressed the button.
+	AnswerPress(pressID string, text string) error
+	// Tell how users join a game that has just been started, e.g. with a link to follow
+	JoinInstructions(g *Game) string
+	// Can the messenger show emoji? Dice are shown as emoji keycaps if it can, and as plain faces otherwise.
+	Emoji() bool
+}
@@ -0,0 +1,142 @@
+package bluff
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMessenger is a Messenger of an imaginary chat service, recording the messages it sends
+type fakeMessenger struct {
+	mutex sync.Mutex
+	// Texts sent to each room and to each user, keyed by room or user ID
+	rooms   map[int][]string
+	private map[int][]string
+	// The buttons of the latest message with buttons, and its ID
+	buttons   [][]Button
+	buttonsID int
+	answers   map[string]string
+	finals    int
+}
+
+func newFakeMessenger() *fakeMessenger {
+	return &fakeMessenger{rooms: make(map[int][]string), private: make(map[int][]string), answers: make(map[string]string)}
+}
+
+func (m *fakeMessenger) Send(roomID int, text string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.rooms[roomID] = append(m.rooms[roomID], text)
+	return nil
+}
+
+func (m *fakeMessenger) SendWithButtons(roomID int, text string, buttons [][]Button) (int, error) {
+	m.Send(roomID, text)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.buttons = buttons
+	m.buttonsID++
+	return m.buttonsID, nil
+}
+
+func (m *fakeMessenger) SendFinal(roomID int, text string) error {
+	m.Send(roomID, text)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.finals++
+	return nil
+}
+
+func (m *fakeMessenger) Edit(roomID int, messageID int, text string, buttons [][]Button) error {
+	m.Send(roomID, text)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.buttons = buttons
+	return nil
+}
+
+func (m *fakeMessenger) SendPrivate(userID int, text string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.private[userID] = append(m.private[userID], text)
+	return nil
+}
+
+func (m *fakeMessenger) AnswerPress(pressID string, text string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.answers[pressID] = text
+	return nil
+}
+
+func (m *fakeMessenger) JoinInstructions(g *Game) string {
+	return "Say \"join\" to join"
+}
+
+// The dice are shown as plain faces
+func (m *fakeMessenger) Emoji() bool {
+	return false
+}
+
+// Get the last text sent to a room or a user
+func last(texts []string) string {
+	if len(texts) == 0 {
+		return ""
+	}
+	return texts[len(texts)-1]
+}
+
+func TestBotWithOtherMessenger(t *testing.T) {
+	m := newFakeMessenger()
+	b, err := NewBotWithMessenger(m, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := Room{ID: 7, Title: "Lobby"}
+	alice := User{ID: 1, Name: "Alice", Username: "alice"}
+	bob := User{ID: 2, Name: "Bob"}
+
+	b.HandleCommand(Command{Room: room, From: alice, Name: startCmd})
+	if !strings.HasSuffix(m.rooms[7][0], "Say \"join\" to join") {
+		t.Error(m.rooms[7])
+	}
+	g, _ := onlyGame(b, 7)
+	b.HandleCommand(Command{Room: Room{ID: alice.ID}, From: alice, Name: startCmd, Args: []string{g.ID}})
+	// Players can join also from the room of the game
+	b.HandleCommand(Command{Room: room, From: bob, Name: joinCmd})
+	b.HandleCommand(Command{Room: room, From: alice, Name: rulesCmd, Args: []string{"dice", "1"}})
+	g.SetDiceRoller(&ScriptedRoller{Dice: []Dice{TWO}})
+	b.HandleCommand(Command{Room: room, From: alice, Name: beginCmd})
+	if last(m.private[1]) == "" || !strings.HasPrefix(last(m.private[2]), "Your Bluff hand in Lobby (Table 1):\n2\n") {
+		t.Error(m.private)
+	}
+
+	// Bids are made with the buttons of the status message
+	if !reflect.DeepEqual(m.buttons[0][0], Button{Text: "1 1️⃣", Data: "bid 1 1"}) {
+		t.Fatal(m.buttons)
+	}
+	b.HandleButtonPress(ButtonPress{ID: "p1", Room: room, From: bob, MessageID: m.buttonsID, Data: m.buttons[0][0].Data})
+	if m.answers["p1"] != "It's Alice's turn" {
+		t.Error(m.answers)
+	}
+	b.HandleButtonPress(ButtonPress{ID: "p2", Room: room, From: alice, MessageID: m.buttonsID, Data: m.buttons[0][2].Data})
+	if m.answers["p2"] != "" || last(m.rooms[7]) != "Alice bid 1 3s. It's Bob's turn." {
+		t.Error(m.answers, m.rooms[7])
+	}
+
+	b.HandleCommand(Command{Room: room, From: bob, Name: challengeCmd})
+	if !strings.HasPrefix(last(m.rooms[7]), "Alice: 2 (salt") {
+		t.Error(m.rooms[7])
+	}
+	if !strings.HasSuffix(last(m.rooms[7]), "Game finished! Bob is the winner!\n\nSend /stats, /leaderboard or /rating command to see how everyone has done in this chat.") || m.finals != 1 {
+		t.Error(m.rooms[7])
+	}
+	if _, found := onlyGame(b, 7); found {
+		t.Error("Game not removed")
+	}
+	stats, _ := b.loadStats(7)
+	if stats[1].Username != "alice" || stats[2].GamesWon != 1 {
+		t.Error(stats)
+	}
+}
@@ -0,0 +1,290 @@
+// bluff-cli plays a game of Bluff in a terminal, without Telegram. Human players share the terminal and take turns
+// at the keyboard (hot seat), and computer-controlled players can join them. The screen is cleared between the
+// turns of human players, so that nobody sees the others' hands.
+//
+// Usage:
+//
+//	bluff-cli [-bots normal,hard] [-rules "variant perudo dice 3"] [-seed text] name...
+//
+// On their turn, players make a bid with the same syntax as the /bid command of the bot, e.g. "5 *" or "3 4", or
+// send "challenge" or "exact".
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/khuttun/bluffbot/bluff"
+)
+
+func main() {
+	bots := flag.String("bots", "", "Comma-separated difficulties of computer-controlled players, e.g. easy,normal,hard")
+	rules := flag.String("rules", "", "Rules as \"rule value\" pairs, like the /rules command of the bot")
+	seed := flag.String("seed", "", "Roll the dice from this seed, so that the same seed gives the same game")
+	noClear := flag.Bool("noclear", false, "Don't clear the screen between the turns of human players")
+	flag.Parse()
+
+	g := &bluff.Game{}
+	for i, name := range flag.Args() {
+		if err := g.AddPlayer(bluff.PlayerInfo{ID: i + 1, Name: name}); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *bots != "" {
+		for i, difficulty := range strings.Split(*bots, ",") {
+			p := bluff.PlayerInfo{ID: -(i + 1), Name: fmt.Sprintf("Bot %v (%v)", i+1, difficulty)}
+			if err := g.AddAIPlayer(p, difficulty); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	}
+	if *rules != "" {
+		r, err := g.Rules.Apply(strings.Fields(*rules))
+		if err == nil {
+			err = g.SetRules(r)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *seed != "" {
+		g.SetDiceRoller(bluff.NewSeededRoller([]byte(*seed)))
+	}
+
+	if err := g.StartGame(); err != nil {
+		fmt.Println(err)
+		fmt.Println("Usage: bluff-cli [-bots difficulties] [-rules rules] [-seed text] name...")
+		os.Exit(1)
+	}
+
+	c := cli{g: g, in: bufio.NewScanner(os.Stdin), out: os.Stdout, clear: !*noClear}
+	if err := c.play(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// cli plays a game with the players sharing a terminal
+type cli struct {
+	g     *bluff.Game
+	in    *bufio.Scanner
+	out   io.Writer
+	clear bool
+	// Number of human players sharing the terminal
+	humans int
+	// The human player who last had the keyboard, and whether they've seen their hand of the current round
+	lastID    int
+	handShown bool
+}
+
+// Play the game until it finishes
+func (c *cli) play() error {
+	g := c.g
+	for _, p := range g.Players {
+		if !g.IsAI(p.Info.ID) {
+			c.humans++
+		}
+	}
+	fmt.Fprintf(c.out, "Rules: %v.\n", g.Rules)
+	for g.State == bluff.STARTED {
+		p := g.Players[g.TurnIdx].Info
+		if g.IsAI(p.ID) {
+			if err := c.aiTurn(p); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := c.humanTurn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Make the move of a computer-controlled player. If the move fails, the player makes the minimal bid, challenges
+// the current bid or is eliminated instead, like with the bot.
+func (c *cli) aiTurn(p bluff.PlayerInfo) error {
+	g := c.g
+	m, err := g.AIMove()
+	if err == nil {
+		if m.Challenge {
+			err = c.call(p, "challenged", func() (bluff.ChallengeResult, error) { return g.ChallengeCurrentBid(p.ID) })
+		} else {
+			err = c.bid(p, m.Bid)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	if bids := g.ValidBids(1); len(bids) > 0 {
+		b := bids[0]
+		b.PlayerID = p.ID
+		err = c.bid(p, b)
+	}
+	if err != nil && g.CurrentBid.Count > 0 {
+		err = c.call(p, "challenged", func() (bluff.ChallengeResult, error) { return g.ChallengeCurrentBid(p.ID) })
+	}
+	if err != nil {
+		err = c.eliminate(p)
+	}
+	return err
+}
+
+// Let a human player make a move. Invalid moves are asked again.
+func (c *cli) humanTurn(p bluff.PlayerInfo) error {
+	g := c.g
+	if c.lastID != p.ID || !c.handShown {
+		if err := c.handOver(p); err != nil {
+			return err
+		}
+	}
+	for {
+		fmt.Fprintf(c.out, "%v> ", p.Name)
+		if !c.in.Scan() {
+			if err := c.in.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("Input ended before the game finished")
+		}
+		fields := strings.Fields(c.in.Text())
+
+		var err error
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "challenge" || fields[0] == "c":
+			err = c.call(p, "challenged", func() (bluff.ChallengeResult, error) { return g.ChallengeCurrentBid(p.ID) })
+		case fields[0] == "exact" || fields[0] == "e":
+			err = c.call(p, "called exact", func() (bluff.ChallengeResult, error) { return g.CallExact(p.ID) })
+		case fields[0] == "quit":
+			g.Stop()
+			fmt.Fprintln(c.out, "Game ended")
+			return nil
+		case len(fields) == 2:
+			var b bluff.Bid
+			b, err = g.Rules.ParseBid(fields[0], fields[1])
+			if err == nil {
+				b.PlayerID = p.ID
+				err = c.bid(p, b)
+			}
+		default:
+			fmt.Fprintln(c.out, "Make a bid with \"count dice\", e.g. \"3 4\", or send challenge, exact or quit")
+			continue
+		}
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintln(c.out, err)
+	}
+}
+
+// Pass the turn to a human player who hasn't seen their current hand. With other humans at the terminal, the screen
+// is cleared and the hand is shown only once the player is at the keyboard.
+func (c *cli) handOver(p bluff.PlayerInfo) error {
+	g := c.g
+	if c.clear && c.humans > 1 && c.lastID != 0 {
+		fmt.Fprintf(c.out, "Pass the keyboard to %v and press enter.", p.Name)
+		if !c.in.Scan() {
+			return c.in.Err()
+		}
+		fmt.Fprint(c.out, "\033[H\033[2J")
+		fmt.Fprintln(c.out, c.status())
+		if b := g.CurrentBid; b.Count > 0 {
+			fmt.Fprintf(c.out, "Current bid: %v by %v\n", g.Rules.BidName(b), g.PlayerName(b.PlayerID))
+		}
+	}
+	c.lastID = p.ID
+	c.handShown = true
+	fmt.Fprintf(c.out, "%v, your hand: %v\n", p.Name, strings.Join(g.HandFaceNames(p.ID), " "))
+	return nil
+}
+
+// Make a bid and show it
+func (c *cli) bid(p bluff.PlayerInfo, b bluff.Bid) error {
+	if err := c.g.Bid(b); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%v bid %v\n", p.Name, c.g.Rules.BidName(b))
+	return nil
+}
+
+// Eliminate a player, e.g. a computer-controlled player who couldn't make a move
+func (c *cli) eliminate(p bluff.PlayerInfo) error {
+	if err := c.g.EliminatePlayer(p.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%v is out of the game.\n", p.Name)
+	c.handShown = false
+	c.roundEnded()
+	return nil
+}
+
+// End the round with call, revealing the hands and showing the result
+func (c *cli) call(p bluff.PlayerInfo, action string, call func() (bluff.ChallengeResult, error)) error {
+	// The call rolls new hands, so the old ones are collected first
+	g := c.g
+	revealed := ""
+	for _, q := range g.Players {
+		if len(q.Hand) > 0 {
+			revealed += fmt.Sprintf("%v: %v\n", q.Info.Name, strings.Join(g.Rules.HandFaceNames(q.Hand), " "))
+		}
+	}
+
+	r, err := call()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%v %v %v's bid of %v. The hands were:\n%v", p.Name, action, r.Bidder.Name, g.Rules.BidName(r.ChallengedBid), revealed)
+	switch r.Result {
+	case bluff.LOW_BID:
+		fmt.Fprintf(c.out, "The bid was good. %v loses %v dice.\n", r.Challenger.Name, r.LostDiceCount)
+	case bluff.EXACT_BID:
+		fmt.Fprintf(c.out, "The bid was exactly right, %v dice lost.\n", r.LostDiceCount)
+	case bluff.HIGH_BID:
+		fmt.Fprintf(c.out, "The bid was too high. %v loses %v dice.\n", r.Bidder.Name, r.LostDiceCount)
+	case bluff.EXACT_CALL_WON:
+		fmt.Fprintf(c.out, "The bid was exactly right! %v gets back %v dice.\n", r.Challenger.Name, r.GainedDiceCount)
+	case bluff.EXACT_CALL_LOST:
+		fmt.Fprintf(c.out, "The bid wasn't exactly right. %v loses %v dice.\n", r.Challenger.Name, r.LostDiceCount)
+	}
+
+	// Everyone has a new hand, which the next human player hasn't seen yet
+	c.handShown = false
+	c.roundEnded()
+	return nil
+}
+
+// Show the winner of a finished game, or start the next round
+func (c *cli) roundEnded() {
+	g := c.g
+	if g.State == bluff.FINISHED {
+		for _, w := range g.Players {
+			if len(w.Hand) > 0 {
+				fmt.Fprintf(c.out, "Game finished! %v is the winner!\n", w.Info.Name)
+			}
+		}
+		return
+	}
+	if g.Palifico {
+		fmt.Fprintln(c.out, "The next round is palifico: 1s aren't wild and the face of the first bid can't be changed.")
+	}
+	fmt.Fprintf(c.out, "%v\nStarting next round.\n", c.status())
+}
+
+// Show the number of dice each player has
+func (c *cli) status() string {
+	s := "Dice left:"
+	for _, p := range c.g.Players {
+		s += fmt.Sprintf(" %v %v,", p.Info.Name, len(p.Hand))
+	}
+	return strings.TrimSuffix(s, ",")
+}
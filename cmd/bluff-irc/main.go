@@ -0,0 +1,64 @@
+// bluff-irc runs the Bluff bot in IRC channels. Users send the bot's commands to a channel starting with ! instead
+// of /, e.g. "!start", "!join" and "!bid 3 4", and get their hands as private messages.
+//
+// Usage:
+//
+//	bluff-irc [-tls] [-nick bluffbot] [-stats stats.json] -server irc.example.org:6667 #channel...
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/khuttun/bluffbot/bluff"
+	"github.com/khuttun/bluffbot/irc"
+)
+
+func main() {
+	server := flag.String("server", "", "Address of the IRC server, host:port")
+	useTLS := flag.Bool("tls", false, "Connect to the server with TLS")
+	nick := flag.String("nick", "bluffbot", "Nick of the bot")
+	statsPath := flag.String("stats", "", "Keep the player stats in this JSON file instead of memory")
+	flag.Parse()
+
+	if *server == "" || flag.NArg() == 0 {
+		fmt.Println("Usage: bluff-irc [-tls] [-nick nick] [-stats file] -server host:port #channel...")
+		os.Exit(1)
+	}
+
+	var conn net.Conn
+	var err error
+	if *useTLS {
+		conn, err = tls.Dial("tcp", *server, nil)
+	} else {
+		conn, err = net.Dial("tcp", *server)
+	}
+	if err != nil {
+		fmt.Println("Failed to connect:", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	c := irc.NewClient(conn, *nick, flag.Args())
+	b, err := bluff.NewBotWithMessenger(c, bluff.NewMemoryStore())
+	if err != nil {
+		fmt.Println("Failed to create bot:", err)
+		os.Exit(1)
+	}
+	if *statsPath != "" {
+		stats, err := bluff.NewJSONFileStatsStore(*statsPath)
+		if err != nil {
+			fmt.Println("Failed to open stats:", err)
+			os.Exit(1)
+		}
+		b.SetStatsStore(stats)
+	}
+
+	if err := c.Run(b); err != nil {
+		fmt.Println("Connection failed:", err)
+		os.Exit(1)
+	}
+}
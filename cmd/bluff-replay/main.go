@@ -0,0 +1,70 @@
+// bluff-replay rebuilds games from the event log written by the bot and prints what happened in them. Every move is
+// replayed through the game rules, so a log that doesn't add up is reported.
+//
+// Usage:
+//
+//	bluff-replay [-game id] [events.jsonl]
+//
+// The events are read from standard input if no file is given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/khuttun/bluffbot/bluff"
+)
+
+func main() {
+	gameID := flag.String("game", "", "Replay only the game with this ID")
+	flag.Parse()
+
+	in := io.Reader(os.Stdin)
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	events, err := bluff.ReadEvents(in)
+	if err != nil {
+		fmt.Println("Failed to read events:", err)
+		os.Exit(1)
+	}
+
+	ok := true
+	// The replay of a game starts from its first event, with sequence number 1
+	replayers := make(map[string]*bluff.Replayer)
+	failed := make(map[string]bool)
+	for _, e := range events {
+		if *gameID != "" && e.GameID != *gameID {
+			continue
+		}
+		if e.Seq == 1 {
+			replayers[e.GameID] = bluff.NewReplayer()
+			failed[e.GameID] = false
+			fmt.Printf("\nGame %v\n", e.GameID)
+		}
+		r, found := replayers[e.GameID]
+		if !found || failed[e.GameID] {
+			continue
+		}
+
+		fmt.Printf("#%v %v %v\n", e.Seq, e.Time.Format("2006-01-02 15:04:05"), r.Describe(e))
+		if err := r.Apply(e); err != nil {
+			fmt.Printf("Game %v doesn't replay: %v\n", e.GameID, err)
+			failed[e.GameID] = true
+			ok = false
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,40 @@
+// bluff-server hosts games of Bluff behind an HTTP/JSON API, for embedding the game in web pages and dashboards.
+//
+// Usage:
+//
+//	bluff-server [-addr :8080]
+//
+// A game is played with these requests:
+//
+//	POST /games {"rules": "dice 3"}                        -> {"id": "<game id>", ...}
+//	POST /games/<game id>/players {"name": "Alice"}        -> {"player_id": 1, "token": "<token>"}
+//	POST /games/<game id>/start                            start the game once everyone has joined
+//	POST /games/<game id>/bid {"count": 3, "dice": "4"}    make a bid, "*" is the wild face
+//	POST /games/<game id>/challenge                        challenge the current bid
+//	POST /games/<game id>/exact                            call the current bid exactly right
+//	GET  /games/<game id>                                  get the state of the game
+//
+// The moves are made with the player's token in the Authorization header, "Bearer <token>". The state shows the
+// player's own hand when the token is given. Errors are returned as {"error": "..."}, with status 409 Conflict for
+// moves the rules don't allow, e.g. bidding out of turn.
+//
+// Games are removed a day after their last request, and finished games an hour after it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	flag.Parse()
+
+	fmt.Println("Listening on", *addr)
+	if err := http.ListenAndServe(*addr, newServer()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
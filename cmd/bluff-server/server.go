@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khuttun/bluffbot/bluff"
+)
+
+// server serves games over HTTP. Each game has an ID and each player a token, which is sent in the Authorization
+// header ("Bearer <token>") of the requests made as the player. Only the requests with a player's token see the
+// player's hand.
+type server struct {
+	mutex sync.Mutex
+	games map[string]*game
+	// Current time, replaced in tests
+	now func() time.Time
+}
+
+// Games without requests are removed after idleExpiry, finished games already after finishedExpiry
+const idleExpiry = 24 * time.Hour
+const finishedExpiry = time.Hour
+
+// game is a game hosted by the server
+type game struct {
+	id string
+	g  *bluff.Game
+	// Player IDs by token
+	tokens map[string]int
+	// The result of the last ended round, with the revealed hands
+	lastRound *roundJSON
+	// Time of the last request to the game
+	lastActive time.Time
+}
+
+// httpError is an error with the HTTP status to respond with
+type httpError struct {
+	status int
+	what   string
+}
+
+func (e *httpError) Error() string {
+	return e.what
+}
+
+type createRequest struct {
+	// Rules as "rule value" pairs, like the /rules command of the bot
+	Rules string `json:"rules"`
+}
+
+type joinRequest struct {
+	Name string `json:"name"`
+}
+
+type joinResponse struct {
+	PlayerID int    `json:"player_id"`
+	Token    string `json:"token"`
+}
+
+type bidJSON struct {
+	PlayerID int    `json:"player_id,omitempty"`
+	Count    int    `json:"count"`
+	Dice     string `json:"dice"`
+}
+
+type handJSON struct {
+	PlayerID int      `json:"player_id"`
+	Hand     []string `json:"hand"`
+}
+
+type roundJSON struct {
+	// One of low_bid, exact_bid, high_bid, exact_call_won and exact_call_lost
+	Result       string     `json:"result"`
+	Bid          bidJSON    `json:"bid"`
+	ChallengerID int        `json:"challenger_id"`
+	LostDice     int        `json:"lost_dice"`
+	GainedDice   int        `json:"gained_dice"`
+	Hands        []handJSON `json:"hands"`
+}
+
+type stateJSON struct {
+	ID      string                `json:"id"`
+	State   string                `json:"state"`
+	Rules   string                `json:"rules"`
+	Players []bluff.PlayerSummary `json:"players"`
+	// The ID of the player in turn, 0 if the game isn't going on
+	Turn       int      `json:"turn"`
+	CurrentBid *bidJSON `json:"current_bid,omitempty"`
+	Palifico   bool     `json:"palifico"`
+	// The hand of the player making the request
+	Hand      []string   `json:"hand,omitempty"`
+	LastRound *roundJSON `json:"last_round,omitempty"`
+}
+
+func newServer() *server {
+	return &server{games: make(map[string]*game), now: time.Now}
+}
+
+// Route the requests:
+//
+//	POST /games                  create a game, with optional rules
+//	GET  /games/{id}             get the state of a game
+//	POST /games/{id}/players     join a game, getting a player token
+//	POST /games/{id}/start       start a game
+//	POST /games/{id}/bid         make a bid
+//	POST /games/{id}/challenge   challenge the current bid
+//	POST /games/{id}/exact       call the current bid exactly right
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "games" || len(parts) > 3 {
+		writeError(w, &httpError{http.StatusNotFound, "Not found"})
+		return
+	}
+
+	var result interface{}
+	var err error
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		result, err = s.create(r)
+	case len(parts) == 1:
+		err = &httpError{http.StatusMethodNotAllowed, "Use POST to create a game"}
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		result, err = s.state(r, parts[1])
+	case len(parts) == 2:
+		err = &httpError{http.StatusMethodNotAllowed, "Use GET to get the state of a game"}
+	case r.Method != http.MethodPost:
+		err = &httpError{http.StatusMethodNotAllowed, "Use POST to make a move"}
+	default:
+		result, err = s.act(r, parts[1], parts[2])
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Respond with the status for err: 409 Conflict for moves the game doesn't allow, e.g. bidding out of turn
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch e := err.(type) {
+	case *httpError:
+		status = e.status
+	case *bluff.GameError:
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func (s *server) create(r *http.Request) (interface{}, error) {
+	var req createRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	g := &bluff.Game{}
+	if req.Rules != "" {
+		rules, err := g.Rules.Apply(strings.Fields(req.Rules))
+		if err != nil {
+			return nil, &httpError{http.StatusBadRequest, err.Error()}
+		}
+		if err := g.SetRules(rules); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.removeExpired()
+	gm := &game{id: bluff.NewToken(), g: g, tokens: make(map[string]int), lastActive: s.now()}
+	s.games[gm.id] = gm
+	return gm.state(0), nil
+}
+
+func (s *server) state(r *http.Request, id string) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	gm, err := s.game(id)
+	if err != nil {
+		return nil, err
+	}
+	// The state is public, the token only adds the player's hand
+	playerID := 0
+	if token := bearerToken(r); token != "" {
+		if playerID, err = gm.player(token); err != nil {
+			return nil, err
+		}
+	}
+	return gm.state(playerID), nil
+}
+
+// Make a move in a game
+func (s *server) act(r *http.Request, id string, action string) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	gm, err := s.game(id)
+	if err != nil {
+		return nil, err
+	}
+	if action == "players" {
+		return s.join(r, gm)
+	}
+
+	playerID, err := gm.player(bearerToken(r))
+	if err != nil {
+		return nil, err
+	}
+	switch action {
+	case "start":
+		err = gm.g.StartGame()
+	case "bid":
+		err = s.bid(r, gm, playerID)
+	case "challenge":
+		err = gm.endRound(func() (bluff.ChallengeResult, error) { return gm.g.ChallengeCurrentBid(playerID) })
+	case "exact":
+		err = gm.endRound(func() (bluff.ChallengeResult, error) { return gm.g.CallExact(playerID) })
+	default:
+		err = &httpError{http.StatusNotFound, fmt.Sprintf("Unknown action: %v", action)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gm.state(playerID), nil
+}
+
+func (s *server) join(r *http.Request, gm *game) (interface{}, error) {
+	var req joinRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, &httpError{http.StatusBadRequest, "Name missing"}
+	}
+	p := bluff.PlayerInfo{ID: len(gm.tokens) + 1, Name: req.Name}
+	if err := gm.g.AddPlayer(p); err != nil {
+		return nil, err
+	}
+	token := bluff.NewToken()
+	gm.tokens[token] = p.ID
+	return joinResponse{p.ID, token}, nil
+}
+
+func (s *server) bid(r *http.Request, gm *game, playerID int) error {
+	var req bidJSON
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	bid, err := gm.g.Rules.NewBid(req.Count, req.Dice)
+	if err != nil {
+		return &httpError{http.StatusBadRequest, err.Error()}
+	}
+	bid.PlayerID = playerID
+	return gm.g.Bid(bid)
+}
+
+// End the round with call, keeping the result and the hands revealed by it
+func (gm *game) endRound(call func() (bluff.ChallengeResult, error)) error {
+	// The call rolls new hands, so the old ones are collected first
+	var hands []handJSON
+	for _, p := range gm.g.Players {
+		if len(p.Hand) > 0 {
+			hands = append(hands, handJSON{p.Info.ID, gm.g.Rules.HandFaceNames(p.Hand)})
+		}
+	}
+	rules := gm.g.Rules
+	res, err := call()
+	if err != nil {
+		return err
+	}
+	gm.lastRound = &roundJSON{
+		Result:       res.Result.Name(),
+		Bid:          bidJSON{res.ChallengedBid.PlayerID, res.ChallengedBid.Count, rules.FaceName(res.ChallengedBid.Dice)},
+		ChallengerID: res.Challenger.ID,
+		LostDice:     res.LostDiceCount,
+		GainedDice:   res.GainedDiceCount,
+		Hands:        hands}
+	return nil
+}
+
+func (s *server) game(id string) (*game, error) {
+	gm, found := s.games[id]
+	if !found || gm.expired(s.now()) {
+		return nil, &httpError{http.StatusNotFound, fmt.Sprintf("No game %v", id)}
+	}
+	gm.lastActive = s.now()
+	return gm, nil
+}
+
+// Remove the games that have expired, so that abandoned games don't pile up
+func (s *server) removeExpired() {
+	now := s.now()
+	for id, gm := range s.games {
+		if gm.expired(now) {
+			delete(s.games, id)
+		}
+	}
+}
+
+func (gm *game) expired(now time.Time) bool {
+	idle := now.Sub(gm.lastActive)
+	return idle > idleExpiry || (gm.g.State == bluff.FINISHED && idle > finishedExpiry)
+}
+
+// Get the ID of the player with a token
+func (gm *game) player(token string) (int, error) {
+	if token == "" {
+		return 0, &httpError{http.StatusUnauthorized, "Player token missing"}
+	}
+	id, found := gm.tokens[token]
+	if !found {
+		return 0, &httpError{http.StatusForbidden, "Not a player of this game"}
+	}
+	return id, nil
+}
+
+// Get the state of a game as seen by a player. Player ID 0 sees no hands.
+func (gm *game) state(playerID int) stateJSON {
+	g := gm.g
+	st := stateJSON{ID: gm.id, State: g.State.Name(), Rules: g.Rules.String(), Players: g.PlayerSummaries(), Hand: g.HandFaceNames(playerID), Palifico: g.Palifico, LastRound: gm.lastRound}
+	if g.State == bluff.STARTED {
+		st.Turn = g.Players[g.TurnIdx].Info.ID
+		if b := g.CurrentBid; b.Count > 0 {
+			st.CurrentBid = &bidJSON{b.PlayerID, b.Count, g.Rules.FaceName(b.Dice)}
+		}
+	}
+	return st
+}
+
+// Decode the JSON body of a request. An empty body leaves v as it is.
+func decode(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		return &httpError{http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err)}
+	}
+	return nil
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
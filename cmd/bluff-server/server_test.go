@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Make a request to the server, decoding the JSON response to v if it's not nil. Returns the status.
+func do(t *testing.T, s *server, method string, path string, token string, body string, v interface{}) int {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestGameLifecycle(t *testing.T) {
+	s := newServer()
+	var st stateJSON
+	if code := do(t, s, "POST", "/games", "", `{"rules": "dice 1"}`, &st); code != http.StatusOK || st.State != "not_started" || !strings.HasPrefix(st.Rules, "1 dice per player") {
+		t.Fatal(code, st)
+	}
+	game := "/games/" + st.ID
+
+	var alice, bob joinResponse
+	if code := do(t, s, "POST", game+"/players", "", `{"name": "Alice"}`, &alice); code != http.StatusOK || alice.PlayerID != 1 || alice.Token == "" {
+		t.Fatal(code, alice)
+	}
+	do(t, s, "POST", game+"/players", "", `{"name": "Bob"}`, &bob)
+	if alice.Token == bob.Token {
+		t.Fatal(alice, bob)
+	}
+
+	if code := do(t, s, "POST", game+"/start", "", "", nil); code != http.StatusUnauthorized {
+		t.Error(code)
+	}
+	if code := do(t, s, "POST", game+"/start", "nope", "", nil); code != http.StatusForbidden {
+		t.Error(code)
+	}
+	if code := do(t, s, "POST", game+"/start", alice.Token, "", &st); code != http.StatusOK || st.State != "started" || st.Turn != 1 {
+		t.Fatal(code, st)
+	}
+
+	// Each player sees only their own hand
+	if do(t, s, "GET", game, bob.Token, "", &st); len(st.Hand) != 1 || len(st.Players) != 2 || st.Players[0].Dice != 1 {
+		t.Error(st)
+	}
+	var public stateJSON
+	if do(t, s, "GET", game, "", "", &public); public.Hand != nil {
+		t.Error(public)
+	}
+
+	var e map[string]string
+	if code := do(t, s, "POST", game+"/bid", bob.Token, `{"count": 1, "dice": "3"}`, &e); code != http.StatusConflict || e["error"] != "It's Alice's turn" {
+		t.Error(code, e)
+	}
+	if code := do(t, s, "POST", game+"/bid", alice.Token, `{"count": 1, "dice": "x"}`, nil); code != http.StatusBadRequest {
+		t.Error(code)
+	}
+	if code := do(t, s, "POST", game+"/bid", alice.Token, `{"count": 2, "dice": "3"}`, &st); code != http.StatusOK || st.Turn != 2 || *st.CurrentBid != (bidJSON{1, 2, "3"}) {
+		t.Fatal(code, st)
+	}
+
+	// Whoever loses the challenge loses their only dice, so the game ends
+	if code := do(t, s, "POST", game+"/challenge", bob.Token, "", &st); code != http.StatusOK || st.State != "finished" {
+		t.Fatal(code, st)
+	}
+	r := st.LastRound
+	if r == nil || r.ChallengerID != 2 || r.Bid.Count != 2 || len(r.Hands) != 2 || len(r.Hands[0].Hand) != 1 {
+		t.Error(r)
+	}
+	if code := do(t, s, "POST", game+"/players", "", `{"name": "Carol"}`, nil); code != http.StatusConflict {
+		t.Error(code)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newServer()
+	var tests = []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"GET", "/games", "", http.StatusMethodNotAllowed},
+		{"GET", "/games/unknown", "", http.StatusNotFound},
+		{"GET", "/other", "", http.StatusNotFound},
+		{"POST", "/games", `{"rules": "dice many"}`, http.StatusBadRequest},
+		{"POST", "/games", `{"rules": `, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if code := do(t, s, test.method, test.path, "", test.body, nil); code != test.expected {
+			t.Error(test, code)
+		}
+	}
+
+	var st stateJSON
+	do(t, s, "POST", "/games", "", "", &st)
+	if code := do(t, s, "POST", "/games/"+st.ID+"/players", "", `{"name": " "}`, nil); code != http.StatusBadRequest {
+		t.Error(code)
+	}
+	if code := do(t, s, "DELETE", "/games/"+st.ID+"/start", "", "", nil); code != http.StatusMethodNotAllowed {
+		t.Error(code)
+	}
+}
+
+func TestGamesExpire(t *testing.T) {
+	s := newServer()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	var idle, active, finished stateJSON
+	do(t, s, "POST", "/games", "", `{"rules": "dice 1"}`, &idle)
+	do(t, s, "POST", "/games", "", `{"rules": "dice 1"}`, &active)
+	do(t, s, "POST", "/games", "", `{"rules": "dice 1"}`, &finished)
+	var alice, bob joinResponse
+	game := "/games/" + finished.ID
+	do(t, s, "POST", game+"/players", "", `{"name": "Alice"}`, &alice)
+	do(t, s, "POST", game+"/players", "", `{"name": "Bob"}`, &bob)
+	do(t, s, "POST", game+"/start", alice.Token, "", nil)
+	do(t, s, "POST", game+"/bid", alice.Token, `{"count": 2, "dice": "3"}`, nil)
+	if do(t, s, "POST", game+"/challenge", bob.Token, "", &finished); finished.State != "finished" {
+		t.Fatal(finished)
+	}
+
+	created := now
+	now = now.Add(finishedExpiry + time.Minute)
+	if code := do(t, s, "GET", game, "", "", nil); code != http.StatusNotFound {
+		t.Error(code)
+	}
+	if code := do(t, s, "GET", "/games/"+active.ID, "", "", nil); code != http.StatusOK {
+		t.Error(code)
+	}
+
+	// Creating a game removes the expired ones
+	now = created.Add(idleExpiry + time.Minute)
+	do(t, s, "POST", "/games", "", "", nil)
+	if _, found := s.games[idle.ID]; found || len(s.games) != 2 {
+		t.Error(s.games)
+	}
+	if code := do(t, s, "GET", "/games/"+active.ID, "", "", nil); code != http.StatusOK {
+		t.Error(code)
+	}
+}
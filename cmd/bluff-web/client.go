@@ -0,0 +1,138 @@
+package main
+
+// indexHTML is the browser client. It connects to a room with a WebSocket, shows the state pushed by the server and
+// sends the moves of the player. The bid buttons are laid out four in a row, like the buttons of the bot.
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Bluff</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 1em auto; padding: 0 1em; }
+button { margin: 2px; min-width: 5em; padding: 0.4em; }
+#bids button { width: 23%; }
+.hand { font-size: 2em; letter-spacing: 0.3em; }
+.turn { font-weight: bold; }
+#log { color: #444; }
+#error { color: #b00; }
+.hidden { display: none; }
+</style>
+</head>
+<body>
+<h1>Bluff</h1>
+<form id="join">
+<input id="room" placeholder="Room" required>
+<input id="name" placeholder="Your name (empty to watch)">
+<button>Enter</button>
+</form>
+<div id="game" class="hidden">
+<p id="rules"></p>
+<ul id="players"></ul>
+<p>Your hand: <span id="hand" class="hand"></span></p>
+<p id="bid"></p>
+<div id="setup">
+<input id="rulesText" placeholder="Rules, e.g. dice 3">
+<button id="setRules">Set rules</button>
+<button id="start">Start</button>
+</div>
+<div id="bids"></div>
+<div id="calls">
+<button id="challenge">Challenge</button>
+<button id="exact">Exact</button>
+</div>
+<button id="new" class="hidden">New game</button>
+<p id="error"></p>
+<ol id="log"></ol>
+</div>
+<script>
+var ws = null;
+
+function send(action) {
+	ws.send(JSON.stringify(action));
+}
+
+function el(id) {
+	return document.getElementById(id);
+}
+
+function show(id, visible) {
+	el(id).classList.toggle("hidden", !visible);
+}
+
+function text(tag, content, className) {
+	var e = document.createElement(tag);
+	e.textContent = content;
+	if (className) {
+		e.className = className;
+	}
+	return e;
+}
+
+function render(s) {
+	el("rules").textContent = "Room " + s.room + ". Rules: " + s.rules + ".";
+	var players = el("players");
+	players.innerHTML = "";
+	s.players.forEach(function (p) {
+		var line = p.name + (p.id === s.you ? " (you)" : "") + (s.state === "not_started" ? "" : ": " + p.dice + " dice");
+		players.appendChild(text("li", line, p.id === s.turn ? "turn" : ""));
+	});
+	el("hand").textContent = s.hand.join(" ");
+	el("bid").textContent = s.current_bid ? "Current bid: " + s.current_bid.label + (s.palifico ? " (palifico round)" : "") : "";
+
+	var player = s.you !== 0;
+	var myTurn = player && s.state === "started" && s.turn === s.you;
+	show("setup", player && s.state === "not_started");
+	show("new", player && s.state === "finished");
+	var bids = el("bids");
+	bids.innerHTML = "";
+	if (myTurn) {
+		s.bids.forEach(function (b) {
+			var button = text("button", b.label);
+			button.onclick = function () { send({action: "bid", count: b.count, dice: b.dice}); };
+			bids.appendChild(button);
+		});
+	}
+	show("calls", myTurn && s.current_bid);
+
+	var log = el("log");
+	log.innerHTML = "";
+	s.log.slice().reverse().forEach(function (m) { log.appendChild(text("li", m)); });
+}
+
+el("join").onsubmit = function (e) {
+	e.preventDefault();
+	var room = el("room").value.trim();
+	var name = el("name").value.trim();
+	var key = "bluff:" + room + ":" + name;
+	var url = (location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws?room=" + encodeURIComponent(room) +
+		"&name=" + encodeURIComponent(name) + "&token=" + encodeURIComponent(localStorage.getItem(key) || "");
+	ws = new WebSocket(url);
+	ws.onmessage = function (m) {
+		var msg = JSON.parse(m.data);
+		if (msg.type === "welcome") {
+			localStorage.setItem(key, msg.token);
+		} else if (msg.type === "error") {
+			el("error").textContent = msg.error;
+		} else if (msg.type === "state") {
+			el("error").textContent = "";
+			render(msg);
+		}
+	};
+	ws.onclose = function () {
+		el("error").textContent = "Disconnected. Enter the room again to reconnect.";
+		show("join", true);
+	};
+	show("join", false);
+	show("game", true);
+};
+
+el("setRules").onclick = function () { send({action: "rules", rules: el("rulesText").value}); };
+el("start").onclick = function () { send({action: "start"}); };
+el("challenge").onclick = function () { send({action: "challenge"}); };
+el("exact").onclick = function () { send({action: "exact"}); };
+el("new").onclick = function () { send({action: "new"}); };
+</script>
+</body>
+</html>
+`
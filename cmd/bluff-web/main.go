@@ -0,0 +1,26 @@
+// bluff-web hosts games of Bluff for browsers, e.g. on a LAN. Open the server's address in a browser, enter a room
+// name and your name, and play with the others in the same room. The server pushes the state of the game to the
+// players over WebSockets, each player getting only their own hand.
+//
+// Usage:
+//
+//	bluff-web [-addr :8080]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	flag.Parse()
+
+	fmt.Println("Listening on", *addr)
+	if err := http.ListenAndServe(*addr, newServer()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/khuttun/bluffbot/bluff"
+)
+
+// server hosts rooms with one game each. Players and spectators connect to a room with a WebSocket at
+// /ws?room=<room>&name=<name>, and get the state of the room pushed to them after every change. Each player gets
+// their own hand, and a token for reconnecting as the same player with &token=<token>. A room is removed with its game
+// when its last client disconnects.
+type server struct {
+	mutex sync.Mutex
+	rooms map[string]*room
+}
+
+// room is a game and the clients connected to it
+type room struct {
+	name  string
+	mutex sync.Mutex
+	// Guarded by mutex
+	g       *bluff.Game
+	clients map[*client]bool
+	// Player IDs by token
+	tokens map[string]int
+	// Announcements of the moves made in the room, newest last
+	log []string
+}
+
+// client is a connection to a room. Spectators have player ID 0.
+type client struct {
+	ws       *wsConn
+	playerID int
+}
+
+// Number of bids offered to the player in turn, the same as the buttons of the bot
+const bidOptions = 16
+
+// Number of announcements sent with the state
+const logSize = 20
+
+// action is a message from a client: rules, start, bid, challenge, exact or new
+type action struct {
+	Action string `json:"action"`
+	// Rules as "rule value" pairs, like the /rules command of the bot
+	Rules string `json:"rules"`
+	Count int    `json:"count"`
+	Dice  string `json:"dice"`
+}
+
+type bidJSON struct {
+	Count int    `json:"count"`
+	Dice  string `json:"dice"`
+	Label string `json:"label"`
+}
+
+type stateJSON struct {
+	Type    string                `json:"type"`
+	Room    string                `json:"room"`
+	State   string                `json:"state"`
+	Rules   string                `json:"rules"`
+	Players []bluff.PlayerSummary `json:"players"`
+	// The ID of the player in turn, 0 if the game isn't going on
+	Turn       int      `json:"turn"`
+	CurrentBid *bidJSON `json:"current_bid,omitempty"`
+	Palifico   bool     `json:"palifico"`
+	// The ID of the player receiving the state, 0 for spectators, and their hand
+	You  int      `json:"you"`
+	Hand []string `json:"hand"`
+	// The bids the player in turn can make, lowest first
+	Bids []bidJSON `json:"bids"`
+	Log  []string  `json:"log"`
+}
+
+type welcomeJSON struct {
+	Type     string `json:"type"`
+	PlayerID int    `json:"player_id"`
+	Token    string `json:"token"`
+}
+
+type errorJSON struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+func newServer() *server {
+	return &server{rooms: make(map[string]*room)}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, indexHTML)
+	case "/ws":
+		s.serveWebSocket(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Get a room by name, creating it on first use. The server's mutex must be held.
+func (s *server) room(name string) *room {
+	rm, found := s.rooms[name]
+	if !found {
+		rm = &room{name: name, g: &bluff.Game{}, clients: make(map[*client]bool), tokens: make(map[string]int)}
+		s.rooms[name] = rm
+	}
+	return rm
+}
+
+// Connect a client to a room, creating the room if needed
+func (s *server) connect(roomName string, ws *wsConn, name string, token string) (*room, *client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rm := s.room(roomName)
+	return rm, rm.connect(ws, name, token)
+}
+
+// Disconnect a client from a room, removing the room if it was the last client
+func (s *server) disconnect(rm *room, c *client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if rm.disconnect(c) == 0 {
+		delete(s.rooms, rm.name)
+	}
+}
+
+func (s *server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	roomName := strings.TrimSpace(q.Get("room"))
+	if roomName == "" {
+		http.Error(w, "Room missing", http.StatusBadRequest)
+		return
+	}
+	ws, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	rm, c := s.connect(roomName, ws, strings.TrimSpace(q.Get("name")), q.Get("token"))
+	defer s.disconnect(rm, c)
+
+	for {
+		text, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var a action
+		if err := json.Unmarshal([]byte(text), &a); err != nil {
+			c.send(errorJSON{"error", "Invalid message"})
+			continue
+		}
+		rm.act(c, a)
+	}
+}
+
+// Add a client to the room. The client joins the game as a player if it has a player's token, or if it has a name
+// and the game hasn't started yet. Otherwise it's a spectator.
+func (rm *room) connect(ws *wsConn, name string, token string) *client {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	c := &client{ws: ws}
+	if id, found := rm.tokens[token]; found {
+		c.playerID = id
+	} else if name != "" {
+		p := bluff.PlayerInfo{ID: len(rm.tokens) + 1, Name: name}
+		if err := rm.g.AddPlayer(p); err != nil {
+			c.send(errorJSON{"error", err.Error() + ". You're watching the game."})
+		} else {
+			token = bluff.NewToken()
+			rm.tokens[token] = p.ID
+			c.playerID = p.ID
+			c.send(welcomeJSON{"welcome", p.ID, token})
+			rm.announce(fmt.Sprintf("%v joined", name))
+		}
+	}
+	rm.clients[c] = true
+	rm.broadcast()
+	return c
+}
+
+// Remove a client from the room. Returns the number of clients left.
+func (rm *room) disconnect(c *client) int {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	delete(rm.clients, c)
+	return len(rm.clients)
+}
+
+// Make a move for a client and push the new state to everyone
+func (rm *room) act(c *client, a action) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if c.playerID == 0 {
+		c.send(errorJSON{"error", "Spectators can't make moves"})
+		return
+	}
+
+	var err error
+	switch a.Action {
+	case "rules":
+		err = rm.setRules(a.Rules)
+	case "start":
+		if err = rm.g.StartGame(); err == nil {
+			rm.announce("The game begins")
+		}
+	case "bid":
+		err = rm.bid(c.playerID, a)
+	case "challenge":
+		err = rm.endRound("challenged", func() (bluff.ChallengeResult, error) { return rm.g.ChallengeCurrentBid(c.playerID) })
+	case "exact":
+		err = rm.endRound("called exact", func() (bluff.ChallengeResult, error) { return rm.g.CallExact(c.playerID) })
+	case "new":
+		err = rm.newGame()
+	default:
+		err = fmt.Errorf("Unknown action: %v", a.Action)
+	}
+	if err != nil {
+		c.send(errorJSON{"error", err.Error()})
+		return
+	}
+	rm.broadcast()
+}
+
+func (rm *room) bid(playerID int, a action) error {
+	b, err := rm.g.Rules.ParseBid(strconv.Itoa(a.Count), a.Dice)
+	if err != nil {
+		return err
+	}
+	b.PlayerID = playerID
+	if err := rm.g.Bid(b); err != nil {
+		return err
+	}
+	rm.announce(fmt.Sprintf("%v bid %v", rm.g.PlayerName(playerID), rm.g.Rules.BidName(b)))
+	return nil
+}
+
+// End the round with call, announcing the revealed hands and the result
+func (rm *room) endRound(what string, call func() (bluff.ChallengeResult, error)) error {
+	// The call rolls new hands, so the old ones are collected first
+	g := rm.g
+	var hands []string
+	for _, p := range g.Players {
+		if len(p.Hand) > 0 {
+			hands = append(hands, fmt.Sprintf("%v %v", p.Info.Name, strings.Join(g.Rules.HandFaceNames(p.Hand), " ")))
+		}
+	}
+	r, err := call()
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("%v %v %v's bid of %v. Hands: %v. ", r.Challenger.Name, what, r.Bidder.Name, g.Rules.BidName(r.ChallengedBid), strings.Join(hands, ", "))
+	switch r.Result {
+	case bluff.LOW_BID:
+		msg += fmt.Sprintf("The bid was good, %v loses %v dice.", r.Challenger.Name, r.LostDiceCount)
+	case bluff.EXACT_BID:
+		msg += fmt.Sprintf("The bid was exactly right, %v dice lost.", r.LostDiceCount)
+	case bluff.HIGH_BID:
+		msg += fmt.Sprintf("The bid was too high, %v loses %v dice.", r.Bidder.Name, r.LostDiceCount)
+	case bluff.EXACT_CALL_WON:
+		msg += fmt.Sprintf("The bid was exactly right! %v gets back %v dice.", r.Challenger.Name, r.GainedDiceCount)
+	case bluff.EXACT_CALL_LOST:
+		msg += fmt.Sprintf("The bid wasn't exactly right, %v loses %v dice.", r.Challenger.Name, r.LostDiceCount)
+	}
+	rm.announce(msg)
+
+	if g.State == bluff.FINISHED {
+		for _, p := range g.Players {
+			if len(p.Hand) > 0 {
+				rm.announce(fmt.Sprintf("Game finished! %v is the winner!", p.Info.Name))
+			}
+		}
+	} else if g.Palifico {
+		rm.announce("The next round is palifico: 1s aren't wild and the face of the first bid can't be changed.")
+	}
+	return nil
+}
+
+func (rm *room) setRules(settings string) error {
+	r, err := rm.g.Rules.Apply(strings.Fields(settings))
+	if err != nil {
+		return err
+	}
+	if err := rm.g.SetRules(r); err != nil {
+		return err
+	}
+	rm.announce(fmt.Sprintf("Rules: %v", rm.g.Rules))
+	return nil
+}
+
+// Start over with the same players and rules once the game has finished
+func (rm *room) newGame() error {
+	if rm.g.State != bluff.FINISHED {
+		return fmt.Errorf("The game hasn't finished yet")
+	}
+	g := &bluff.Game{}
+	if err := g.SetRules(rm.g.Rules); err != nil {
+		return err
+	}
+	for _, p := range rm.g.Players {
+		if err := g.AddPlayer(p.Info); err != nil {
+			return err
+		}
+	}
+	rm.g = g
+	rm.announce("New game created. Start it once everyone is ready.")
+	return nil
+}
+
+func (rm *room) announce(msg string) {
+	rm.log = append(rm.log, msg)
+	if len(rm.log) > logSize {
+		rm.log = rm.log[len(rm.log)-logSize:]
+	}
+}
+
+// Push the state of the room to every client
+func (rm *room) broadcast() {
+	for c := range rm.clients {
+		c.send(rm.state(c.playerID))
+	}
+}
+
+// Get the state of the room as seen by a player. Player ID 0 sees no hands.
+func (rm *room) state(playerID int) stateJSON {
+	g := rm.g
+	st := stateJSON{Type: "state", Room: rm.name, State: g.State.Name(), Rules: g.Rules.String(), Players: g.PlayerSummaries(), Palifico: g.Palifico, You: playerID, Hand: g.HandFaceNames(playerID), Bids: []bidJSON{}, Log: rm.log}
+	if g.State == bluff.STARTED {
+		st.Turn = g.Players[g.TurnIdx].Info.ID
+		if b := g.CurrentBid; b.Count > 0 {
+			st.CurrentBid = &bidJSON{b.Count, g.Rules.FaceName(b.Dice), g.Rules.BidName(b)}
+		}
+		for _, b := range g.ValidBids(bidOptions) {
+			st.Bids = append(st.Bids, bidJSON{b.Count, g.Rules.FaceName(b.Dice), g.Rules.BidName(b)})
+		}
+	}
+	return st
+}
+
+// Send a message to the client. A client that can't be written to has gone away, and is left for its reader to
+// remove.
+func (c *client) send(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	c.ws.WriteMessage(string(data))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khuttun/bluffbot/bluff"
+)
+
+func TestIndex(t *testing.T) {
+	s := httptest.NewServer(newServer())
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Error(resp)
+	}
+}
+
+func TestRoom(t *testing.T) {
+	srv := newServer()
+	s := httptest.NewServer(srv)
+	defer s.Close()
+
+	alice := dial(t, s, "/ws?room=lan&name=Alice")
+	var welcome welcomeJSON
+	alice.read(t, "welcome", &welcome)
+	if welcome.PlayerID != 1 || welcome.Token == "" {
+		t.Fatal(welcome)
+	}
+	bob := dial(t, s, "/ws?room=lan&name=Bob")
+	bob.read(t, "welcome", &welcome)
+
+	var st stateJSON
+	alice.send(action{Action: "rules", Rules: "dice 2"})
+	alice.read(t, "state", &st)
+	for !strings.HasPrefix(st.Rules, "2 dice") {
+		alice.read(t, "state", &st)
+	}
+	alice.send(action{Action: "start"})
+	for st.State != "started" {
+		alice.read(t, "state", &st)
+	}
+
+	// Each player gets their own hand only
+	var bobState stateJSON
+	for bobState.State != "started" {
+		bob.read(t, "state", &bobState)
+	}
+	srv.mutex.Lock()
+	rm := srv.rooms["lan"]
+	srv.mutex.Unlock()
+	rm.mutex.Lock()
+	g := rm.g
+	hands := [][]string{g.Rules.HandFaceNames(g.Players[0].Hand), g.Rules.HandFaceNames(g.Players[1].Hand)}
+	bids := g.ValidBids(bidOptions)
+	var want []bidJSON
+	for _, b := range bids {
+		want = append(want, bidJSON{b.Count, g.Rules.FaceName(b.Dice), g.Rules.BidName(b)})
+	}
+	rm.mutex.Unlock()
+	if strings.Join(st.Hand, "") != strings.Join(hands[0], "") || strings.Join(bobState.Hand, "") != strings.Join(hands[1], "") {
+		t.Error(st.Hand, bobState.Hand)
+	}
+
+	// The bids are offered in the same order as the buttons of the bot
+	if len(st.Bids) != len(want) || st.Turn != 1 {
+		t.Fatal(st)
+	}
+	for i := range want {
+		if st.Bids[i] != want[i] {
+			t.Error(i, st.Bids[i])
+		}
+	}
+
+	var e errorJSON
+	bob.send(action{Action: "bid", Count: 1, Dice: "3"})
+	bob.read(t, "error", &e)
+	if e.Error != "It's Alice's turn" {
+		t.Error(e)
+	}
+	alice.send(action{Action: "bid", Count: st.Bids[3].Count, Dice: st.Bids[3].Dice})
+	for bobState.Turn != 2 {
+		bob.read(t, "state", &bobState)
+	}
+	if bobState.CurrentBid == nil || *bobState.CurrentBid != st.Bids[3] || bobState.Log[len(bobState.Log)-1] != "Alice bid "+st.Bids[3].Label {
+		t.Error(bobState)
+	}
+
+	// A spectator sees the game without hands and can't make moves
+	carol := dial(t, s, "/ws?room=lan&name=Carol")
+	carol.read(t, "error", &e)
+	var carolState stateJSON
+	carol.read(t, "state", &carolState)
+	if carolState.You != 0 || len(carolState.Hand) != 0 || len(carolState.Players) != 2 {
+		t.Error(carolState)
+	}
+	carol.send(action{Action: "challenge"})
+	carol.read(t, "error", &e)
+	if e.Error != "Spectators can't make moves" {
+		t.Error(e)
+	}
+
+	// Reconnecting with the token continues as the same player
+	bob2 := dial(t, s, "/ws?room=lan&token="+welcome.Token)
+	bob2.send(action{Action: "challenge"})
+	// The result may be followed by the palifico announcement
+	for !challenged(bobState.Log) {
+		bob2.read(t, "state", &bobState)
+	}
+	if bobState.You != 2 {
+		t.Error(bobState.You)
+	}
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if rm.g.State == bluff.STARTED && rm.g.Round != 2 {
+		t.Error(rm.g.Round)
+	}
+}
+
+func TestRoomRemoved(t *testing.T) {
+	srv := newServer()
+	s := httptest.NewServer(srv)
+	defer s.Close()
+
+	alice := dial(t, s, "/ws?room=lan&name=Alice")
+	alice.read(t, "welcome", &welcomeJSON{})
+	bob := dial(t, s, "/ws?room=lan&name=Bob")
+	bob.read(t, "welcome", &welcomeJSON{})
+	alice.conn.Close()
+	bob.conn.Close()
+
+	// The server notices the closed connections when it next reads from them
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		srv.mutex.Lock()
+		n := len(srv.rooms)
+		srv.mutex.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A new room with the same name has a new game
+	carol := dial(t, s, "/ws?room=lan&name=Carol")
+	var welcome welcomeJSON
+	carol.read(t, "welcome", &welcome)
+	if welcome.PlayerID != 1 {
+		t.Error(welcome)
+	}
+}
+
+func challenged(log []string) bool {
+	for _, m := range log {
+		if strings.HasPrefix(m, "Bob challenged Alice's bid") {
+			return true
+		}
+	}
+	return false
+}
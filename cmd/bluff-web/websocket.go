@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wsConn is the server side of a WebSocket connection (RFC 6455). Only text messages are supported. Pings are
+// answered and a close frame ends the connection.
+type wsConn struct {
+	conn net.Conn
+	in   *bufio.Reader
+	// Serializes writing frames
+	writeMutex sync.Mutex
+}
+
+// Opcodes of the frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Longest message accepted from a client
+const maxMessageSize = 64 * 1024
+
+// Time limit for writing a frame, so that one stuck client can't block the others
+const writeTimeout = 5 * time.Second
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Compute the Sec-WebSocket-Accept header for the Sec-WebSocket-Key sent by the client
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Browsers send the Origin header with WebSocket handshakes, and don't restrict them to the page's own site like
+// other requests. Check that the page opening the connection is served by this server, so that other sites can't
+// connect as the user. Clients other than browsers don't send the header.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade an HTTP request to a WebSocket connection. An error response is written if the request isn't a WebSocket
+// handshake.
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "Expecting a WebSocket handshake", http.StatusBadRequest)
+		return nil, fmt.Errorf("Not a WebSocket handshake")
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "Cross-origin WebSocket requests aren't allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("Cross-origin WebSocket request from %v", r.Header.Get("Origin"))
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("Unsupported WebSocket version")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Can't upgrade the connection", http.StatusInternalServerError)
+		return nil, fmt.Errorf("Response can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"
+	resp += "Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, in: rw.Reader}, nil
+}
+
+// Does a comma-separated header have token, ignoring case?
+func headerContains(h http.Header, name string, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Read the next text message. Returns io.EOF once the client has closed the connection.
+func (c *wsConn) ReadMessage() (string, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return "", err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return "", err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return "", io.EOF
+		case opBinary:
+			return "", fmt.Errorf("Binary messages aren't supported")
+		case opText, opContinuation:
+			msg = append(msg, payload...)
+			if len(msg) > maxMessageSize {
+				return "", fmt.Errorf("Message too long")
+			}
+		default:
+			return "", fmt.Errorf("Unknown opcode %v", op)
+		}
+		if fin {
+			return string(msg), nil
+		}
+	}
+}
+
+// Read a frame, unmasking its payload
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.in, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.in, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.in, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		err = fmt.Errorf("Frame too long")
+		return
+	}
+	// Clients must mask their frames
+	if !masked {
+		err = fmt.Errorf("Unmasked frame from client")
+		return
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.in, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.in, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// Send a text message
+func (c *wsConn) WriteMessage(text string) error {
+	return c.writeFrame(opText, []byte(text))
+}
+
+// Write a final, unmasked frame
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(append(frame, 127), ext[:]...)
+	}
+	frame = append(frame, payload...)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
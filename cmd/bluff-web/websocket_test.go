@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example of RFC 6455
+	if k := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); k != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Error(k)
+	}
+}
+
+// wsClient is the client side of a WebSocket connection, for testing the server
+type wsClient struct {
+	conn net.Conn
+	in   *bufio.Reader
+}
+
+// Connect to a WebSocket server at path
+func dial(t *testing.T, s *httptest.Server, path string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(s.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET %v HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n", path)
+	fmt.Fprintf(conn, "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	in := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(in, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal(resp)
+	}
+	return &wsClient{conn, in}
+}
+
+// Send a masked frame
+func (c *wsClient) writeFrame(fin bool, op byte, payload []byte) {
+	first := op
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *wsClient) send(v interface{}) {
+	data, _ := json.Marshal(v)
+	c.writeFrame(true, opText, data)
+}
+
+// Read a frame from the server
+func (c *wsClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.in, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7F)
+	if header[1]&0x80 != 0 {
+		t.Fatal("Masked frame from server")
+	}
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.in, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.in, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// Read the next message of the given type, decoding it to v
+func (c *wsClient) read(t *testing.T, msgType string, v interface{}) {
+	t.Helper()
+	for {
+		op, payload := c.readFrame(t)
+		if op != opText {
+			continue
+		}
+		var msg struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(payload, &msg)
+		if msg.Type == msgType {
+			if err := json.Unmarshal(payload, v); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+}
+
+// Echo server for testing the frames
+func echo(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	for {
+		msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		ws.WriteMessage(msg)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(echo))
+	defer s.Close()
+	c := dial(t, s, "/")
+
+	c.writeFrame(true, opText, []byte("hello"))
+	if op, p := c.readFrame(t); op != opText || string(p) != "hello" {
+		t.Error(op, string(p))
+	}
+
+	// Fragmented messages are joined, and pings between the fragments are answered
+	long := strings.Repeat("x", 300)
+	c.writeFrame(false, opText, []byte(long))
+	c.writeFrame(true, opPing, []byte("ping"))
+	c.writeFrame(true, opContinuation, []byte("y"))
+	if op, p := c.readFrame(t); op != opPong || string(p) != "ping" {
+		t.Error(op, string(p))
+	}
+	if op, p := c.readFrame(t); op != opText || string(p) != long+"y" {
+		t.Error(op, len(p))
+	}
+
+	c.writeFrame(true, opClose, nil)
+	if op, _ := c.readFrame(t); op != opClose {
+		t.Error(op)
+	}
+}
+
+func TestNotWebSocket(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(echo))
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error(resp.Status)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	var tests = []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{"http://example.com", true},
+		{"https://EXAMPLE.com", true},
+		{"http://evil.example.org", false},
+		{"http://example.com:8080", false},
+		{"null", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "http://example.com/ws", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if sameOrigin(r) != test.allowed {
+			t.Error(test)
+		}
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(echo))
+	defer s.Close()
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Origin", "http://evil.example.org")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Error(resp.Status)
+	}
+}
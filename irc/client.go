@@ -0,0 +1,249 @@
+// Package irc runs Bluff games in IRC channels. Client is a bluff.Messenger: the commands users send to the joined
+// channels are passed to a bluff.Bot, and the hands are sent to the players as private messages.
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/khuttun/bluffbot/bluff"
+)
+
+// Client is an IRC client playing Bluff. IRC clients take lines starting with / as their own commands, so users
+// start the bot's commands with ! instead, e.g. "!bid 3 4", and the commands mentioned in the bot's messages are
+// written the same way. Players join a game by sending "!join" to its channel, followed by the name of the game's
+// table if the channel has several games.
+//
+// Channels and nicks get IDs hashed from their names: channels negative, nicks positive. A user changing their nick
+// is a new user for the bot.
+type Client struct {
+	nick     string
+	channels []string
+	conn     io.ReadWriter
+	// Serializes writing to conn
+	writeMutex sync.Mutex
+	// Guards names, texts and lastID
+	mutex sync.Mutex
+	// Names of the channels and the nicks seen so far, keyed by their IDs
+	names map[int]string
+	// IRC messages can't be edited, so an edited message is sent again if its text changed. The latest texts of the
+	// messages are kept by message ID.
+	texts  map[int]string
+	lastID int
+}
+
+const commandPrefix = "!"
+const joinCmd = "!join"
+
+// Commands mentioned in the bot's messages, e.g. "send /begin command"
+var commandMention = regexp.MustCompile(`(^|[\s"])/([a-z]+)`)
+
+// Create a client talking to an IRC server over conn, e.g. a connection made with net.Dial. The client joins
+// channels once registered.
+func NewClient(conn io.ReadWriter, nick string, channels []string) *Client {
+	return &Client{nick: nick, channels: channels, conn: conn, names: make(map[int]string), texts: make(map[int]string)}
+}
+
+// Register with the server and pass the commands of the users to b until the connection is closed
+func (c *Client) Run(b *bluff.Bot) error {
+	if err := c.write("NICK %v", c.nick); err != nil {
+		return err
+	}
+	if err := c.write("USER %v 0 * :Bluff bot", c.nick); err != nil {
+		return err
+	}
+
+	in := bufio.NewScanner(c.conn)
+	for in.Scan() {
+		m := parseMessage(in.Text())
+		switch m.command {
+		case "001": // Welcome: registration done
+			if len(c.channels) > 0 {
+				if err := c.write("JOIN %v", strings.Join(c.channels, ",")); err != nil {
+					return err
+				}
+			}
+		case "PING":
+			if err := c.write("PONG :%v", m.trailing()); err != nil {
+				return err
+			}
+		case "PRIVMSG":
+			if len(m.params) == 2 {
+				c.onPrivmsg(b, m.nick(), m.params[0], m.params[1])
+			}
+		}
+	}
+	return in.Err()
+}
+
+// Handle a message sent by a user to a channel or to the bot. Only commands are handled, other chatter is ignored.
+func (c *Client) onPrivmsg(b *bluff.Bot, nick string, target string, text string) {
+	if nick == "" || !strings.HasPrefix(text, commandPrefix) {
+		return
+	}
+	from := bluff.User{ID: c.id(nick, false), Name: nick, Username: nick}
+	private := bluff.Room{ID: from.ID, Title: nick}
+	parts := strings.Fields(text)
+
+	if !isChannel(target) {
+		b.HandleCommand(bluff.Command{Room: private, From: from, Name: "/" + parts[0][1:], Args: parts[1:]})
+		return
+	}
+	room := bluff.Room{ID: c.id(target, true), Title: target}
+	b.HandleCommand(bluff.Command{Room: room, From: from, Name: "/" + parts[0][1:], Args: parts[1:]})
+}
+
+// Get the ID of a channel or a nick, remembering its name
+func (c *Client) id(name string, channel bool) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(name)))
+	id := int(h.Sum32()&0x7fffffff) + 1
+	if channel {
+		id = -id
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.names[id] = name
+	return id
+}
+
+func (c *Client) name(id int) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	name, found := c.names[id]
+	if !found {
+		return "", fmt.Errorf("Unknown channel or nick: %v", id)
+	}
+	return name, nil
+}
+
+func isChannel(target string) bool {
+	return strings.HasPrefix(target, "#") || strings.HasPrefix(target, "&")
+}
+
+// Write a line to the server
+func (c *Client) write(format string, a ...interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := fmt.Fprintf(c.conn, format+"\r\n", a...)
+	return err
+}
+
+// Send text to a channel or a nick, one line at a time. IRC messages can't be empty, so empty lines are skipped.
+func (c *Client) privmsg(id int, text string) error {
+	target, err := c.name(id)
+	if err != nil {
+		return err
+	}
+	text = commandMention.ReplaceAllString(text, "${1}"+commandPrefix+"${2}")
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := c.write("PRIVMSG %v :%v", target, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) Send(roomID int, text string) error {
+	return c.privmsg(roomID, text)
+}
+
+// There are no buttons in IRC, so only the text is sent
+func (c *Client) SendWithButtons(roomID int, text string, buttons [][]bluff.Button) (int, error) {
+	if err := c.privmsg(roomID, text); err != nil {
+		return 0, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lastID++
+	c.texts[c.lastID] = text
+	return c.lastID, nil
+}
+
+func (c *Client) SendFinal(roomID int, text string) error {
+	return c.privmsg(roomID, text)
+}
+
+// The new text is sent as a new message, unless only the buttons were changed
+func (c *Client) Edit(roomID int, messageID int, text string, buttons [][]bluff.Button) error {
+	c.mutex.Lock()
+	old := c.texts[messageID]
+	c.texts[messageID] = text
+	c.mutex.Unlock()
+	if text == old {
+		return nil
+	}
+	return c.privmsg(roomID, text)
+}
+
+func (c *Client) SendPrivate(userID int, text string) error {
+	return c.privmsg(userID, text)
+}
+
+// There are no buttons in IRC to answer
+func (c *Client) AnswerPress(pressID string, text string) error {
+	return nil
+}
+
+func (c *Client) JoinInstructions(g *bluff.Game) string {
+	return fmt.Sprintf("Send \"%v %v\" to join the game. Your hands will come as private messages from %v.", joinCmd, g.Name, c.nick)
+}
+
+func (c *Client) Emoji() bool {
+	return false
+}
+
+// message is a line received from the server, e.g. ":alice!a@host PRIVMSG #bluff :!bid 3 4"
+type message struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+func parseMessage(line string) message {
+	var m message
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		i := strings.Index(line, " ")
+		if i < 0 {
+			return message{prefix: line[1:]}
+		}
+		m.prefix, line = line[1:i], line[i+1:]
+	}
+	trailing, hasTrailing := "", false
+	if i := strings.Index(line, " :"); i >= 0 {
+		line, trailing, hasTrailing = line[:i], line[i+2:], true
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		m.command, m.params = strings.ToUpper(fields[0]), fields[1:]
+	}
+	if hasTrailing {
+		m.params = append(m.params, trailing)
+	}
+	return m
+}
+
+// Get the nick of the sender
+func (m message) nick() string {
+	if i := strings.Index(m.prefix, "!"); i >= 0 {
+		return m.prefix[:i]
+	}
+	return m.prefix
+}
+
+// Get the last parameter, empty if there are none
+func (m message) trailing() string {
+	if len(m.params) == 0 {
+		return ""
+	}
+	return m.params[len(m.params)-1]
+}
@@ -0,0 +1,143 @@
+package irc
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/khuttun/bluffbot/bluff"
+	"github.com/khuttun/bluffbot/irc/irctest"
+)
+
+func TestParseMessage(t *testing.T) {
+	var tests = []struct {
+		line     string
+		expected message
+	}{
+		{"PING :irc.example.org", message{"", "PING", []string{"irc.example.org"}}},
+		{":alice!a@host PRIVMSG #bluff :!bid 3 4\r\n", message{"alice!a@host", "PRIVMSG", []string{"#bluff", "!bid 3 4"}}},
+		{":irc.example.org 001 bluffbot :Welcome", message{"irc.example.org", "001", []string{"bluffbot", "Welcome"}}},
+		{":bob!b@host join #bluff", message{"bob!b@host", "JOIN", []string{"#bluff"}}},
+	}
+
+	for _, test := range tests {
+		if m := parseMessage(test.line); !reflect.DeepEqual(m, test.expected) {
+			t.Error(test.line, m)
+		}
+	}
+	if n := parseMessage(tests[1].line).nick(); n != "alice" {
+		t.Error(n)
+	}
+}
+
+func TestIDs(t *testing.T) {
+	c := NewClient(nil, "bluffbot", nil)
+	channel := c.id("#Bluff", true)
+	nick := c.id("Alice", false)
+	if channel >= 0 || nick <= 0 || c.id("#bluff", true) != channel || c.id("alice", false) != nick {
+		t.Error(channel, nick)
+	}
+	if name, err := c.name(nick); name != "alice" || err != nil {
+		t.Error(name, err)
+	}
+	if _, err := c.name(42); err == nil {
+		t.Error("Found unknown ID")
+	}
+}
+
+// Start a bot connected to an IRC server stub, in channel #bluff
+func startBot(t *testing.T) *irctest.Server {
+	s, err := irctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(conn, "bluffbot", []string{"#bluff"})
+	b, err := bluff.NewBotWithMessenger(c, bluff.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go c.Run(b)
+	if err := s.WaitJoined("#bluff"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func say(t *testing.T, s *irctest.Server, nick string, target string, text string) {
+	t.Helper()
+	if err := s.Say(nick, target, text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Check that the last messages sent to target contain texts in order
+func expectLast(t *testing.T, s *irctest.Server, target string, texts ...string) {
+	t.Helper()
+	messages := s.Messages(target)
+	if len(messages) < len(texts) {
+		t.Fatal(target, messages)
+	}
+	for i, m := range messages[len(messages)-len(texts):] {
+		if !strings.Contains(m, texts[i]) {
+			t.Error(target, texts[i], messages)
+		}
+	}
+}
+
+func TestGameInChannel(t *testing.T) {
+	s := startBot(t)
+
+	say(t, s, "alice", "#bluff", "!start")
+	expectLast(t, s, "#bluff", "Send \"!join Table 1\" to join the game.")
+	if m := s.Messages("#bluff"); !strings.Contains(m[0], "send !begin command to begin the game") {
+		t.Error(m)
+	}
+	say(t, s, "alice", "#bluff", "!join")
+	say(t, s, "bob", "#bluff", "!join")
+	expectLast(t, s, "#bluff", "alice joined", "bob joined")
+
+	// Chatter and commands of other bots are ignored
+	say(t, s, "bob", "#bluff", "hello everyone")
+	say(t, s, "bob", "#bluff", "/begin")
+	expectLast(t, s, "#bluff", "bob joined")
+
+	say(t, s, "alice", "#bluff", "!rules dice 1")
+	say(t, s, "alice", "#bluff", "!begin")
+	expectLast(t, s, "#bluff", "It's alice's turn.")
+
+	// The hands come as private messages, without emoji
+	face := regexp.MustCompile(`^[*1-5]$`)
+	for _, nick := range []string{"alice", "bob"} {
+		m := s.Messages(nick)
+		if len(m) < 3 || m[0] != "Your Bluff hand in #bluff (Table 1):" || !face.MatchString(m[1]) {
+			t.Error(nick, m)
+		}
+	}
+
+	say(t, s, "alice", "#bluff", "!bid 2 3")
+	expectLast(t, s, "#bluff", "alice bid 2 3s. It's bob's turn.")
+	say(t, s, "alice", "#bluff", "!challenge")
+	expectLast(t, s, "#bluff", "It's bob's turn")
+	say(t, s, "bob", "#bluff", "!challenge")
+	expectLast(t, s, "#bluff", "Game finished!", "Send !stats, !leaderboard or !rating command")
+}
+
+func TestPrivateCommands(t *testing.T) {
+	s := startBot(t)
+
+	say(t, s, "alice", "#bluff", "!start")
+	say(t, s, "alice", "bluffbot", "!start 12345")
+	expectLast(t, s, "alice", "Invalid game ID: 12345")
+	say(t, s, "alice", "#bluff", "!join")
+	say(t, s, "alice", "#bluff", "!join")
+	expectLast(t, s, "#bluff", "Player already added")
+	say(t, s, "alice", "#bluff", "!begin")
+	expectLast(t, s, "#bluff", "At least two players are needed to play")
+}
@@ -0,0 +1,176 @@
+// Package irctest provides a minimal in-process IRC server for testing IRC bots without a real server
+package irctest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an IRC server for one client. It registers the client, records the channels it joins and the messages
+// it sends, and lets tests send messages to the client as other users.
+type Server struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	// Guarded by mutex
+	conn     net.Conn
+	nick     string
+	joined   map[string]bool
+	messages map[string][]string
+	syncs    int
+	// Tokens of the PONGs received from the client
+	pongs chan string
+}
+
+// Timeout for waiting for the client
+const Timeout = 5 * time.Second
+
+// Start a server listening on a local port. Close it when done.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: l, joined: make(map[string]bool), messages: make(map[string][]string), pongs: make(chan string, 16)}
+	go s.accept()
+	return s, nil
+}
+
+// The address the client should connect to
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// Get the texts the client has sent to a channel or a nick, in the order they were sent
+func (s *Server) Messages(target string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.messages[strings.ToLower(target)]...)
+}
+
+// Wait until the client has joined a channel
+func (s *Server) WaitJoined(channel string) error {
+	deadline := time.Now().Add(Timeout)
+	for time.Now().Before(deadline) {
+		s.mutex.Lock()
+		joined := s.joined[strings.ToLower(channel)]
+		s.mutex.Unlock()
+		if joined {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return fmt.Errorf("Client didn't join %v", channel)
+}
+
+// Send a message from nick to a channel or to the client, and wait until the client has handled it. The client
+// handles the lines from the server in order, so it has handled the message once it answers a PING sent after it.
+func (s *Server) Say(nick string, target string, text string) error {
+	s.mutex.Lock()
+	s.syncs++
+	token := fmt.Sprintf("sync%v", s.syncs)
+	s.mutex.Unlock()
+
+	if err := s.write(":%v!%v@irctest PRIVMSG %v :%v", nick, nick, target, text); err != nil {
+		return err
+	}
+	if err := s.write("PING :%v", token); err != nil {
+		return err
+	}
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case pong := <-s.pongs:
+			if pong == token {
+				return nil
+			}
+		case <-timeout:
+			return fmt.Errorf("Client didn't handle the message in time")
+		}
+	}
+}
+
+// Accept the client connection and serve it
+func (s *Server) accept() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	s.conn = conn
+	s.mutex.Unlock()
+
+	in := bufio.NewScanner(conn)
+	for in.Scan() {
+		s.handle(in.Text())
+	}
+}
+
+// Handle a line from the client
+func (s *Server) handle(line string) {
+	trailing := ""
+	if i := strings.Index(line, " :"); i >= 0 {
+		line, trailing = line[:i], line[i+2:]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "NICK":
+		if len(fields) > 1 {
+			s.mutex.Lock()
+			s.nick = fields[1]
+			s.mutex.Unlock()
+		}
+	case "USER":
+		s.mutex.Lock()
+		nick := s.nick
+		s.mutex.Unlock()
+		s.write(":irctest 001 %v :Welcome to irctest", nick)
+	case "JOIN":
+		if len(fields) > 1 {
+			s.mutex.Lock()
+			for _, channel := range strings.Split(fields[1], ",") {
+				s.joined[strings.ToLower(channel)] = true
+			}
+			s.mutex.Unlock()
+		}
+	case "PRIVMSG":
+		if len(fields) > 1 {
+			s.mutex.Lock()
+			target := strings.ToLower(fields[1])
+			s.messages[target] = append(s.messages[target], trailing)
+			s.mutex.Unlock()
+		}
+	case "PING":
+		s.write("PONG :%v", trailing)
+	case "PONG":
+		s.pongs <- trailing
+	}
+}
+
+// Write a line to the client
+func (s *Server) write(format string, a ...interface{}) error {
+	s.mutex.Lock()
+	conn := s.conn
+	s.mutex.Unlock()
+	if conn == nil {
+		return fmt.Errorf("No client connected")
+	}
+	_, err := fmt.Fprintf(conn, format+"\r\n", a...)
+	return err
+}
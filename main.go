@@ -2,33 +2,124 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
+	"log/slog"
 	"os"
-	"time"
 
 	"github.com/khuttun/bluffbot/bluff"
 	"github.com/khuttun/bluffbot/telegram"
+	"github.com/khuttun/bluffbot/telegram/adapter"
 )
 
+const webhookMode = "webhook"
+const pollingMode = "polling"
+
 func main() {
+	mode := os.Getenv("UPDATE_MODE")
 	port := os.Getenv("PORT")
 	username := os.Getenv("USERNAME")
 	token := os.Getenv("TELEGRAM_TOKEN")
 	webhook := os.Getenv("WEBHOOK")
+	storeType := os.Getenv("GAME_STORE")
+	storePath := os.Getenv("GAME_STORE_PATH")
+	eventLog := os.Getenv("EVENT_LOG")
+	statsPath := os.Getenv("STATS_PATH")
+	logLevel := os.Getenv("LOG_LEVEL")
+	redactPII := os.Getenv("LOG_REDACT_PII") == "true"
+
+	if mode == "" {
+		mode = webhookMode
+	}
+	if mode != webhookMode && mode != pollingMode {
+		fmt.Printf("Unknown UPDATE_MODE %v, expecting %v or %v\n", mode, webhookMode, pollingMode)
+		os.Exit(1)
+	}
 
-	if port == "" || username == "" || token == "" || webhook == "" {
+	if username == "" || token == "" || (mode == webhookMode && (port == "" || webhook == "")) {
 		fmt.Println("Expecting following environment variables to be set:")
-		fmt.Println("PORT")
 		fmt.Println("USERNAME")
 		fmt.Println("TELEGRAM_TOKEN")
+		fmt.Println("In webhook mode (default) also:")
+		fmt.Println("PORT")
 		fmt.Println("WEBHOOK")
 		os.Exit(1)
 	}
 
-	rand.Seed(time.Now().UTC().UnixNano())
-	t := telegram.BotAPI{Port: port, TelegramURL: fmt.Sprintf("https://api.telegram.org/bot%v/", token)}
-	b := bluff.NewBot(username, &t)
-	t.UpdateHandler = b.HandleUpdate
-	t.SetWebhook(webhook)
-	t.StartReceivingUpdates()
+	var level slog.Level
+	if logLevel != "" {
+		if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+			fmt.Printf("Unknown LOG_LEVEL %v, expecting debug, info, warn or error\n", logLevel)
+			os.Exit(1)
+		}
+	}
+	logger := slog.New(telegram.NewRedactingHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}), []string{token}, redactPII))
+	slog.SetDefault(logger)
+
+	store, err := openStore(storeType, storePath)
+	if err != nil {
+		logger.Error("Failed to open game store", "err", err)
+		os.Exit(1)
+	}
+
+	t := telegram.BotAPI{Port: port, TelegramURL: fmt.Sprintf("https://api.telegram.org/bot%v/", token), Logger: logger}
+	tg, err := adapter.NewTelegram(username, &t, store)
+	if err != nil {
+		logger.Error("Failed to load games", "err", err)
+		os.Exit(1)
+	}
+	b := tg.Bot()
+	b.SetLogger(logger)
+	t.UpdateHandler = tg.HandleUpdate
+
+	if statsPath != "" {
+		stats, err := bluff.NewJSONFileStatsStore(statsPath)
+		if err != nil {
+			logger.Error("Failed to open stats", "err", err)
+			os.Exit(1)
+		}
+		b.SetStatsStore(stats)
+	}
+
+	if eventLog != "" {
+		f, err := os.OpenFile(eventLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			logger.Error("Failed to open event log", "err", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		b.SetEventSink(bluff.NewJSONLinesSink(f))
+	}
+
+	switch mode {
+	case webhookMode:
+		if err := t.SetWebhook(webhook); err != nil {
+			logger.Error("Failed to set webhook", "err", err)
+			os.Exit(1)
+		}
+		t.StartReceivingUpdates()
+	case pollingMode:
+		if err := t.DeleteWebhook(); err != nil {
+			logger.Error("Failed to delete webhook", "err", err)
+			os.Exit(1)
+		}
+		t.StartPollingUpdates()
+	}
+}
+
+// Open the game store of the given type. Defaults to keeping games in memory.
+func openStore(storeType string, path string) (bluff.GameStore, error) {
+	switch storeType {
+	case "", "memory":
+		return bluff.NewMemoryStore(), nil
+	case "json":
+		if path == "" {
+			return nil, fmt.Errorf("GAME_STORE_PATH must be set for json store")
+		}
+		return bluff.NewJSONFileStore(path)
+	case "log":
+		if path == "" {
+			return nil, fmt.Errorf("GAME_STORE_PATH must be set for log store")
+		}
+		return bluff.NewLogStore(path)
+	}
+	return nil, fmt.Errorf("Unknown GAME_STORE %v, expecting memory, json or log", storeType)
 }
@@ -0,0 +1,135 @@
+// Package adapter runs a bluff.Bot on Telegram. Telegram is a bluff.Messenger sending the bot's messages through the
+// Telegram Bot API, and it passes the updates from Telegram to the bot as commands and button presses.
+package adapter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/khuttun/bluffbot/bluff"
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+// Telegram connects a bot to the Telegram Bot API. It's the Messenger of the bot, and passes the updates from
+// Telegram to the bot.
+type Telegram struct {
+	// Username of the bot, for the join links and for recognizing commands addressed to the bot
+	username string
+	api      telegram.MsgSender
+	bot      *bluff.Bot
+}
+
+// Create a new bot running on Telegram, persisting games to store. The games already in the store are resumed. Pass
+// the updates from Telegram to HandleUpdate.
+func NewTelegram(uname string, api telegram.MsgSender, store bluff.GameStore) (*Telegram, error) {
+	t := &Telegram{username: uname, api: api}
+	b, err := bluff.NewBotWithMessenger(t, store)
+	if err != nil {
+		return nil, err
+	}
+	t.bot = b
+	return t, nil
+}
+
+// Get the bot running on Telegram
+func (t *Telegram) Bot() *bluff.Bot {
+	return t.bot
+}
+
+// Handle update from Telegram. Safe to call from multiple goroutines concurrently.
+func (t *Telegram) HandleUpdate(u telegram.Update) {
+	switch {
+	case u.CallbackQuery != nil:
+		q := *u.CallbackQuery
+		if q.Message == nil {
+			t.AnswerPress(q.ID, "This game has ended")
+			return
+		}
+		p := bluff.ButtonPress{ID: q.ID, Room: telegramRoom(q.Message.Chat), From: telegramUser(q.From), MessageID: q.Message.MessageID}
+		if q.Data != nil {
+			p.Data = *q.Data
+		}
+		t.bot.HandleButtonPress(p)
+	case u.Message != nil && u.Message.Text != nil && u.Message.From != nil:
+		t.bot.HandleCommand(t.command(*u.Message))
+	}
+}
+
+// Convert a Telegram message to a command. The bot's username is removed from the command name, e.g.
+// "/bid@bluffbot" is "/bid".
+func (t *Telegram) command(msg telegram.Message) bluff.Command {
+	parts := strings.Split(*msg.Text, " ")
+	return bluff.Command{
+		Room: telegramRoom(msg.Chat),
+		From: telegramUser(*msg.From),
+		Name: strings.TrimSuffix(parts[0], "@"+t.username),
+		Args: parts[1:]}
+}
+
+func telegramRoom(c telegram.Chat) bluff.Room {
+	r := bluff.Room{ID: c.ID}
+	if c.Title != nil {
+		r.Title = *c.Title
+	}
+	return r
+}
+
+func telegramUser(u telegram.User) bluff.User {
+	user := bluff.User{ID: u.ID, Name: u.FirstName}
+	if u.Username != nil {
+		user.Username = *u.Username
+	}
+	return user
+}
+
+func inlineKeyboard(buttons [][]bluff.Button) [][]telegram.InlineKeyboardButton {
+	if buttons == nil {
+		return nil
+	}
+	kb := make([][]telegram.InlineKeyboardButton, len(buttons))
+	for i, row := range buttons {
+		kb[i] = make([]telegram.InlineKeyboardButton, len(row))
+		for j, button := range row {
+			kb[i][j] = telegram.InlineKeyboardButton{Text: button.Text, CallbackData: button.Data}
+		}
+	}
+	return kb
+}
+
+func (t *Telegram) Send(roomID int, text string) error {
+	return t.api.SendMessage(roomID, text)
+}
+
+func (t *Telegram) SendWithButtons(roomID int, text string, buttons [][]bluff.Button) (int, error) {
+	return t.api.SendMessageWithInlineKeyboard(roomID, text, inlineKeyboard(buttons))
+}
+
+// Remove also the reply keyboard shown by earlier versions
+func (t *Telegram) SendFinal(roomID int, text string) error {
+	return t.api.SendMessageAndRemoveCustomKeyboard(roomID, text)
+}
+
+func (t *Telegram) Edit(roomID int, messageID int, text string, buttons [][]bluff.Button) error {
+	return t.api.EditMessageText(roomID, messageID, text, inlineKeyboard(buttons))
+}
+
+// Private chats have the ID of the user
+func (t *Telegram) SendPrivate(userID int, text string) error {
+	return t.api.SendMessage(userID, text)
+}
+
+func (t *Telegram) AnswerPress(pressID string, text string) error {
+	return t.api.AnswerCallbackQuery(pressID, text)
+}
+
+// Players join by opening a private chat with the bot through a deep link, which sends the bot /start with the ID
+// of the game
+func (t *Telegram) JoinInstructions(g *bluff.Game) string {
+	response := "Use the below link and click the START button in the opened chat window to join the game."
+	response += fmt.Sprintf("\n\nhttps://telegram.me/%v?start=%v", t.username, g.ID)
+	return response
+}
+
+func (t *Telegram) Emoji() bool {
+	return true
+}
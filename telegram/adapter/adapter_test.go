@@ -0,0 +1,47 @@
+package adapter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/khuttun/bluffbot/bluff"
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+func TestTelegramCommand(t *testing.T) {
+	tm := Telegram{username: "bluffbot"}
+	title := "Game night"
+	username := "alice_w"
+	text := "/bid@bluffbot 3 4"
+	msg := telegram.Message{
+		Chat: telegram.Chat{ID: -100, Type: "group", Title: &title},
+		From: &telegram.User{ID: 1, FirstName: "Alice", Username: &username},
+		Text: &text}
+
+	expected := bluff.Command{
+		Room: bluff.Room{ID: -100, Title: "Game night"},
+		From: bluff.User{ID: 1, Name: "Alice", Username: "alice_w"},
+		Name: "/bid",
+		Args: []string{"3", "4"}}
+	if c := tm.command(msg); !reflect.DeepEqual(c, expected) {
+		t.Error(c)
+	}
+
+	text = "/start"
+	msg = telegram.Message{Chat: telegram.Chat{ID: 1, Type: "private"}, From: &telegram.User{ID: 1, FirstName: "Alice"}, Text: &text}
+	expected = bluff.Command{Room: bluff.Room{ID: 1}, From: bluff.User{ID: 1, Name: "Alice"}, Name: "/start", Args: []string{}}
+	if c := tm.command(msg); !reflect.DeepEqual(c, expected) {
+		t.Error(c)
+	}
+}
+
+func TestInlineKeyboardConversion(t *testing.T) {
+	if inlineKeyboard(nil) != nil {
+		t.Error("Keyboard for no buttons")
+	}
+	kb := inlineKeyboard([][]bluff.Button{{{Text: "1 3️⃣", Data: "bid 1 3"}}, {{Text: "Challenge", Data: "challenge"}}})
+	expected := [][]telegram.InlineKeyboardButton{{{Text: "1 3️⃣", CallbackData: "bid 1 3"}}, {{Text: "Challenge", CallbackData: "challenge"}}}
+	if !reflect.DeepEqual(kb, expected) {
+		t.Error(kb)
+	}
+}
@@ -2,10 +2,14 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 // BotAPI offers an interface to the Telegram bot API
@@ -16,20 +20,51 @@ type BotAPI struct {
 	TelegramURL string
 	// Function to handle updates coming from Telegram bot API
 	UpdateHandler func(Update)
+	// Long polling timeout in seconds used by StartPollingUpdates. Defaults to 30 if not set.
+	PollTimeout int
+	// Optional. Log the requests and the updates here instead of slog.Default(). The request and response bodies
+	// and the updates are logged at debug level.
+	Logger *slog.Logger
+	// Times a request failing temporarily, i.e. with too many requests or with a server error, is retried. Defaults
+	// to 3 if not set. Set to a negative number to disable retrying. Messages aren't sent again after a server error,
+	// as they may have been sent already.
+	MaxRetries int
+	// Delay before retrying a request that failed with a server error, doubled for each retry. Defaults to 1 second
+	// if not set. After too many requests, the delay asked by Telegram is used instead.
+	RetryBackoff time.Duration
 }
 
+const defaultPollTimeout = 30
+const minPollBackoff = time.Second
+const maxPollBackoff = time.Minute
+const defaultMaxRetries = 3
+const defaultRetryBackoff = time.Second
+
+// The retries of a request don't wait longer than this in total, so that the bot doesn't stall. Requests asked to
+// wait longer before repeating them fail without retrying.
+const maxRetryTime = 10 * time.Second
+
+// Sending a message again makes a duplicate, so these methods are retried only when the request wasn't handled, i.e.
+// after too many requests
+var nonIdempotentMethods = map[string]bool{"sendMessage": true}
+
 // Set URL where Telegram bot API sends updates
-func (b *BotAPI) SetWebhook(url string) {
-	b.makeRequest("setWebhook", SetWebhookParams{url})
+func (b *BotAPI) SetWebhook(url string) error {
+	return b.makeRequest("setWebhook", SetWebhookParams{url})
+}
+
+// Remove webhook integration, needed before updates can be polled with StartPollingUpdates
+func (b *BotAPI) DeleteWebhook() error {
+	return b.makeRequest("deleteWebhook", struct{}{})
 }
 
 // Send Telegram message
-func (b *BotAPI) SendMessage(chatid int, text string) {
-	b.makeRequest("sendMessage", SendMessageParams{ChatID: chatid, Text: text})
+func (b *BotAPI) SendMessage(chatid int, text string) error {
+	return b.makeRequest("sendMessage", SendMessageParams{ChatID: chatid, Text: text})
 }
 
 // Send Telegram message and display custom keyboard for the users
-func (b *BotAPI) SendMessageAndDisplayCustomKeyboard(chatid int, text string, kb [][]string) {
+func (b *BotAPI) SendMessageAndDisplayCustomKeyboard(chatid int, text string, kb [][]string) error {
 	keyb := make([][]KeyboardButton, len(kb))
 	for row := range kb {
 		keyb[row] = make([]KeyboardButton, len(kb[row]))
@@ -37,77 +72,232 @@ func (b *BotAPI) SendMessageAndDisplayCustomKeyboard(chatid int, text string, kb
 			keyb[row][col] = KeyboardButton{kb[row][col]}
 		}
 	}
-	b.makeRequest("sendMessage", SendMessageParams{ChatID: chatid, Text: text, ReplyMarkup: &ReplyKeyboardMarkup{Keyboard: keyb}})
+	return b.makeRequest("sendMessage", SendMessageParams{ChatID: chatid, Text: text, ReplyMarkup: &ReplyKeyboardMarkup{Keyboard: keyb}})
+}
+
+// Send Telegram message with an inline keyboard attached to it. Returns the ID of the sent message.
+func (b *BotAPI) SendMessageWithInlineKeyboard(chatid int, text string, kb [][]InlineKeyboardButton) (int, error) {
+	var msg Message
+	err := b.makeRequestWithResult("sendMessage", SendMessageParams{ChatID: chatid, Text: text, ReplyMarkup: &InlineKeyboardMarkup{kb}}, &msg)
+	return msg.MessageID, err
+}
+
+// Replace the text and the inline keyboard of a message. The inline keyboard is removed if kb is nil.
+func (b *BotAPI) EditMessageText(chatid int, messageid int, text string, kb [][]InlineKeyboardButton) error {
+	params := EditMessageTextParams{ChatID: chatid, MessageID: messageid, Text: text}
+	if kb != nil {
+		params.ReplyMarkup = &InlineKeyboardMarkup{kb}
+	}
+	return b.makeRequest("editMessageText", params)
+}
+
+// Answer a callback query sent from an inline keyboard. If text is not empty, it's shown to the user as an alert.
+func (b *BotAPI) AnswerCallbackQuery(queryid string, text string) error {
+	return b.makeRequest("answerCallbackQuery", AnswerCallbackQueryParams{CallbackQueryID: queryid, Text: text, ShowAlert: text != ""})
 }
 
 // Send Telegram message and remove current custom keyboard
-func (b *BotAPI) SendMessageAndRemoveCustomKeyboard(chatid int, text string) {
-	b.makeRequest("sendMessage", SendMessageParams{ChatID: chatid, Text: text, ReplyMarkup: &ReplyKeyboardRemove{RemoveKeyboard: true}})
+func (b *BotAPI) SendMessageAndRemoveCustomKeyboard(chatid int, text string) error {
+	return b.makeRequest("sendMessage", SendMessageParams{ChatID: chatid, Text: text, ReplyMarkup: &ReplyKeyboardRemove{RemoveKeyboard: true}})
 }
 
 // Start receiving updates from Telegram bot API. Blocks.
 func (b *BotAPI) StartReceivingUpdates() {
-	http.HandleFunc("/", b.httpReqHandler)
-	fmt.Println("Starting to listen port", b.Port)
-	http.ListenAndServe(fmt.Sprintf(":%v", b.Port), nil)
+	http.Handle("/", b)
+	b.logger().Info("Listening for updates", "port", b.Port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%v", b.Port), nil); err != nil {
+		b.logger().Error("Listening for updates failed", "err", err)
+	}
+}
+
+// Start polling updates from Telegram bot API with getUpdates. Use this instead of StartReceivingUpdates when
+// no webhook is set. Blocks.
+func (b *BotAPI) StartPollingUpdates() {
+	timeout := b.PollTimeout
+	if timeout <= 0 {
+		timeout = defaultPollTimeout
+	}
+
+	offset := 0
+	backoff := minPollBackoff
+	for {
+		var updates []Update
+		err := b.makeRequestWithResult("getUpdates", GetUpdatesParams{Offset: offset, Timeout: timeout}, &updates)
+		if err != nil {
+			b.logger().Warn("getUpdates failed", "retry_in", backoff, "err", err)
+			time.Sleep(backoff)
+			backoff = nextPollBackoff(backoff)
+			continue
+		}
+		backoff = minPollBackoff
+
+		for _, upd := range updates {
+			// Confirm the update on the next getUpdates call
+			if upd.UpdateID >= offset {
+				offset = upd.UpdateID + 1
+			}
+			// Handled one at a time, so that the commands of a chat are applied in the order they were sent
+			b.handleUpdate(upd)
+		}
+	}
+}
+
+// Double the polling retry delay, up to maxPollBackoff
+func nextPollBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > maxPollBackoff {
+		d = maxPollBackoff
+	}
+	return d
+}
+
+func (b *BotAPI) logger() *slog.Logger {
+	if b.Logger == nil {
+		return slog.Default()
+	}
+	return b.Logger
+}
+
+func (b *BotAPI) makeRequest(method string, params interface{}) error {
+	return b.makeRequestWithResult(method, params, nil)
+}
+
+func (b *BotAPI) maxRetries() int {
+	if b.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	return b.MaxRetries
+}
+
+func (b *BotAPI) retryBackoff() time.Duration {
+	if b.RetryBackoff <= 0 {
+		return defaultRetryBackoff
+	}
+	return b.RetryBackoff
 }
 
-func (b *BotAPI) makeRequest(method string, params interface{}) {
+// Make Telegram API request and decode the result of a successful request to result, if it's not nil. Requests
+// failing temporarily are retried, waiting at most maxRetryTime in total. Unsuccessful responses are returned as
+// *APIError. The log records of the request share a correlation ID.
+func (b *BotAPI) makeRequestWithResult(method string, params interface{}, result interface{}) error {
+	log := b.logger().With("request_id", newCorrelationID(), "method", method)
 	paramsJSONStr, err := json.Marshal(params)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
-	fmt.Println("makeRequest", method, string(paramsJSONStr))
+	log.Debug("API request", "params", string(paramsJSONStr))
 
-	resp, err := http.Post(b.TelegramURL+method, "application/json", bytes.NewReader(paramsJSONStr))
+	backoff := b.retryBackoff()
+	var waited time.Duration
+	for retry := 0; ; retry++ {
+		err = b.post(log, method, paramsJSONStr, result)
+		apiErr, ok := err.(*APIError)
+		if !ok || !apiErr.Temporary() || retry >= b.maxRetries() {
+			return err
+		}
+		// The outcome of a request failing with a server error is unknown
+		tooMany := apiErr.RetryAfter > 0 || apiErr.Code == http.StatusTooManyRequests
+		if !tooMany && nonIdempotentMethods[method] {
+			return err
+		}
+		wait := backoff
+		if apiErr.RetryAfter > 0 {
+			wait = time.Duration(apiErr.RetryAfter) * time.Second
+		} else {
+			backoff *= 2
+		}
+		if waited+wait > maxRetryTime {
+			return err
+		}
+		waited += wait
+		log.Warn("Retrying API request", "retry_in", wait, "err", err)
+		time.Sleep(wait)
+	}
+}
+
+// Post an API request once
+func (b *BotAPI) post(log *slog.Logger, method string, params []byte, result interface{}) error {
+	resp, err := http.Post(b.TelegramURL+method, "application/json", bytes.NewReader(params))
 	if err != nil {
-		fmt.Println(err)
-		return
+		// The URL of the request contains the bot token
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = method
+		}
+		log.Debug("API request failed", "err", err)
+		return err
 	}
 
 	defer resp.Body.Close()
-	fmt.Println("API response", resp.Status)
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println(string(respBody))
-}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	log.Debug("API response", "status", resp.StatusCode, "response", string(respBody))
 
-func (b *BotAPI) httpReqHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("-----------")
-	fmt.Println("New request")
-	fmt.Println(r.Method)
-	fmt.Println(r.URL)
+	var apiResp Response
+	err = json.Unmarshal(respBody, &apiResp)
+	if err != nil {
+		// Proxies in front of Telegram can answer errors without a JSON body
+		if resp.StatusCode != http.StatusOK {
+			return newAPIError(method, resp.StatusCode, Response{})
+		}
+		return err
+	}
+	if !apiResp.OK {
+		return newAPIError(method, resp.StatusCode, apiResp)
+	}
+	if result != nil {
+		return json.Unmarshal(apiResp.Result, result)
+	}
+	return nil
+}
 
+// Handle an update sent by Telegram to the webhook
+func (b *BotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var upd Update
 	err := decoder.Decode(&upd)
 	if err != nil {
-		fmt.Println(err)
+		b.logger().Warn("Invalid update", "method", r.Method, "err", err)
 		return
 	}
 
-	updStr, _ := json.MarshalIndent(upd, "", "    ")
-	fmt.Println(string(updStr))
-
-	fmt.Println("-----------")
+	b.handleUpdate(upd)
+}
 
-	if upd.Message == nil {
-		fmt.Println("nil Message")
-		return
+// Validate update and pass it to UpdateHandler. The log records of the update have its ID.
+func (b *BotAPI) handleUpdate(upd Update) {
+	log := b.logger().With("update_id", upd.UpdateID)
+	if log.Enabled(context.Background(), slog.LevelDebug) {
+		updStr, _ := json.Marshal(upd)
+		log.Debug("Update received", "update", string(updStr))
 	}
 
-	if upd.Message.From == nil {
-		fmt.Println("nil From")
-		return
-	}
+	if upd.CallbackQuery != nil {
+		if upd.CallbackQuery.Data == nil {
+			log.Warn("Ignoring callback query without data")
+			return
+		}
+	} else {
+		if upd.Message == nil {
+			log.Warn("Ignoring update without message")
+			return
+		}
 
-	if upd.Message.Text == nil {
-		fmt.Println("nil Text")
-		return
+		if upd.Message.From == nil {
+			log.Warn("Ignoring message without sender")
+			return
+		}
+
+		if upd.Message.Text == nil {
+			log.Debug("Ignoring message without text")
+			return
+		}
 	}
 
 	if b.UpdateHandler == nil {
-		fmt.Println("nil UpdateHandler")
+		log.Error("No UpdateHandler set")
+		return
 	}
 
 	b.UpdateHandler(upd)
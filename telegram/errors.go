@@ -0,0 +1,47 @@
+package telegram
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// APIError is an unsuccessful response from the Telegram bot API
+type APIError struct {
+	// The API method requested
+	Method string
+	// HTTP status code of the response
+	StatusCode int
+	// Error code given by Telegram. Same as StatusCode if the response had none.
+	Code int
+	// Human-readable description of the error
+	Description string
+	// Optional. Seconds to wait before the request can be repeated, when too many requests have been made.
+	RetryAfter int
+	// Optional. The new ID of a group that has been migrated to a supergroup.
+	MigrateToChatID int64
+}
+
+// Create an APIError from a response
+func newAPIError(method string, statusCode int, resp Response) *APIError {
+	e := &APIError{Method: method, StatusCode: statusCode, Code: resp.ErrorCode, Description: resp.Description}
+	if e.Code == 0 {
+		e.Code = statusCode
+	}
+	if e.Description == "" {
+		e.Description = http.StatusText(statusCode)
+	}
+	if resp.Parameters != nil {
+		e.RetryAfter = resp.Parameters.RetryAfter
+		e.MigrateToChatID = resp.Parameters.MigrateToChatID
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%v failed: %v", e.Method, e.Description)
+}
+
+// Can the request succeed when it's repeated later? True for too many requests and for server errors.
+func (e *APIError) Temporary() bool {
+	return e.RetryAfter > 0 || e.Code == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the redacted parts of the logs
+const Redacted = "[REDACTED]"
+
+// PIIKeys are the keys of the log attributes that can hold personal information of users, e.g. their names and the
+// texts of their messages. The request and response bodies and the updates logged by BotAPI use these keys.
+var PIIKeys = []string{"name", "text", "user", "params", "response", "update"}
+
+// redactingHandler is a slog.Handler removing secrets, and optionally personal information, from the records before
+// passing them to the wrapped handler
+type redactingHandler struct {
+	h         slog.Handler
+	secrets   []string
+	redactPII bool
+}
+
+// Create a slog.Handler that replaces secrets, e.g. the bot token, with Redacted wherever they occur in the logged
+// messages and attributes. If redactPII is set, also the values of the attributes with PIIKeys are replaced.
+func NewRedactingHandler(h slog.Handler, secrets []string, redactPII bool) slog.Handler {
+	var nonEmpty []string
+	for _, s := range secrets {
+		if s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	return &redactingHandler{h, nonEmpty, redactPII}
+}
+
+func (r *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.h.Enabled(ctx, level)
+}
+
+func (r *redactingHandler) Handle(ctx context.Context, rec slog.Record) error {
+	redacted := slog.NewRecord(rec.Time, rec.Level, r.redactString(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(r.redact(a))
+		return true
+	})
+	return r.h.Handle(ctx, redacted)
+}
+
+func (r *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = r.redact(a)
+	}
+	return &redactingHandler{r.h.WithAttrs(redacted), r.secrets, r.redactPII}
+}
+
+func (r *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{r.h.WithGroup(name), r.secrets, r.redactPII}
+}
+
+// Redact the value of an attribute
+func (r *redactingHandler) redact(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if r.redactPII && isPIIKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.redactString(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = r.redact(ga)
+		}
+		a.Value = slog.GroupValue(redacted...)
+	case slog.KindAny:
+		// Errors and other values are logged as text, which may contain a secret, e.g. a failed request's URL
+		s := fmt.Sprint(a.Value.Any())
+		if redacted := r.redactString(s); redacted != s {
+			a.Value = slog.StringValue(redacted)
+		}
+	}
+	return a
+}
+
+func (r *redactingHandler) redactString(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, Redacted, -1)
+	}
+	return s
+}
+
+func isPIIKey(key string) bool {
+	for _, k := range PIIKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Length of the correlation IDs in bytes
+const correlationIDLength = 4
+
+// Create a random ID that ties together the log records of one API request
+func newCorrelationID() string {
+	id := make([]byte, correlationIDLength)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,49 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactingHandler(t *testing.T) {
+	tests := []struct {
+		redactPII bool
+		log       func(l *slog.Logger)
+		expected  string
+	}{
+		{false, func(l *slog.Logger) { l.Info("Token is 123:abc") }, `msg="Token is [REDACTED]"`},
+		{false, func(l *slog.Logger) { l.Info("Request", "url", "https://api.telegram.org/bot123:abc/getMe") },
+			`url=https://api.telegram.org/bot[REDACTED]/getMe`},
+		{false, func(l *slog.Logger) { l.Error("Failed", "err", fmt.Errorf("Post bot123:abc: timeout")) },
+			`err="Post bot[REDACTED]: timeout"`},
+		{false, func(l *slog.Logger) { l.Info("Request", slog.Group("req", "path", "/bot123:abc/")) },
+			`req.path=/bot[REDACTED]/`},
+		{false, func(l *slog.Logger) { l.With("url", "123:abc").Info("Request") }, `url=[REDACTED]`},
+		{false, func(l *slog.Logger) { l.Info("Update", "text", "hello", "update_id", 5) }, `text=hello update_id=5`},
+		{true, func(l *slog.Logger) { l.Info("Update", "text", "hello", "update_id", 5) }, `text=[REDACTED] update_id=5`},
+		{true, func(l *slog.Logger) { l.Info("Update", slog.Group("user", "id", 1, "name", "Alice")) }, `user=[REDACTED]`},
+		{true, func(l *slog.Logger) { l.Info("Update", slog.Group("chat", "id", 1, "name", "Friends")) },
+			`chat.id=1 chat.name=[REDACTED]`},
+	}
+	for i, test := range tests {
+		var out bytes.Buffer
+		h := NewRedactingHandler(slog.NewTextHandler(&out, nil), []string{"", "123:abc"}, test.redactPII)
+		test.log(slog.New(h))
+		if !strings.Contains(out.String(), test.expected) || strings.Contains(out.String(), "123:abc") {
+			t.Error(i, out.String())
+		}
+	}
+}
+
+func TestRedactingHandlerLevel(t *testing.T) {
+	var out bytes.Buffer
+	l := slog.New(NewRedactingHandler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelInfo}), nil, false))
+	l.Debug("Hidden")
+	l.Info("Shown")
+	if strings.Contains(out.String(), "Hidden") || !strings.Contains(out.String(), "Shown") {
+		t.Error(out.String())
+	}
+}
@@ -1,8 +1,10 @@
 package telegram
 
-// MsgSender defines an interface to send Telegram messages
+// MsgSender defines an interface to send Telegram messages. Unsuccessful requests return *APIError.
 type MsgSender interface {
-	SendMessage(chatid int, text string)
-	SendMessageAndDisplayCustomKeyboard(chatid int, text string, kb [][]string)
-	SendMessageAndRemoveCustomKeyboard(chatid int, text string)
+	SendMessage(chatid int, text string) error
+	SendMessageAndRemoveCustomKeyboard(chatid int, text string) error
+	SendMessageWithInlineKeyboard(chatid int, text string, kb [][]InlineKeyboardButton) (int, error)
+	EditMessageText(chatid int, messageid int, text string, kb [][]InlineKeyboardButton) error
+	AnswerCallbackQuery(queryid string, text string) error
 }
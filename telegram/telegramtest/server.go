@@ -0,0 +1,237 @@
+// Package telegramtest provides a fake Telegram Bot API server for testing bots end to end without Telegram
+package telegramtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+// Server is a fake Telegram Bot API. It records the API requests made to it, keeps the messages sent to each chat,
+// and pushes updates to the webhook set with setWebhook.
+type Server struct {
+	server *httptest.Server
+	mutex  sync.Mutex
+	// Guarded by mutex
+	requests []Request
+	messages map[int][]Message
+	log      map[int][]Message
+	webhook  string
+	// IDs given to the next sent message and the next pushed update
+	nextMessageID int
+	nextUpdateID  int
+	// Failures given to the next requests, keyed by method
+	failures map[string][]Failure
+}
+
+// Request is an API request made to the server
+type Request struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Message is a message sent by the bot
+type Message struct {
+	ID       int
+	ChatID   int
+	Text     string
+	Keyboard [][]telegram.InlineKeyboardButton
+}
+
+// Failure is an error response given to a request instead of handling it
+type Failure struct {
+	// HTTP status code and error code of the response, e.g. 429 or 500
+	Status      int
+	Description string
+	// Optional. Seconds the client is asked to wait before repeating the request.
+	RetryAfter int
+}
+
+// Start a fake Telegram Bot API server. Close it when done.
+func NewServer() *Server {
+	s := &Server{messages: make(map[int][]Message), log: make(map[int][]Message), nextMessageID: 1, nextUpdateID: 1, failures: make(map[string][]Failure)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// The URL to use as the TelegramURL of a telegram.BotAPI
+func (s *Server) URL() string {
+	return s.server.URL + "/botTEST/"
+}
+
+// Get the requests made with an API method, in the order they were made
+func (s *Server) Requests(method string) []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var requests []Request
+	for _, r := range s.requests {
+		if r.Method == method {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// Get the messages of a chat as they are now, with the edits applied
+func (s *Server) Messages(chatID int) []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message{}, s.messages[chatID]...)
+}
+
+// Get every message sent to a chat and every edit made to them, in the order they were made. An edit has the ID of
+// the edited message.
+func (s *Server) Log(chatID int) []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message{}, s.log[chatID]...)
+}
+
+// Fail the next requests made with an API method, one request with each failure in order. The failed requests are
+// recorded but have no other effect.
+func (s *Server) FailNext(method string, failures ...Failure) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[method] = append(s.failures[method], failures...)
+}
+
+// Get the URL set with setWebhook, empty if there's none
+func (s *Server) Webhook() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.webhook
+}
+
+// Send an update to the webhook and wait until the bot has handled it. The update ID is filled in.
+func (s *Server) PushUpdate(u telegram.Update) error {
+	s.mutex.Lock()
+	webhook := s.webhook
+	u.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	s.mutex.Unlock()
+
+	if webhook == "" {
+		return fmt.Errorf("No webhook set")
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Webhook responded %v", resp.Status)
+	}
+	return nil
+}
+
+// Handle an API request
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		respond(w, nil, err)
+		return
+	}
+	method := path.Base(r.URL.Path)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests = append(s.requests, Request{method, body})
+	if failures := s.failures[method]; len(failures) > 0 {
+		s.failures[method] = failures[1:]
+		fail(w, failures[0])
+		return
+	}
+
+	switch method {
+	case "sendMessage":
+		var params struct {
+			ChatID      int                           `json:"chat_id"`
+			Text        string                        `json:"text"`
+			ReplyMarkup telegram.InlineKeyboardMarkup `json:"reply_markup"`
+		}
+		if err := json.Unmarshal(body, &params); err != nil {
+			respond(w, nil, err)
+			return
+		}
+		m := Message{ID: s.nextMessageID, ChatID: params.ChatID, Text: params.Text, Keyboard: params.ReplyMarkup.InlineKeyboard}
+		s.nextMessageID++
+		s.messages[m.ChatID] = append(s.messages[m.ChatID], m)
+		s.log[m.ChatID] = append(s.log[m.ChatID], m)
+		text := m.Text
+		respond(w, telegram.Message{MessageID: m.ID, Chat: telegram.Chat{ID: m.ChatID}, Text: &text}, nil)
+	case "editMessageText":
+		var params telegram.EditMessageTextParams
+		if err := json.Unmarshal(body, &params); err != nil {
+			respond(w, nil, err)
+			return
+		}
+		m := Message{ID: params.MessageID, ChatID: params.ChatID, Text: params.Text}
+		if params.ReplyMarkup != nil {
+			m.Keyboard = params.ReplyMarkup.InlineKeyboard
+		}
+		found := false
+		for i, old := range s.messages[m.ChatID] {
+			if old.ID == m.ID {
+				s.messages[m.ChatID][i] = m
+				found = true
+			}
+		}
+		if !found {
+			respond(w, nil, fmt.Errorf("Bad Request: message to edit not found"))
+			return
+		}
+		s.log[m.ChatID] = append(s.log[m.ChatID], m)
+		respond(w, true, nil)
+	case "setWebhook":
+		var params telegram.SetWebhookParams
+		if err := json.Unmarshal(body, &params); err != nil {
+			respond(w, nil, err)
+			return
+		}
+		s.webhook = params.URL
+		respond(w, true, nil)
+	case "deleteWebhook":
+		s.webhook = ""
+		respond(w, true, nil)
+	case "answerCallbackQuery":
+		respond(w, true, nil)
+	default:
+		respond(w, nil, fmt.Errorf("Not Found: method %v", method))
+	}
+}
+
+// Write an API response with the result, or with the error if it's not nil
+func respond(w http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		fail(w, Failure{Status: http.StatusBadRequest, Description: err.Error()})
+		return
+	}
+	resp := telegram.Response{OK: true}
+	resp.Result, _ = json.Marshal(result)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Write an unsuccessful API response
+func fail(w http.ResponseWriter, f Failure) {
+	resp := telegram.Response{OK: false, Description: f.Description, ErrorCode: f.Status}
+	if f.RetryAfter > 0 {
+		resp.Parameters = &telegram.ResponseParameters{RetryAfter: f.RetryAfter}
+	}
+	w.WriteHeader(f.Status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,240 @@
+package telegramtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khuttun/bluffbot/telegram"
+)
+
+func TestSendAndEditMessages(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	api := telegram.BotAPI{TelegramURL: s.URL()}
+
+	api.SendMessage(10, "Hello")
+	kb := [][]telegram.InlineKeyboardButton{{{Text: "A", CallbackData: "a"}}}
+	id, err := api.SendMessageWithInlineKeyboard(10, "Pick", kb)
+	if err != nil || id != 2 {
+		t.Fatal(id, err)
+	}
+	api.SendMessageAndRemoveCustomKeyboard(20, "Bye")
+	api.EditMessageText(10, id, "Picked", nil)
+
+	expected := []Message{{ID: 1, ChatID: 10, Text: "Hello"}, {ID: 2, ChatID: 10, Text: "Picked"}}
+	if m := s.Messages(10); !reflect.DeepEqual(m, expected) {
+		t.Error(m)
+	}
+	expected = []Message{{ID: 1, ChatID: 10, Text: "Hello"}, {ID: 2, ChatID: 10, Text: "Pick", Keyboard: kb}, {ID: 2, ChatID: 10, Text: "Picked"}}
+	if m := s.Log(10); !reflect.DeepEqual(m, expected) {
+		t.Error(m)
+	}
+	if m := s.Messages(20); len(m) != 1 || m[0].Text != "Bye" {
+		t.Error(m)
+	}
+	if r := s.Requests("sendMessage"); len(r) != 3 {
+		t.Error(r)
+	}
+	if r := s.Requests("editMessageText"); len(r) != 1 || string(r[0].Params) != `{"chat_id":10,"message_id":2,"text":"Picked"}` {
+		t.Error(r)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	resp, err := http.Post(s.URL()+"getMe", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var apiResp telegram.Response
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil || apiResp.OK || resp.StatusCode != http.StatusBadRequest {
+		t.Error(apiResp, err)
+	}
+	if r := s.Requests("getMe"); len(r) != 1 {
+		t.Error(r)
+	}
+}
+
+func TestPushUpdate(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	var received []telegram.Update
+	api := telegram.BotAPI{TelegramURL: s.URL(), UpdateHandler: func(u telegram.Update) { received = append(received, u) }}
+	webhook := httptest.NewServer(&api)
+	defer webhook.Close()
+
+	text := "/start"
+	u := telegram.Update{Message: &telegram.Message{Chat: telegram.Chat{ID: 10}, From: &telegram.User{ID: 1}, Text: &text}}
+	if s.PushUpdate(u) == nil {
+		t.Error("Pushed without webhook")
+	}
+
+	api.SetWebhook(webhook.URL)
+	if s.Webhook() != webhook.URL {
+		t.Fatal(s.Webhook())
+	}
+	if err := s.PushUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PushUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].UpdateID != 2 || received[1].UpdateID != 3 || *received[1].Message.Text != text {
+		t.Error(received)
+	}
+
+	// Updates the bot can't handle are dropped
+	if err := s.PushUpdate(telegram.Update{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 {
+		t.Error(received)
+	}
+
+	api.DeleteWebhook()
+	if s.Webhook() != "" || s.PushUpdate(u) == nil {
+		t.Error(s.Webhook())
+	}
+}
+
+func TestLogging(t *testing.T) {
+	s := NewServer()
+	var log bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	api := telegram.BotAPI{TelegramURL: s.URL(), UpdateHandler: func(telegram.Update) {}, Logger: logger}
+	webhook := httptest.NewServer(&api)
+	defer webhook.Close()
+
+	api.SetWebhook(webhook.URL)
+	text := "/start"
+	s.PushUpdate(telegram.Update{Message: &telegram.Message{Chat: telegram.Chat{ID: 10}, From: &telegram.User{ID: 1}, Text: &text}})
+	s.Close()
+	err := api.SendMessage(10, "Hello")
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(log.String()), "\n") {
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 5 {
+		t.Fatal(log.String())
+	}
+
+	// The request and its response have the same correlation ID
+	if records[0]["msg"] != "API request" || records[1]["msg"] != "API response" || records[0]["method"] != "setWebhook" ||
+		records[0]["request_id"] == "" || records[0]["request_id"] != records[1]["request_id"] {
+		t.Error(records[0], records[1])
+	}
+	if records[2]["msg"] != "Update received" || records[2]["update_id"] != 1.0 || !strings.Contains(records[2]["update"].(string), `"text":"/start"`) {
+		t.Error(records[2])
+	}
+
+	// The URL containing the bot token isn't logged when a request fails
+	if records[3]["params"] != `{"chat_id":10,"text":"Hello"}` || records[4]["msg"] != "API request failed" ||
+		records[4]["level"] != "DEBUG" || records[4]["request_id"] != records[3]["request_id"] {
+		t.Error(records[3], records[4])
+	}
+	if err == nil || strings.Contains(err.Error(), "botTEST") || strings.Contains(log.String(), "botTEST") {
+		t.Error(err, log.String())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	api := telegram.BotAPI{TelegramURL: s.URL(), RetryBackoff: time.Millisecond}
+	serverError := Failure{Status: 500, Description: "Internal Server Error"}
+
+	// Server errors are retried
+	s.FailNext("answerCallbackQuery", serverError, Failure{Status: 502, Description: "Bad Gateway"})
+	if err := api.AnswerCallbackQuery("q1", ""); err != nil {
+		t.Error(err)
+	}
+	if n := len(s.Requests("answerCallbackQuery")); n != 3 {
+		t.Error(n)
+	}
+
+	// Too many requests are repeated after the time asked by Telegram
+	s.FailNext("sendMessage", Failure{Status: 429, Description: "Too Many Requests: retry after 1", RetryAfter: 1})
+	start := time.Now()
+	if err := api.SendMessage(10, "Hello"); err != nil || time.Since(start) < time.Second {
+		t.Error(err, time.Since(start))
+	}
+	if m := s.Messages(10); len(m) != 1 || len(s.Requests("sendMessage")) != 2 {
+		t.Error(m)
+	}
+
+	tests := []struct {
+		method     string
+		failures   []Failure
+		maxRetries int
+		requests   int
+		expected   telegram.APIError
+		temporary  bool
+	}{
+		{"sendMessage", []Failure{{Status: 403, Description: "Forbidden: bot was blocked by the user"}}, 0, 1,
+			telegram.APIError{Method: "sendMessage", StatusCode: 403, Code: 403, Description: "Forbidden: bot was blocked by the user"}, false},
+		// The message may have been sent already
+		{"sendMessage", []Failure{serverError}, 0, 1,
+			telegram.APIError{Method: "sendMessage", StatusCode: 500, Code: 500, Description: "Internal Server Error"}, true},
+		{"answerCallbackQuery", []Failure{serverError, serverError, serverError, serverError}, 0, 4,
+			telegram.APIError{Method: "answerCallbackQuery", StatusCode: 500, Code: 500, Description: "Internal Server Error"}, true},
+		{"answerCallbackQuery", []Failure{serverError, serverError}, 1, 2,
+			telegram.APIError{Method: "answerCallbackQuery", StatusCode: 500, Code: 500, Description: "Internal Server Error"}, true},
+		{"answerCallbackQuery", []Failure{serverError}, -1, 1,
+			telegram.APIError{Method: "answerCallbackQuery", StatusCode: 500, Code: 500, Description: "Internal Server Error"}, true},
+		// Waiting for long would stall the bot
+		{"sendMessage", []Failure{{Status: 429, Description: "Too Many Requests: retry after 120", RetryAfter: 120}}, 0, 1,
+			telegram.APIError{Method: "sendMessage", StatusCode: 429, Code: 429, Description: "Too Many Requests: retry after 120", RetryAfter: 120}, true},
+		{"sendMessage", []Failure{{Status: 429, Description: "Too Many Requests: retry after 11", RetryAfter: 11}}, 0, 1,
+			telegram.APIError{Method: "sendMessage", StatusCode: 429, Code: 429, Description: "Too Many Requests: retry after 11", RetryAfter: 11}, true},
+	}
+	for i, test := range tests {
+		api.MaxRetries = test.maxRetries
+		s.FailNext(test.method, test.failures...)
+		before := len(s.Requests(test.method))
+		var err error
+		if test.method == "sendMessage" {
+			err = api.SendMessage(10, "Failing")
+		} else {
+			err = api.AnswerCallbackQuery("q2", "Failing")
+		}
+		apiErr, ok := err.(*telegram.APIError)
+		if !ok || *apiErr != test.expected || apiErr.Temporary() != test.temporary {
+			t.Error(i, err)
+		}
+		if n := len(s.Requests(test.method)) - before; n != test.requests {
+			t.Error(i, n)
+		}
+	}
+	if m := s.Messages(10); len(m) != 1 {
+		t.Error(m)
+	}
+}
+
+func TestErrorWithoutJSON(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>Bad Gateway</html>", http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+	api := telegram.BotAPI{TelegramURL: proxy.URL + "/", MaxRetries: -1}
+
+	err := api.SendMessage(10, "Hello")
+	if apiErr, ok := err.(*telegram.APIError); !ok || apiErr.StatusCode != 502 || apiErr.Description != "Bad Gateway" || !apiErr.Temporary() {
+		t.Error(err)
+	}
+}
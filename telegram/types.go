@@ -1,5 +1,7 @@
 package telegram
 
+import "encoding/json"
+
 // User represents a Telegram user or bot.
 type User struct {
 	// Unique identifier for this user or bot.
@@ -36,12 +38,27 @@ type Message struct {
 	Text *string `json:"text"`
 }
 
+// CallbackQuery represents an incoming callback query from a callback button in an inline keyboard.
+type CallbackQuery struct {
+	// Unique identifier for this query.
+	ID string `json:"id"`
+	// Sender.
+	From User `json:"from"`
+	// Optional. Message with the callback button that originated the query. Note that message content and message
+	// date will not be available if the message is too old.
+	Message *Message `json:"message"`
+	// Optional. Data associated with the callback button.
+	Data *string `json:"data"`
+}
+
 // Update represents an incoming Telegram update.
 type Update struct {
 	// The update‘s unique identifier. Update identifiers start from a certain positive number and increase sequentially.
 	UpdateID int `json:"update_id"`
 	// Optional. New incoming message of any kind — text, photo, sticker, etc.
 	Message *Message `json:"message"`
+	// Optional. New incoming callback query.
+	CallbackQuery *CallbackQuery `json:"callback_query"`
 }
 
 // SetWebhookParams defines parameters for Telegram API setWebhook method
@@ -50,6 +67,38 @@ type SetWebhookParams struct {
 	URL string `json:"url"`
 }
 
+// GetUpdatesParams defines parameters for Telegram API getUpdates method
+type GetUpdatesParams struct {
+	// Identifier of the first update to be returned. Must be greater by one than the highest among the identifiers of
+	// previously received updates.
+	Offset int `json:"offset,omitempty"`
+	// Timeout in seconds for long polling.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Response represents the response object returned by all Telegram API methods.
+type Response struct {
+	// True if the request was successful.
+	OK bool `json:"ok"`
+	// Optional. Human-readable description of the result or error.
+	Description string `json:"description"`
+	// Optional. The result of the query, if the request was successful.
+	Result json.RawMessage `json:"result"`
+	// Optional. Error code of an unsuccessful request.
+	ErrorCode int `json:"error_code,omitempty"`
+	// Optional. Information about why an unsuccessful request failed, e.g. how long to wait before repeating it.
+	Parameters *ResponseParameters `json:"parameters,omitempty"`
+}
+
+// ResponseParameters contains information about why a request was unsuccessful.
+type ResponseParameters struct {
+	// Optional. The group has been migrated to a supergroup with the specified identifier.
+	MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+	// Optional. In case of exceeding flood control, the number of seconds left to wait before the request can be
+	// repeated.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
 // KeyboardButton represents one button of the reply keyboard.
 type KeyboardButton struct {
 	// Text of the button. It will be sent to the bot as a message when the button is pressed.
@@ -81,6 +130,20 @@ type ReplyKeyboardRemove struct {
 	Selective *bool `json:"selective,omitempty"`
 }
 
+// InlineKeyboardButton represents one button of an inline keyboard.
+type InlineKeyboardButton struct {
+	// Label text on the button.
+	Text string `json:"text"`
+	// Data to be sent in a callback query to the bot when button is pressed, 1-64 bytes.
+	CallbackData string `json:"callback_data"`
+}
+
+// InlineKeyboardMarkup represents an inline keyboard that appears right next to the message it belongs to.
+type InlineKeyboardMarkup struct {
+	// Array of button rows, each represented by an Array of InlineKeyboardButton objects.
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
 // SendMessageParams defines parameters for Telegram API sendMessage method
 type SendMessageParams struct {
 	// Unique identifier for the target chat
@@ -88,7 +151,30 @@ type SendMessageParams struct {
 	// Text of the message to be sent
 	Text string `json:"text"`
 	// Optional. Add/remove custom keyboard. Allowed types:
+	// - InlineKeyboardMarkup
 	// - ReplyKeyboardMarkup
 	// - ReplyKeyboardRemove
 	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
 }
+
+// EditMessageTextParams defines parameters for Telegram API editMessageText method
+type EditMessageTextParams struct {
+	// Unique identifier for the target chat
+	ChatID int `json:"chat_id"`
+	// Identifier of the message to edit
+	MessageID int `json:"message_id"`
+	// New text of the message
+	Text string `json:"text"`
+	// Optional. New inline keyboard. The keyboard is removed if not given.
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+// AnswerCallbackQueryParams defines parameters for Telegram API answerCallbackQuery method
+type AnswerCallbackQueryParams struct {
+	// Unique identifier for the query to be answered
+	CallbackQueryID string `json:"callback_query_id"`
+	// Optional. Text of the notification. If not specified, nothing will be shown to the user.
+	Text string `json:"text,omitempty"`
+	// Optional. If true, an alert will be shown by the client instead of a notification at the top of the chat screen.
+	ShowAlert bool `json:"show_alert,omitempty"`
+}